@@ -1,10 +1,19 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
 
 	"time"
 
@@ -12,64 +21,533 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"snapchef/internal/api"
+	"snapchef/internal/platform/claude"
 	"snapchef/internal/platform/gemini"
 	"snapchef/internal/platform/localllm"
+	"snapchef/internal/platform/openai"
 	"snapchef/internal/recipe"
 )
 
 // Config represents the application configuration.
 type Config struct {
 	GeminiAPIKey string `json:"gemini_api_key"`
+	ClaudeAPIKey string `json:"claude_api_key"`
+	OpenAIAPIKey string `json:"openai_api_key"`
 	DatabaseURL  string `json:"DATABASE_URL"`
+	AdminToken   string `json:"admin_token"`
+
+	// TLSCertFile and TLSKeyFile serve the API over HTTPS when both are set,
+	// and plain HTTP otherwise.
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	// RedirectHTTP, with TLS, answers plain HTTP requests with a redirect to HTTPS.
+	RedirectHTTP bool `json:"redirect_http"`
+
+	// ReadHeaderTimeoutSeconds, ReadTimeoutSeconds and IdleTimeoutSeconds
+	// override how long the server waits for a request's headers, for the
+	// whole request, and for the next request on a kept-alive connection.
+	// WriteTimeoutSeconds bounds how long a response may take, without a
+	// limit by default.
+	ReadHeaderTimeoutSeconds int `json:"read_header_timeout_seconds"`
+	ReadTimeoutSeconds       int `json:"read_timeout_seconds"`
+	WriteTimeoutSeconds      int `json:"write_timeout_seconds"`
+	IdleTimeoutSeconds       int `json:"idle_timeout_seconds"`
+
+	// DefaultEngine is the engine used by /recipefinder and the other routes
+	// when a request doesn't pick one with ?engine=, "gemini" if unset.
+	DefaultEngine string `json:"default_engine"`
+
+	// PrettyJSON indents every JSON response, for development.
+	PrettyJSON bool `json:"pretty_json"`
+
+	// StrictValidation regenerates a recipe once when its cooking time,
+	// difficulty and number of steps don't add up.
+	StrictValidation bool `json:"strict_validation"`
+
+	// RequireRealPhoto rejects illustrations and AI-generated pictures of food.
+	RequireRealPhoto bool `json:"require_real_photo"`
+
+	// EnableModeration rejects inappropriate uploads before generating recipes.
+	EnableModeration bool `json:"enable_moderation"`
+
+	// BlockedTerms rejects uploads whose cuisine or dietary preference contains
+	// any of these terms with a 422. BlockDescriptions also checks what the
+	// food check saw in the image.
+	BlockedTerms      []string `json:"blocked_terms"`
+	BlockDescriptions bool     `json:"block_descriptions"`
+
+	// Watermark draws a logo on saved recipe images. Leave it out to disable watermarking.
+	Watermark *WatermarkConfig `json:"watermark"`
+
+	// LocalQueueSize is how many requests may wait for the local engine before
+	// more are turned away with a 503. Zero disables the queue.
+	LocalQueueSize int `json:"local_queue_size"`
+	// LocalConcurrency is how many requests the local engine works on at once, 1 if unset.
+	LocalConcurrency int `json:"local_concurrency"`
+
+	// HashMode is how uploads are hashed to find their recipe: "bytes" (the
+	// default) hashes the file, "pixels" the decoded image, so re-encoded
+	// copies of a photo share a recipe.
+	HashMode string `json:"hash_mode"`
+
+	// LLMImageMaxDimension scales images down so neither side is longer than
+	// this many pixels before they are sent to an engine. Zero sends them as uploaded.
+	LLMImageMaxDimension uint `json:"llm_image_max_dimension"`
+
+	// PlaceholderImage is served in place of recipe images that are missing. Leave it out to serve a 404.
+	PlaceholderImage string `json:"placeholder_image"`
+
+	// DiscardOriginalImages stores new recipe images at the size they are
+	// served in rather than as uploaded, so they can't be downloaded at full
+	// resolution.
+	DiscardOriginalImages bool `json:"discard_original_images"`
+
+	// ImageQuotaMB caps the total size of the images directory. Zero means no limit.
+	ImageQuotaMB int64 `json:"image_quota_mb"`
+
+	// MultipartMemoryMB is how much of a multipart upload is kept in memory,
+	// the rest is written to temporary files. Gin's default of 32 MB if unset.
+	MultipartMemoryMB int64 `json:"multipart_memory_mb"`
+	// MaxUploadMB overrides the largest multipart request accepted.
+	MaxUploadMB int64 `json:"max_upload_mb"`
+	// MaxMultipartParts overrides how many fields and files a multipart request may have.
+	MaxMultipartParts int `json:"max_multipart_parts"`
+
+	// MaxChatSessions overrides how many recipe chats may be open at once.
+	MaxChatSessions int `json:"max_chat_sessions"`
+	// ChatSessionMinutes overrides how long a recipe chat may stay open.
+	ChatSessionMinutes int `json:"chat_session_minutes"`
+
+	// CircuitBreakerThreshold overrides how many failed calls in a row open
+	// an engine's circuit breaker. Negative disables the breakers.
+	CircuitBreakerThreshold int `json:"circuit_breaker_threshold"`
+	// CircuitBreakerCooldownSeconds overrides how long an open breaker fails
+	// calls before letting one through to test the engine.
+	CircuitBreakerCooldownSeconds int `json:"circuit_breaker_cooldown_seconds"`
+
+	// DuplicateUploadWindowSeconds overrides how long a client's upload is
+	// answered again for a duplicate of it. Negative disables the check.
+	DuplicateUploadWindowSeconds int `json:"duplicate_upload_window_seconds"`
+
+	// MaxUnfilteredResults overrides the most recipes GET /recipes lists
+	// without a filter or pagination parameters. Negative disables the cap.
+	MaxUnfilteredResults int `json:"max_unfiltered_results"`
+
+	// ReportArchiveThreshold overrides the number of reports that archives a recipe.
+	ReportArchiveThreshold int `json:"report_archive_threshold"`
+
+	// MinRecipeConfidence is the lowest confidence, from 0 to 1, a generated
+	// recipe needs to be saved. Zero saves every recipe.
+	MinRecipeConfidence float64 `json:"min_recipe_confidence"`
+
+	// LLMSampleRate is the share of Gemini and local LLM prompts, from 0 to
+	// 1, saved with their responses to the prompt_samples table for review.
+	// Zero saves none.
+	LLMSampleRate float64 `json:"llm_sample_rate"`
+
+	// SimilarityThreshold overrides how many perceptual hash bits may differ
+	// between images that POST /images/search counts as similar.
+	SimilarityThreshold int `json:"similarity_threshold"`
+
+	// SlowQueryThresholdMS logs database queries slower than this many milliseconds. Zero disables it.
+	SlowQueryThresholdMS int `json:"slow_query_threshold_ms"`
+
+	// AllowedModels lists the models requests may pick with ?model= on the Gemini and local engines.
+	AllowedModels []string `json:"allowed_models"`
+
+	// GeminiModel is the model the Gemini engine uses, gemini-1.5-flash if empty.
+	GeminiModel string `json:"gemini_model"`
+	// GeminiJSONSchema has Gemini generate recipes in JSON mode with a response schema.
+	GeminiJSONSchema bool `json:"gemini_json_schema"`
+
+	// JSONRetries overrides how many times the Gemini and local engines are
+	// asked again for a recipe that isn't valid JSON. Negative disables it.
+	JSONRetries int `json:"json_retries"`
+
+	// FoodCheckPrompt replaces the prompt every engine uses to check whether an image is food.
+	FoodCheckPrompt string `json:"food_check_prompt"`
+
+	// Styles replaces the recipe styles uploads may ask for with ?style=,
+	// mapping each name to the sentence it adds to the recipe prompt.
+	Styles map[string]string `json:"styles"`
+
+	// DietarySynonyms maps extra dietary preference synonyms to their canonical name, e.g. {"veggie": "vegetarian"}.
+	DietarySynonyms map[string]string `json:"dietary_preference_synonyms"`
 }
 
-func main() {
-	ctx := context.Background()
+// WatermarkConfig configures the watermark on saved recipe images.
+type WatermarkConfig struct {
+	// Logo is the path of a PNG logo.
+	Logo string `json:"logo"`
+	// Position is the corner to draw it in: top-left, top-right, bottom-left or bottom-right (default).
+	Position string `json:"position"`
+}
 
-	// Read configuration from config.json
-	configData, err := os.ReadFile("config.json")
+// loadConfig reads the configuration from path. A missing file is an empty
+// configuration, for local-only deployments that need no API keys.
+func loadConfig(path string) (Config, error) {
+	var config Config
+	configData, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("No %s found, using the default configuration", path)
+		return config, nil
+	}
 	if err != nil {
-		panic(fmt.Errorf("failed to read config.json: %w", err))
+		return config, fmt.Errorf("failed to read %s: %w", path, err)
 	}
-
-	var config Config
 	if err := json.Unmarshal(configData, &config); err != nil {
-		panic(fmt.Errorf("failed to unmarshal config.json: %w", err))
+		return config, fmt.Errorf("failed to unmarshal %s: %w", path, err)
 	}
+	return config, nil
+}
 
-	geminiClient, err := gemini.NewClient(ctx, config.GeminiAPIKey)
+func main() {
+	ctx := context.Background()
+
+	config, err := loadConfig("config.json")
 	if err != nil {
-		panic(fmt.Errorf("error creating gemini client: %w", err))
+		panic(err)
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		panic(fmt.Errorf("tls_cert_file and tls_key_file must be set together"))
 	}
 
-	localLLMClient := localllm.NewClient()
+	recipe.AddDietarySynonyms(config.DietarySynonyms)
+
+	jsonRetries := recipe.DefaultJSONRetries
+	switch {
+	case config.JSONRetries > 0:
+		jsonRetries = config.JSONRetries
+	case config.JSONRetries < 0:
+		jsonRetries = 0
+	}
 
-	dbStore, err := recipe.NewPostgresStore(config.DatabaseURL)
+	dbStore, err := recipe.NewPostgresStore(cmp.Or(config.DatabaseURL, os.Getenv("DATABASE_URL")))
 	if err != nil {
 		panic(fmt.Errorf("error creating postgresstore: %w", err))
 	}
+	dbStore.SlowQueryThreshold = time.Duration(config.SlowQueryThresholdMS) * time.Millisecond
+
+	if config.LLMSampleRate < 0 || config.LLMSampleRate > 1 {
+		panic(fmt.Errorf("invalid llm_sample_rate %g, expected a number from 0 to 1", config.LLMSampleRate))
+	}
+	var sampler *recipe.PromptSampler
+	if config.LLMSampleRate > 0 {
+		sampler = recipe.NewPromptSampler(config.LLMSampleRate, dbStore.SavePromptSample)
+	}
+
+	// Gemini is optional too, so local-only deployments need no API key. The
+	// interface stays nil without one, which the handler reports as a 501.
+	var geminiClient api.GeminiClient
+	if config.GeminiAPIKey != "" {
+		client, err := gemini.NewClient(ctx, config.GeminiAPIKey, config.GeminiModel)
+		if err != nil {
+			panic(fmt.Errorf("error creating gemini client: %w", err))
+		}
+		checkGeminiModel(ctx, client)
+		client.JSONSchema = config.GeminiJSONSchema
+		client.JSONRetries = jsonRetries
+		client.Sampler = sampler
+		if config.FoodCheckPrompt != "" {
+			client.FoodCheckPrompt = config.FoodCheckPrompt
+		}
+		geminiClient = client
+	} else {
+		log.Println("No gemini_api_key configured, the Gemini engine is disabled")
+	}
+
+	localLLMClient := localllm.NewClient()
+	localLLMClient.JSONRetries = jsonRetries
+	localLLMClient.Sampler = sampler
+	if config.FoodCheckPrompt != "" {
+		localLLMClient.FoodCheckPrompt = config.FoodCheckPrompt
+	}
+
+	checkLocalModel(ctx, localLLMClient)
 
 	handler := api.NewHandler(geminiClient, localLLMClient, dbStore)
+	handler.AdminToken = config.AdminToken
+	handler.PrettyJSON = config.PrettyJSON
+	handler.StrictValidation = config.StrictValidation
+	handler.RequireRealPhoto = config.RequireRealPhoto
+	handler.EnableModeration = config.EnableModeration
+	handler.BlockedTerms = config.BlockedTerms
+	handler.BlockDescriptions = config.BlockDescriptions
+	handler.AllowedModels = config.AllowedModels
+	if config.Watermark != nil {
+		watermark, err := api.NewWatermark(config.Watermark.Logo, config.Watermark.Position)
+		if err != nil {
+			panic(fmt.Errorf("error loading watermark: %w", err))
+		}
+		handler.Watermark = watermark
+	}
+	switch config.HashMode {
+	case "", api.HashModeBytes, api.HashModePixels:
+		handler.HashMode = config.HashMode
+	default:
+		panic(fmt.Errorf("invalid hash_mode %q, expected %q or %q", config.HashMode, api.HashModeBytes, api.HashModePixels))
+	}
+	if config.LLMImageMaxDimension > 0 {
+		handler.ImagePreprocessor = api.NewImagePreprocessor(config.LLMImageMaxDimension)
+	}
+	if config.PlaceholderImage != "" {
+		if _, err := os.Stat(config.PlaceholderImage); err != nil {
+			panic(fmt.Errorf("error loading placeholder image: %w", err))
+		}
+		handler.PlaceholderImage = config.PlaceholderImage
+	}
+	if config.LocalQueueSize > 0 {
+		handler.LocalQueue = api.NewLLMQueue(config.LocalConcurrency, config.LocalQueueSize)
+	}
+	if config.ImageQuotaMB > 0 {
+		handler.ImageQuota = api.NewImageQuota("images", config.ImageQuotaMB<<20, dbStore)
+		go handler.ImageQuota.Run(ctx, time.Minute)
+	}
+	handler.DiscardOriginals = config.DiscardOriginalImages
+	handler.AccessTracker = api.NewAccessTracker(dbStore)
+	go handler.AccessTracker.Run(ctx, time.Minute)
+	if config.MaxUploadMB > 0 {
+		handler.MaxUploadBytes = config.MaxUploadMB << 20
+	}
+	if config.MaxMultipartParts > 0 {
+		handler.MaxMultipartParts = config.MaxMultipartParts
+	}
+	if config.CircuitBreakerThreshold >= 0 {
+		handler.CircuitBreakers = make(map[string]*api.CircuitBreaker)
+		for _, engine := range []string{api.EngineGemini, api.EngineLocal, api.EngineClaude, api.EngineOpenAI} {
+			handler.CircuitBreakers[engine] = api.NewCircuitBreaker(
+				cmp.Or(config.CircuitBreakerThreshold, api.DefaultBreakerThreshold),
+				cmp.Or(time.Duration(config.CircuitBreakerCooldownSeconds)*time.Second, api.DefaultBreakerCooldown),
+			)
+		}
+	}
+	if config.MaxChatSessions > 0 || config.ChatSessionMinutes > 0 {
+		handler.ChatSessions = api.NewChatSessions(
+			cmp.Or(config.MaxChatSessions, api.DefaultMaxChatSessions),
+			cmp.Or(time.Duration(config.ChatSessionMinutes)*time.Minute, api.DefaultChatSessionLifetime),
+		)
+	}
+	if config.DuplicateUploadWindowSeconds >= 0 {
+		handler.UploadDedup = api.NewUploadDedup(cmp.Or(time.Duration(config.DuplicateUploadWindowSeconds)*time.Second, api.DefaultDuplicateUploadWindow))
+	}
+	switch {
+	case config.MaxUnfilteredResults > 0:
+		handler.MaxUnfilteredResults = config.MaxUnfilteredResults
+	case config.MaxUnfilteredResults < 0:
+		handler.MaxUnfilteredResults = 0
+	}
+	if config.ReportArchiveThreshold > 0 {
+		handler.ReportArchiveThreshold = config.ReportArchiveThreshold
+	}
+	if len(config.Styles) > 0 {
+		handler.Styles = make(map[string]string, len(config.Styles))
+		for name, snippet := range config.Styles {
+			style := recipe.NormalizeStyle(name)
+			if style == "" || strings.TrimSpace(snippet) == "" {
+				panic(fmt.Errorf("invalid style %q, styles need a name and a prompt", name))
+			}
+			handler.Styles[style] = strings.TrimSpace(snippet)
+		}
+	}
+	if config.MinRecipeConfidence < 0 || config.MinRecipeConfidence > 1 {
+		panic(fmt.Errorf("invalid min_recipe_confidence %g, expected a number from 0 to 1", config.MinRecipeConfidence))
+	}
+	handler.MinRecipeConfidence = config.MinRecipeConfidence
+	if config.SimilarityThreshold > 0 {
+		handler.SimilarityThreshold = config.SimilarityThreshold
+	}
+
+	// Claude and OpenAI are optional and only enabled when an API key is configured
+	if config.ClaudeAPIKey != "" {
+		claudeClient := claude.NewClient(config.ClaudeAPIKey)
+		if config.FoodCheckPrompt != "" {
+			claudeClient.FoodCheckPrompt = config.FoodCheckPrompt
+		}
+		handler.ClaudeClient = claudeClient
+	}
+	if config.OpenAIAPIKey != "" {
+		openAIClient := openai.NewClient(config.OpenAIAPIKey)
+		if config.FoodCheckPrompt != "" {
+			openAIClient.FoodCheckPrompt = config.FoodCheckPrompt
+		}
+		handler.OpenAIClient = openAIClient
+	}
+	if config.DefaultEngine == "" && geminiClient == nil {
+		log.Printf("Requests that don't choose an engine use the %s engine", api.EngineLocal)
+		config.DefaultEngine = api.EngineLocal
+	}
+	if config.DefaultEngine != "" {
+		if err := handler.CheckEngine(config.DefaultEngine); err != nil {
+			panic(fmt.Errorf("invalid default_engine: %w", err))
+		}
+		handler.DefaultEngine = config.DefaultEngine
+	}
 
 	r := gin.Default()
+	if config.MultipartMemoryMB > 0 {
+		r.MaxMultipartMemory = config.MultipartMemoryMB << 20
+	}
 
 	// Configure CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:8081"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", "X-Page", "Link"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
-		r.POST("/recipefinder", handler.Upload)
+	r.Use(handler.CountErrors)
+	r.Use(handler.LimitMultipart)
+	r.POST("/recipefinder", handler.Upload)
+	r.POST("/recipefinder/base64", handler.UploadBase64)
+	r.POST("/recipefinder/multi", handler.UploadMulti)
 	r.POST("/v2/recipefinder", handler.UploadV2)
 	r.GET("/recipes", handler.GetRecipes)
+	r.DELETE("/recipes", handler.RequireAdmin, handler.DeleteRecipes)
+	r.GET("/recipes/feed.xml", handler.RecipesFeed)
+	r.GET("/recipes/stream.ndjson", handler.StreamRecipes)
 	r.GET("/recipes/:image_hash", handler.GetRecipe)
+	r.DELETE("/recipes/:image_hash", handler.RequireAdmin, handler.DeleteRecipe)
+	r.POST("/recipes/batch", handler.GetRecipesBatch)
+	r.GET("/recipes/:image_hash/also-using", handler.RecipesAlsoUsing)
+	r.GET("/recipes/:image_hash/shopping-cart", handler.GetShoppingCart)
+	r.GET("/recipes/:image_hash/pairings", handler.GetPairings)
+	r.POST("/recipes/:image_hash/regenerate-cart", handler.RegenerateShoppingCart)
+	r.POST("/recipes/:image_hash/report", handler.ReportRecipe)
+	r.POST("/recipes/:image_hash/max-servings", handler.MaxServings)
+	r.POST("/meal-plan", handler.MealPlan)
+	r.GET("/recipes/:image_hash/check-diet", handler.CheckDiet)
+	r.POST("/recipes/:image_hash/steps/:n/image", handler.UploadStepImage)
+	r.GET("/recipes/:image_hash/chat", handler.Chat)
 	r.GET("/image-metadata/:image_hash", handler.GetImageDescription)
-		r.POST("/imageencoder", handler.UploadImage)
+	r.POST("/image-metadata/:image_hash/regenerate", handler.RequireAdmin, handler.RegenerateImageMetadata)
+	r.POST("/imageencoder", handler.UploadImage)
+	r.POST("/images/search", handler.SearchImages)
 	r.POST("/is-food", handler.IsFood)
+	r.POST("/validate", handler.Validate)
+	r.POST("/shopping-cart", handler.GenerateShoppingCart)
+	r.POST("/ingredients", handler.ExtractIngredients)
 	r.POST("/recipe-finder-local", handler.RecipeFinderLocal)
-	r.Static("/images", "./images")
-	r.Run(":8080") // listen and serve on 0.0.0.0:8081
+
+	admin := r.Group("/admin", handler.RequireAdmin)
+	admin.POST("/warmup", handler.Warmup)
+	admin.GET("/reports", handler.GetReports)
+	admin.GET("/export-all", handler.ExportAll)
+	admin.GET("/orphan-images", handler.GetOrphanImages)
+	admin.DELETE("/orphan-images", handler.DeleteOrphanImages)
+	admin.GET("/stale-recipes", handler.GetStaleRecipes)
+	admin.DELETE("/stale-recipes", handler.DeleteStaleRecipes)
+	admin.POST("/recipes/merge", handler.MergeRecipes)
+	admin.GET("/storage-stats", handler.GetStorageStats)
+	r.POST("/debug/describe", handler.RequireAdmin, handler.DescribeImage)
+
+	r.GET("/metrics", handler.Metrics)
+	r.GET("/images/*filepath", handler.ServeImage)
+	r.HEAD("/images/*filepath", handler.ServeImage)
+
+	if config.TLSCertFile == "" {
+		if err := newServer(httpAddr, r.Handler(), config).ListenAndServe(); err != nil {
+			panic(fmt.Errorf("error serving HTTP: %w", err))
+		}
+		return
+	}
+	if config.RedirectHTTP {
+		go func() {
+			if err := newServer(httpAddr, redirectToHTTPS(httpsAddr), config).ListenAndServe(); err != nil {
+				log.Printf("HTTP to HTTPS redirect stopped: %s", err.Error())
+			}
+		}()
+	}
+	if err := newServer(httpsAddr, r.Handler(), config).ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile); err != nil {
+		panic(fmt.Errorf("error serving HTTPS: %w", err))
+	}
+}
+
+// Server timeouts, unless configured otherwise. Headers must arrive quickly,
+// so clients trickling bytes can't hold connections open, while the whole
+// request may take longer for large uploads over mobile networks. Responses
+// aren't bounded, since recipe chats and streams stay open for minutes.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 2 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// newServer returns a server for handler on addr, with the timeouts from
+// config. With TLS it offers HTTP/2, falling back to HTTP/1.1 for clients
+// that don't support it.
+func newServer(addr string, handler http.Handler, config Config) *http.Server {
+	seconds := func(n int) time.Duration { return time.Duration(n) * time.Second }
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cmp.Or(seconds(config.ReadHeaderTimeoutSeconds), defaultReadHeaderTimeout),
+		ReadTimeout:       cmp.Or(seconds(config.ReadTimeoutSeconds), defaultReadTimeout),
+		WriteTimeout:      seconds(config.WriteTimeoutSeconds),
+		IdleTimeout:       cmp.Or(seconds(config.IdleTimeoutSeconds), defaultIdleTimeout),
+	}
+	if config.TLSCertFile != "" {
+		server.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+	return server
+}
+
+// httpAddr and httpsAddr are where the API listens for plain HTTP and HTTPS.
+const (
+	httpAddr  = ":8080"
+	httpsAddr = ":8443"
+)
+
+// redirectToHTTPS answers every request with a permanent redirect to the
+// same URL over HTTPS on the port of addr. 308 rather than 301, so uploads
+// are sent again as POSTs.
+func redirectToHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// checkGeminiModel panics if Gemini doesn't know the model the Gemini engine
+// is configured with, rather than failing every request. Other errors are
+// only logged, so a network hiccup at startup doesn't stop the server.
+func checkGeminiModel(ctx context.Context, client *gemini.Client) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := client.CheckModel(ctx); err != nil {
+		if errors.Is(err, gemini.ErrUnknownModel) {
+			panic(fmt.Errorf("invalid gemini_model: %w", err))
+		}
+		log.Printf("Could not check the Gemini model %q: %s", client.Model(), err.Error())
+	}
+}
+
+// checkLocalModel warns if the local LLM server doesn't have the model the
+// local engine asks for, which otherwise only shows as a failed first
+// request. A server that isn't running is only logged, since the local
+// engine may not be used at all.
+func checkLocalModel(ctx context.Context, client *localllm.Client) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		log.Printf("Could not list the local LLM models: %s", err.Error())
+		return
+	}
+	if !slices.Contains(models, client.Model()) {
+		log.Printf("WARNING: local LLM model %q is not loaded, available models: %s", client.Model(), strings.Join(models, ", "))
+	}
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// recipeToucher is the part of RecipeStore an AccessTracker writes to.
+type recipeToucher interface {
+	TouchRecipes(ctx context.Context, imageHashes []string) error
+}
+
+// AccessTracker records which recipes were served and writes their last
+// access time to the store in one batched UPDATE per flush, so serving a
+// recipe never waits on a write.
+type AccessTracker struct {
+	store recipeToucher
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+// NewAccessTracker creates a tracker writing to store.
+func NewAccessTracker(store recipeToucher) *AccessTracker {
+	return &AccessTracker{store: store, pending: make(map[string]struct{})}
+}
+
+// Touch records that the recipes for imageHashes were just served. A nil
+// tracker records nothing.
+func (t *AccessTracker) Touch(imageHashes ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, imageHash := range imageHashes {
+		t.pending[imageHash] = struct{}{}
+	}
+}
+
+// Flush writes the access times recorded since the last flush. On failure
+// they are kept for the next one.
+func (t *AccessTracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	pending := t.pending
+	t.pending = make(map[string]struct{})
+	t.mu.Unlock()
+
+	imageHashes := make([]string, 0, len(pending))
+	for imageHash := range pending {
+		imageHashes = append(imageHashes, imageHash)
+	}
+	if err := t.store.TouchRecipes(ctx, imageHashes); err != nil {
+		t.Touch(imageHashes...)
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is done, and once more then.
+func (t *AccessTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.flushWithTimeout(context.Background())
+			return
+		case <-ticker.C:
+			t.flushWithTimeout(ctx)
+		}
+	}
+}
+
+// flushWithTimeout flushes, giving up after 5 seconds, and logs a failure.
+func (t *AccessTracker) flushWithTimeout(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := t.Flush(ctx); err != nil {
+		log.Printf("failed to record recipe access times: %s", err.Error())
+	}
+}
@@ -0,0 +1,443 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// Warmup handles POST /admin/warmup. It sends a tiny request to an engine,
+// the local LLM unless ?engine= says otherwise, so the model is loaded before
+// the first user request, and returns how long that took.
+func (h *Handler) Warmup(c *gin.Context) {
+	engine := c.DefaultQuery("engine", EngineLocal)
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Loading a model into VRAM can take a while
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.Warmup(ctx); err != nil {
+		c.String(http.StatusBadGateway, fmt.Sprintf("%s warmup failed: %s", engine, err.Error()))
+		return
+	}
+	latency := time.Since(start)
+	log.Printf("Warmed up %s in %s", engine, latency)
+
+	h.writeJSON(c, http.StatusOK, gin.H{
+		"engine":     engine,
+		"latency_ms": latency.Milliseconds(),
+	})
+}
+
+// DescribeImage handles POST /debug/describe, showing what an engine makes of
+// an image when a recipe for it turns out poorly. It asks the engine for a
+// free-form description, or sends the "prompt" form field instead when there
+// is one, and returns the answer as it is. Nothing is parsed or saved.
+func (h *Handler) DescribeImage(c *gin.Context) {
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	prompt := strings.TrimSpace(c.PostForm("prompt"))
+	if prompt == "" {
+		prompt = recipe.DescribePrompt
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	text, err := client.DescribeImage(ctx, imageData, prompt)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, gin.H{
+		"engine":     engine,
+		"prompt":     prompt,
+		"text":       text,
+		"latency_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// DeleteRecipes handles DELETE /recipes?cuisine=&dietary_preference=. It
+// deletes every recipe matching the filters, with their image metadata and
+// image files, and returns how many were deleted. At least one filter is
+// required so a bare request can't wipe the table.
+func (h *Handler) DeleteRecipes(c *gin.Context) {
+	cuisine := c.Query("cuisine")
+	dietaryPreference := recipe.NormalizeDietaryPreference(c.Query("dietary_preference"))
+	if cuisine == "" && dietaryPreference == "" {
+		c.String(http.StatusBadRequest, "At least one filter (cuisine or dietary_preference) is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	imagePaths, err := h.RecipeStore.DeleteRecipes(ctx, cuisine, dietaryPreference)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	// The rows are gone, so failing to remove a file only leaves an orphan behind
+	for _, imagePath := range imagePaths {
+		removeImageFiles(imagePath)
+	}
+	log.Printf("Deleted %d recipes (cuisine: %q, dietary preference: %q)", len(imagePaths), cuisine, dietaryPreference)
+
+	h.writeJSON(c, http.StatusOK, gin.H{"deleted": len(imagePaths)})
+}
+
+// DeleteRecipe handles DELETE /recipes/:image_hash, deleting the recipe
+// served for the image hash along with its image metadata and image files.
+// A hash merged into another recipe deletes that recipe, as GET
+// /recipes/:image_hash would show it.
+func (h *Handler) DeleteRecipe(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	if err := h.RecipeStore.DeleteRecipe(ctx, r.ImageHash); err != nil {
+		// Deleted by another request in the meantime
+		if errors.Is(err, sql.ErrNoRows) {
+			c.String(http.StatusNotFound, "Recipe not found")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	removeImageFiles(r.ImagePath)
+	log.Printf("Deleted recipe %s", r.ImageHash)
+
+	c.Status(http.StatusNoContent)
+}
+
+// staleBefore reads the required ?days= parameter of the stale recipe
+// endpoints and returns the access time recipes must be older than.
+func staleBefore(c *gin.Context) (time.Time, error) {
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days <= 0 {
+		return time.Time{}, fmt.Errorf("days must be a positive whole number")
+	}
+	return time.Now().AddDate(0, 0, -days), nil
+}
+
+// GetStaleRecipes handles GET /admin/stale-recipes?days=, listing the
+// recipes, archived or not, that haven't been served in that many days.
+func (h *Handler) GetStaleRecipes(c *gin.Context) {
+	before, err := staleBefore(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	recipes, err := h.RecipeStore.GetRecipes(ctx, recipe.Filter{LastAccessedBefore: before, IncludeArchived: true})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if recipes == nil {
+		recipes = []*recipe.Recipe{}
+	}
+
+	h.writeJSON(c, http.StatusOK, recipes)
+}
+
+// DeleteStaleRecipes handles DELETE /admin/stale-recipes?days=. It deletes
+// the recipes GetStaleRecipes lists, like DeleteRecipes does, and returns
+// how many were deleted.
+func (h *Handler) DeleteStaleRecipes(c *gin.Context) {
+	before, err := staleBefore(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Access times waiting to be written would otherwise not save a recipe
+	// served in the last minute
+	if h.AccessTracker != nil {
+		if err := h.AccessTracker.Flush(c.Request.Context()); err != nil {
+			h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	imagePaths, err := h.RecipeStore.DeleteStaleRecipes(ctx, before)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	for _, imagePath := range imagePaths {
+		removeImageFiles(imagePath)
+	}
+	log.Printf("Deleted %d recipes not accessed since %s", len(imagePaths), before.Format(time.RFC3339))
+
+	h.writeJSON(c, http.StatusOK, gin.H{"deleted": len(imagePaths)})
+}
+
+// removeImageFiles removes a saved recipe image and its cached thumbnails.
+func removeImageFiles(imagePath string) {
+	if imagePath == "" {
+		return
+	}
+	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove image %s: %s", imagePath, err.Error())
+	}
+
+	imageHash := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	thumbs, _ := filepath.Glob(filepath.Join(thumbnailDir, imageHash+"-*"))
+	for _, thumb := range thumbs {
+		if err := os.Remove(thumb); err != nil {
+			log.Printf("failed to remove thumbnail %s: %s", thumb, err.Error())
+		}
+	}
+}
+
+// imageConsistency compares the recipe images on disk with the recipes and
+// the image_data table. Each list holds image hashes, sorted.
+type imageConsistency struct {
+	// OrphanFiles are image files with neither a recipe nor image data. Nothing
+	// refers to them, so they can be deleted.
+	OrphanFiles []string `json:"orphan_files"`
+	// Unrestorable are recipe images on disk without image data, so they can't
+	// be saved again if the file is lost or evicted.
+	Unrestorable []string `json:"unrestorable"`
+	// Missing are recipes whose image file is gone and has no image data to be
+	// restored from.
+	Missing []string `json:"missing"`
+
+	// orphanPaths are the paths of OrphanFiles.
+	orphanPaths []string
+}
+
+// checkImageConsistency builds an imageConsistency for the files directly
+// under ./images.
+func (h *Handler) checkImageConsistency(ctx context.Context) (*imageConsistency, error) {
+	recipes, err := h.RecipeStore.GetRecipes(ctx, recipe.Filter{IncludeArchived: true})
+	if err != nil {
+		return nil, err
+	}
+	dataHashes, err := h.RecipeStore.GetImageDataHashes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hasData := make(map[string]bool, len(dataHashes))
+	for _, imageHash := range dataHashes {
+		hasData[imageHash] = true
+	}
+
+	entries, err := os.ReadDir("images")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read images directory: %w", err)
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		imageHash := strings.TrimSuffix(entry.Name(), extension)
+		switch extension {
+		case ".jpeg", ".jpg", ".png":
+		default:
+			continue
+		}
+		if entry.Type().IsRegular() && isImageHash(imageHash) {
+			files[imageHash] = filepath.Join("images", entry.Name())
+		}
+	}
+
+	report := &imageConsistency{OrphanFiles: []string{}, Unrestorable: []string{}, Missing: []string{}}
+	hasRecipe := make(map[string]bool, len(recipes))
+	for _, r := range recipes {
+		hasRecipe[r.ImageHash] = true
+		if r.ImagePath == "" || hasData[r.ImageHash] {
+			continue
+		}
+		if _, err := os.Stat(r.ImagePath); err == nil {
+			report.Unrestorable = append(report.Unrestorable, r.ImageHash)
+		} else if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, r.ImageHash)
+		}
+	}
+	for imageHash, path := range files {
+		if !hasRecipe[imageHash] && !hasData[imageHash] {
+			report.OrphanFiles = append(report.OrphanFiles, imageHash)
+			report.orphanPaths = append(report.orphanPaths, path)
+		}
+	}
+
+	sort.Strings(report.OrphanFiles)
+	sort.Strings(report.Unrestorable)
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// GetOrphanImages handles GET /admin/orphan-images, reporting images that are
+// in one store but not the other: files on disk, recipes and image_data.
+func (h *Handler) GetOrphanImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	report, err := h.checkImageConsistency(ctx)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to check images: %s", err.Error()))
+		return
+	}
+	h.writeJSON(c, http.StatusOK, report)
+}
+
+// DeleteOrphanImages handles DELETE /admin/orphan-images, deleting the image
+// files, and their thumbnails, that no recipe or image data refers to.
+func (h *Handler) DeleteOrphanImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	report, err := h.checkImageConsistency(ctx)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to check images: %s", err.Error()))
+		return
+	}
+	for _, path := range report.orphanPaths {
+		removeImageFiles(path)
+	}
+	log.Printf("Deleted %d orphan images", len(report.orphanPaths))
+
+	h.writeJSON(c, http.StatusOK, gin.H{"deleted": len(report.orphanPaths)})
+}
+
+// diskUsage is the number and total size of files in a directory tree.
+type diskUsage struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// dirUsage walks dir and adds up its files. A missing directory is empty.
+func dirUsage(dir string) (diskUsage, error) {
+	var usage diskUsage
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return diskUsage{}, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	return usage, nil
+}
+
+// GetStorageStats handles GET /admin/storage-stats, reporting how much space
+// the images on disk and the database take up. The images figure covers
+// everything under ./images, non-food images and thumbnails included.
+func (h *Handler) GetStorageStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	images, err := dirUsage("images")
+	if err != nil {
+		h.writeError(c, storageError(err), err.Error())
+		return
+	}
+	nonFoodImages, err := dirUsage(nonFoodImageDir)
+	if err != nil {
+		h.writeError(c, storageError(err), err.Error())
+		return
+	}
+	database, err := h.RecipeStore.GetStorageStats(ctx)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, gin.H{
+		"images":          images,
+		"non_food_images": nonFoodImages,
+		"database":        database,
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// maxBatchRecipes is the most recipes POST /recipes/batch returns at once.
+const maxBatchRecipes = 100
+
+// batchRecipesRequest is the JSON body of POST /recipes/batch.
+type batchRecipesRequest struct {
+	Hashes []string `json:"hashes" binding:"required"`
+}
+
+// GetRecipesBatch handles POST /recipes/batch, returning several recipes in
+// one query as a map of image hash to recipe. Merged hashes map to the
+// recipe they were merged into, and hashes without a recipe are left out of
+// the map.
+func (h *Handler) GetRecipesBatch(c *gin.Context) {
+	var req batchRecipesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err.Error()))
+		return
+	}
+	if len(req.Hashes) > maxBatchRecipes {
+		c.String(http.StatusBadRequest, fmt.Sprintf("At most %d recipes can be fetched at once.", maxBatchRecipes))
+		return
+	}
+
+	locale, err := parseLocale(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	recipes, err := h.RecipeStore.GetRecipesByHashes(ctx, req.Hashes)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	byHash := make(map[string]*recipe.Recipe, len(recipes))
+	for imageHash, r := range recipes {
+		h.AccessTracker.Touch(r.ImageHash)
+		byHash[imageHash] = localizeRecipe(r, locale)
+	}
+	h.writeJSON(c, http.StatusOK, byHash)
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// ErrCircuitOpen is returned by an engine whose circuit breaker is open,
+// without calling the engine.
+var ErrCircuitOpen = errors.New("engine circuit breaker is open")
+
+// Circuit breaker defaults, unless configured otherwise.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// Circuit breaker states, also the values of the state metric.
+const (
+	breakerClosed = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// CircuitBreaker stops calling an engine that keeps failing. After
+// threshold failures in a row it opens, and calls fail at once with
+// ErrCircuitOpen for the cooldown. Then it half-opens: one call is let
+// through to test the engine, and closes the breaker if it succeeds or
+// opens it again if it fails.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+
+	trips    atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewCircuitBreaker creates a closed breaker that opens after threshold
+// failures in a row, for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: max(threshold, 1), cooldown: cooldown}
+}
+
+// allow returns ErrCircuitOpen if a call may not go through. A call that
+// does must be followed by record.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.rejected.Add(1)
+			return ErrCircuitOpen
+		}
+		// This call is the one testing the engine
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		b.rejected.Add(1)
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of a call allow let through.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		// The client gave up, which says nothing about the engine
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+		return
+	}
+	if !isEngineFailure(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			b.trips.Add(1)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// retryAfter returns how long until the breaker half-opens.
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(b.cooldown-time.Since(b.openedAt), 0)
+}
+
+// State returns the breaker's state, one of the breaker* constants.
+func (b *CircuitBreaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// isEngineFailure reports whether err means the engine is unhealthy, as
+// opposed to a call it answered, such as a refusal or an image that isn't
+// food.
+func isEngineFailure(err error) bool {
+	var moderationErr *recipe.ModerationError
+	switch {
+	case err == nil,
+		errors.Is(err, ErrQueueFull),
+		errors.Is(err, recipe.ErrQuotaExceeded),
+		errors.Is(err, recipe.ErrNotFoodImage),
+		errors.Is(err, recipe.ErrContentBlocked),
+		errors.Is(err, recipe.ErrResponseTruncated),
+		errors.Is(err, recipe.ErrInvalidRecipe),
+		errors.As(err, &moderationErr):
+		return false
+	default:
+		return true
+	}
+}
+
+// wrap returns client with every call going through the breaker. A nil
+// breaker returns client unchanged.
+func (b *CircuitBreaker) wrap(client RecipeClient) RecipeClient {
+	if b == nil || client == nil {
+		return client
+	}
+	return &breakerClient{RecipeClient: client, breaker: b}
+}
+
+// breakerClient is a RecipeClient whose calls go through a CircuitBreaker.
+type breakerClient struct {
+	RecipeClient
+	breaker *CircuitBreaker
+}
+
+func (c *breakerClient) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return false, "", err
+	}
+	isFood, description, err := c.RecipeClient.IsFoodImage(ctx, imageData)
+	c.breaker.record(err)
+	return isFood, description, err
+}
+
+func (c *breakerClient) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	r, err := c.RecipeClient.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
+	c.breaker.record(err)
+	return r, err
+}
+
+func (c *breakerClient) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	r, err := c.RecipeClient.GenerateRecipeFromImages(ctx, images, dietaryPreference, cuisine)
+	c.breaker.record(err)
+	return r, err
+}
+
+func (c *breakerClient) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	cart, err := c.RecipeClient.GenerateShoppingCart(ctx, imageData)
+	c.breaker.record(err)
+	return cart, err
+}
+
+func (c *breakerClient) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	ingredients, err := c.RecipeClient.ExtractIngredients(ctx, imageData)
+	c.breaker.record(err)
+	return ingredients, err
+}
+
+func (c *breakerClient) RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	cart, err := c.RecipeClient.RegenerateShoppingCart(ctx, ingredients)
+	c.breaker.record(err)
+	return cart, err
+}
+
+func (c *breakerClient) SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	pairings, err := c.RecipeClient.SuggestPairings(ctx, r)
+	c.breaker.record(err)
+	return pairings, err
+}
+
+func (c *breakerClient) DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return "", err
+	}
+	text, err := c.RecipeClient.DescribeImage(ctx, imageData, prompt)
+	c.breaker.record(err)
+	return text, err
+}
+
+func (c *breakerClient) ModerateImage(ctx context.Context, imageData []byte) error {
+	if err := c.breaker.allow(); err != nil {
+		return err
+	}
+	err := c.RecipeClient.ModerateImage(ctx, imageData)
+	c.breaker.record(err)
+	return err
+}
+
+func (c *breakerClient) Warmup(ctx context.Context) error {
+	if err := c.breaker.allow(); err != nil {
+		return err
+	}
+	err := c.RecipeClient.Warmup(ctx)
+	c.breaker.record(err)
+	return err
+}
+
+func (c *breakerClient) Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error) {
+	if err := c.breaker.allow(); err != nil {
+		return "", err
+	}
+	reply, err := c.RecipeClient.Chat(ctx, messages, onChunk)
+	c.breaker.record(err)
+	return reply, err
+}
+
+// writeCircuitOpenError responds with 503 and a Retry-After header if err
+// is ErrCircuitOpen, and reports whether it did.
+func (h *Handler) writeCircuitOpenError(c *gin.Context, engine string, err error) bool {
+	if !errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	seconds := 1
+	if b := h.CircuitBreakers[engine]; b != nil {
+		seconds = max(int(math.Ceil(b.retryAfter().Seconds())), 1)
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	setErrorClass(c, errorLLM)
+	c.String(http.StatusServiceUnavailable, fmt.Sprintf("%s is unavailable. Please try again in %d seconds.", engine, seconds))
+	return true
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"snapchef/internal/recipe"
+)
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	b := NewCircuitBreaker(1, 10*time.Millisecond)
+	failure := errors.New("connection refused")
+
+	assert.NoError(t, b.allow())
+	b.record(failure)
+	assert.Equal(t, breakerOpen, b.State())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// Only one call tests the engine
+	time.Sleep(15 * time.Millisecond)
+	assert.NoError(t, b.allow())
+	assert.Equal(t, breakerHalfOpen, b.State())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// A failed test opens the breaker for another cooldown
+	b.record(failure)
+	assert.Equal(t, breakerOpen, b.State())
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// A canceled test says nothing, so the next call tests again
+	time.Sleep(15 * time.Millisecond)
+	assert.NoError(t, b.allow())
+	b.record(context.Canceled)
+	assert.NoError(t, b.allow())
+	b.record(nil)
+	assert.Equal(t, breakerClosed, b.State())
+	assert.Equal(t, int64(2), b.trips.Load())
+}
+
+func TestCircuitBreaker_AnsweredCalls(t *testing.T) {
+	b := NewCircuitBreaker(2, time.Minute)
+
+	// Answers the engine gave, however unwelcome, don't count as failures
+	for _, err := range []error{recipe.ErrNotFoodImage, recipe.ErrContentBlocked, &recipe.QuotaError{Err: errors.New("429")}, ErrQueueFull, nil} {
+		assert.NoError(t, b.allow())
+		b.record(err)
+	}
+	assert.Equal(t, breakerClosed, b.State())
+
+	// Failures must be in a row
+	b.record(context.DeadlineExceeded)
+	b.record(nil)
+	b.record(context.DeadlineExceeded)
+	assert.Equal(t, breakerClosed, b.State())
+	b.record(context.DeadlineExceeded)
+	assert.Equal(t, breakerOpen, b.State())
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"snapchef/internal/recipe"
+)
+
+// Chat session limits used unless configured otherwise.
+const (
+	DefaultMaxChatSessions     = 20
+	DefaultChatSessionLifetime = 15 * time.Minute
+)
+
+const (
+	// maxChatQuestions is how many questions one chat session may ask, which
+	// bounds the history sent with every question.
+	maxChatQuestions = 20
+	// maxChatMessageLength is the longest question accepted, in bytes.
+	maxChatMessageLength = 2000
+)
+
+// ChatSessions bounds the recipe chats: how many can be open at once, and
+// how long each may stay open.
+type ChatSessions struct {
+	slots    chan struct{}
+	lifetime time.Duration
+}
+
+// NewChatSessions allows up to max chats at once, each closed after lifetime.
+func NewChatSessions(max int, lifetime time.Duration) *ChatSessions {
+	return &ChatSessions{slots: make(chan struct{}, max), lifetime: lifetime}
+}
+
+// acquire takes a slot for a chat, and reports whether there was one free.
+// The slot must be given back with release.
+func (s *ChatSessions) acquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ChatSessions) release() {
+	<-s.slots
+}
+
+// chatRequest is a question sent by the client over the chat WebSocket.
+type chatRequest struct {
+	Message string `json:"message"`
+}
+
+// Chat event types sent to the client.
+const (
+	chatEventChunk = "chunk"
+	chatEventDone  = "done"
+	chatEventError = "error"
+)
+
+// chatEvent is a message sent to the client over the chat WebSocket: a piece
+// of the reply, the end of the reply, or an error.
+type chatEvent struct {
+	Type  string `json:"type"`
+	Text  string `json:"text,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Chat handles GET /recipes/:image_hash/chat, a WebSocket conversation with
+// an engine about a recipe. The client sends {"message": "..."} questions,
+// one at a time, and the reply is streamed back as "chunk" events followed by
+// a "done" event. The conversation is seeded with the recipe, and its history
+// is kept for the session only.
+func (h *Handler) Chat(c *gin.Context) {
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, c.Param("image_hash"))
+	cancel()
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	if !h.ChatSessions.acquire() {
+		c.String(http.StatusServiceUnavailable, "Too many chats are open. Please try again later.")
+		return
+	}
+	defer h.ChatSessions.release()
+
+	server := websocket.Server{
+		// Chats are public like the recipes, and use no cookies, so any origin may open one
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			h.chat(ws, engine, client, r)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// chat runs one chat session until the client leaves, the session's lifetime
+// is up, or it has asked maxChatQuestions questions.
+func (h *Handler) chat(ws *websocket.Conn, engine string, client RecipeClient, r *recipe.Recipe) {
+	defer ws.Close()
+
+	// The deadline ends the session even while waiting for the next question
+	expires := time.Now().Add(h.ChatSessions.lifetime)
+	ws.SetDeadline(expires)
+	ctx, cancel := context.WithDeadline(ws.Request().Context(), expires)
+	defer cancel()
+
+	history := []recipe.ChatMessage{{Role: recipe.ChatRoleSystem, Content: recipe.ChatSystemPrompt(r)}}
+	for questions := 0; questions < maxChatQuestions; questions++ {
+		var req chatRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		if req.Message == "" || len(req.Message) > maxChatMessageLength {
+			websocket.JSON.Send(ws, chatEvent{Type: chatEventError, Error: fmt.Sprintf("Messages must be between 1 and %d characters.", maxChatMessageLength)})
+			questions--
+			continue
+		}
+		history = append(history, recipe.ChatMessage{Role: recipe.ChatRoleUser, Content: req.Message})
+
+		replyCtx, cancelReply := context.WithTimeout(ctx, 45*time.Second)
+		reply, err := client.Chat(replyCtx, history, func(chunk string) {
+			websocket.JSON.Send(ws, chatEvent{Type: chatEventChunk, Text: chunk})
+		})
+		cancelReply()
+		if err != nil {
+			log.Printf("chat about %s with %s failed: %s", r.ImageHash, engine, err.Error())
+			websocket.JSON.Send(ws, chatEvent{Type: chatEventError, Error: fmt.Sprintf("%s couldn't answer. Please try again.", engine)})
+			// Drop the unanswered question so the history keeps alternating
+			history = history[:len(history)-1]
+			continue
+		}
+		history = append(history, recipe.ChatMessage{Role: recipe.ChatRoleAssistant, Content: reply})
+		if err := websocket.JSON.Send(ws, chatEvent{Type: chatEventDone}); err != nil {
+			return
+		}
+	}
+	websocket.JSON.Send(ws, chatEvent{Type: chatEventError, Error: "This chat has reached its question limit. Open a new one to keep asking."})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultDuplicateUploadWindow is how long a finished upload is answered
+// again for a duplicate of it, unless configured otherwise.
+const DefaultDuplicateUploadWindow = 5 * time.Second
+
+// UploadDedup guards against double submits: an upload of an image that
+// the same client is already uploading, or uploaded moments ago, gets the
+// response of the first upload instead of running the food check and the
+// rest of the pipeline again. It complements the recipe cache, which only
+// saves the generation.
+type UploadDedup struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*dedupedUpload
+}
+
+// dedupedUpload is an upload in progress, or its response once done is closed.
+type dedupedUpload struct {
+	done        chan struct{}
+	code        int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// NewUploadDedup answers duplicates of an upload while it runs and for
+// window after it finishes.
+func NewUploadDedup(window time.Duration) *UploadDedup {
+	return &UploadDedup{window: window, uploads: make(map[string]*dedupedUpload)}
+}
+
+// begin returns the upload for key, and whether the caller is the first to
+// ask for it and so must run it and call finish.
+func (d *UploadDedup) begin(key string) (*dedupedUpload, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, upload := range d.uploads {
+		if !upload.expires.IsZero() && now.After(upload.expires) {
+			delete(d.uploads, k)
+		}
+	}
+	if upload, ok := d.uploads[key]; ok {
+		return upload, false
+	}
+	upload := &dedupedUpload{done: make(chan struct{})}
+	d.uploads[key] = upload
+	return upload, true
+}
+
+// finish saves the response of an upload for its duplicates. Only
+// successful responses are kept once the duplicates waiting for them have
+// been answered, so a failed upload can be retried straight away.
+func (d *UploadDedup) finish(key string, upload *dedupedUpload, w *recordingWriter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	upload.code = w.Status()
+	upload.contentType = w.Header().Get("Content-Type")
+	upload.body = w.body.Bytes()
+	upload.expires = time.Now().Add(d.window)
+	if upload.code < 200 || upload.code > 299 {
+		delete(d.uploads, key)
+	}
+	close(upload.done)
+}
+
+// dedupUpload answers a duplicate upload: if the client is already
+// uploading the image with the same options, or just did, it responds with
+// that upload's response and returns true. Otherwise it returns false and a func that must be called
+// once the upload has been answered, to keep the response for duplicates. A
+// nil UploadDedup never finds a duplicate.
+func (h *Handler) dedupUpload(c *gin.Context, imageHash string, options ...string) (func(), bool) {
+	d := h.UploadDedup
+	if d == nil {
+		return func() {}, false
+	}
+
+	key := strings.Join(append([]string{c.ClientIP(), imageHash, c.Request.URL.RawQuery}, options...), "\x00")
+	upload, first := d.begin(key)
+	if first {
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		return func() {
+			c.Writer = w.ResponseWriter
+			d.finish(key, upload, w)
+		}, false
+	}
+
+	select {
+	case <-upload.done:
+	case <-c.Request.Context().Done():
+		c.String(http.StatusRequestTimeout, "request cancelled")
+		return nil, true
+	}
+	log.Printf("Answered duplicate upload %s from %s", imageHash, c.ClientIP())
+	c.Header("X-Duplicate-Upload", "true")
+	c.Data(upload.code, upload.contentType, upload.body)
+	return nil, true
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
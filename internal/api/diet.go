@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// CheckDiet handles GET /recipes/:image_hash/check-diet?diet=, checking
+// each ingredient of the recipe against the diet and returning the ones it
+// rules out. The diet defaults to the recipe's own dietary preference.
+func (h *Handler) CheckDiet(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	diet := strings.ToLower(recipe.NormalizeDietaryPreference(c.DefaultQuery("diet", r.DietaryPreference)))
+	violations, err := recipe.CheckDiet(r, diet)
+	if err != nil {
+		if errors.Is(err, recipe.ErrUnknownDiet) {
+			c.String(http.StatusBadRequest, fmt.Sprintf("unknown diet %q, expected one of %s", diet, strings.Join(recipe.Diets(), ", ")))
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, gin.H{
+		"diet":       diet,
+		"compliant":  len(violations) == 0,
+		"violations": violations,
+	})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// errorClass is the kind of failure behind an error response, for alerting.
+type errorClass int
+
+const (
+	// errorClient is a request the client got wrong, or an image that can't be used.
+	errorClient errorClass = iota
+	// errorLLM is an engine that failed, timed out or answered badly.
+	errorLLM
+	// errorDB is a failed database query.
+	errorDB
+	// errorStorage is a failure reading or writing image files.
+	errorStorage
+
+	numErrorClasses
+)
+
+func (e errorClass) String() string {
+	return [...]string{"client", "llm", "db", "storage"}[e]
+}
+
+// errorClassKey is the gin context key an error response's class is kept
+// under until CountErrors counts it.
+const errorClassKey = "snapchef.errorClass"
+
+// errDatabase and errStorage mark errors from the database and the image
+// files, so classifyError can tell them from engine errors.
+var (
+	errDatabase = errors.New("database error")
+	errStorage  = errors.New("storage error")
+)
+
+// dbError marks err as coming from the database.
+func dbError(err error) error {
+	return fmt.Errorf("%w: %w", errDatabase, err)
+}
+
+// storageError marks err as coming from the image files.
+func storageError(err error) error {
+	return fmt.Errorf("%w: %w", errStorage, err)
+}
+
+// classifyError returns the class of err and the status to respond with.
+// Errors not marked with dbError or storageError, and not one of the typed
+// client errors, are taken to be engine failures. Timeouts are a 408 whatever
+// timed out.
+func classifyError(err error) (errorClass, int) {
+	class, status := errorLLM, http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errDatabase):
+		class = errorDB
+	case errors.Is(err, errStorage):
+		class = errorStorage
+	case errors.Is(err, recipe.ErrNotFoodImage), errors.Is(err, ErrUnknownEngine):
+		class, status = errorClient, http.StatusBadRequest
+	case errors.Is(err, recipe.ErrImageFlagged), errors.Is(err, recipe.ErrContentBlocked):
+		class, status = errorClient, http.StatusUnprocessableEntity
+	case errors.Is(err, ErrEngineNotConfigured):
+		status = http.StatusNotImplemented
+	case errors.Is(err, recipe.ErrQuotaExceeded):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrQueueFull):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, recipe.ErrResponseTruncated), errors.Is(err, recipe.ErrInvalidRecipe):
+		status = http.StatusBadGateway
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusRequestTimeout
+	}
+	return class, status
+}
+
+// setErrorClass records the class of the error response being written.
+func setErrorClass(c *gin.Context, class errorClass) {
+	c.Set(errorClassKey, class)
+}
+
+// writeError responds with message, at the status classifyError gives err,
+// and records its class for the error metrics.
+func (h *Handler) writeError(c *gin.Context, err error, message string) {
+	class, status := classifyError(err)
+	setErrorClass(c, class)
+	c.String(status, message)
+}
+
+// CountErrors is middleware counting error responses by class, for
+// GET /metrics. Responses written by writeError, or the engine error writers,
+// carry their class; any other 4xx counts as a client error, and any other
+// 5xx as an engine one.
+func (h *Handler) CountErrors(c *gin.Context) {
+	c.Next()
+
+	status := c.Writer.Status()
+	if status < http.StatusBadRequest {
+		return
+	}
+	class := errorLLM
+	if status < http.StatusInternalServerError {
+		class = errorClient
+	}
+	if value, ok := c.Get(errorClassKey); ok {
+		class = value.(errorClass)
+	}
+	h.errorCounts[class].Add(1)
+}
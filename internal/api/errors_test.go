@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"snapchef/internal/recipe"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err    error
+		class  errorClass
+		status int
+	}{
+		{errors.New("connection reset"), errorLLM, http.StatusInternalServerError},
+		{fmt.Errorf("generate: %w", recipe.ErrInvalidRecipe), errorLLM, http.StatusBadGateway},
+		{ErrQueueFull, errorLLM, http.StatusServiceUnavailable},
+		{recipe.ErrNotFoodImage, errorClient, http.StatusBadRequest},
+		{recipe.ErrContentBlocked, errorClient, http.StatusUnprocessableEntity},
+		{dbError(errors.New("no connection")), errorDB, http.StatusInternalServerError},
+		{dbError(context.DeadlineExceeded), errorDB, http.StatusRequestTimeout},
+		{storageError(errors.New("disk full")), errorStorage, http.StatusInternalServerError},
+		{fmt.Errorf("gemini: %w", context.DeadlineExceeded), errorLLM, http.StatusRequestTimeout},
+	}
+	for _, tt := range tests {
+		class, status := classifyError(tt.err)
+		assert.Equal(t, tt.class, class, tt.err.Error())
+		assert.Equal(t, tt.status, status, tt.err.Error())
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// exportPageSize is how many recipes ExportAll loads from the database at a time.
+const exportPageSize = 100
+
+// ExportAll handles GET /admin/export-all, a backup of every recipe as a ZIP
+// archive: recipes/<image_hash>.json for each recipe, archived ones
+// included, and its images under the paths they are served from, such as
+// images/<image_hash>.png. The archive is written to the response as it is
+// built, a page of recipes at a time, so it never has to fit in memory.
+//
+// Once the first byte is sent the status can't change anymore, so a failure
+// halfway through is logged and leaves a truncated archive that won't open.
+func (h *Handler) ExportAll(c *gin.Context) {
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="snapchef-export-%s.zip"`, time.Now().UTC().Format("20060102")))
+
+	archive := zip.NewWriter(c.Writer)
+	exported, err := h.exportRecipes(c.Request.Context(), archive)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		log.Printf("export failed after %d recipes: %s", exported, err.Error())
+		return
+	}
+	log.Printf("Exported %d recipes", exported)
+}
+
+// exportRecipes writes every recipe and its images to the archive, and
+// returns how many recipes it wrote.
+func (h *Handler) exportRecipes(ctx context.Context, archive *zip.Writer) (int, error) {
+	exported := 0
+	for offset := 0; ; offset += exportPageSize {
+		pageCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		recipes, _, err := h.RecipeStore.GetRecipesPage(pageCtx, recipe.Filter{IncludeArchived: true}, exportPageSize, offset)
+		cancel()
+		if err != nil {
+			return exported, fmt.Errorf("failed to load recipes: %w", err)
+		}
+
+		for _, r := range recipes {
+			if err := h.exportRecipe(ctx, archive, r); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+		if len(recipes) < exportPageSize {
+			return exported, nil
+		}
+	}
+}
+
+// exportRecipe writes one recipe and its images to the archive.
+func (h *Handler) exportRecipe(ctx context.Context, archive *zip.Writer, r *recipe.Recipe) error {
+	w, err := archive.Create(path.Join("recipes", r.ImageHash+".json"))
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("failed to write recipe %s: %w", r.ImageHash, err)
+	}
+
+	if err := h.exportImage(ctx, archive, r.ImagePath, r.ImageHash); err != nil {
+		return err
+	}
+	for _, stepImage := range r.StepImages {
+		if err := h.exportImage(ctx, archive, stepImage, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportImage copies the image file at imagePath into the archive under the
+// same path. A missing file is taken from image_data when imageHash has a
+// copy there, and skipped otherwise.
+func (h *Handler) exportImage(ctx context.Context, archive *zip.Writer, imagePath, imageHash string) error {
+	name := filepath.ToSlash(filepath.Clean(imagePath))
+	if imagePath == "" || filepath.IsAbs(imagePath) || name == ".." || strings.HasPrefix(name, "../") {
+		return nil
+	}
+
+	f, err := os.Open(imagePath)
+	if os.IsNotExist(err) {
+		return h.exportStoredImage(ctx, archive, name, imageHash)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open image %s: %w", imagePath, err)
+	}
+	defer f.Close()
+
+	// Images are already compressed, so don't spend time deflating them
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to write image %s: %w", imagePath, err)
+	}
+	return nil
+}
+
+// exportStoredImage writes the image_data copy of imageHash to the archive as
+// name, if there is one.
+func (h *Handler) exportStoredImage(ctx context.Context, archive *zip.Writer, name, imageHash string) error {
+	if imageHash == "" {
+		return nil
+	}
+	encodedImage, err := h.RecipeStore.GetImageData(ctx, imageHash)
+	if err != nil {
+		return fmt.Errorf("failed to load image data %s: %w", imageHash, err)
+	}
+	if encodedImage == "" {
+		log.Printf("export: image %s is missing, skipping it", name)
+		return nil
+	}
+
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, strings.NewReader(encodedImage))); err != nil {
+		return fmt.Errorf("failed to write image data %s: %w", imageHash, err)
+	}
+	return nil
+}
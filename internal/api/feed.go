@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// feedSize is the number of recipes included in the RSS feed.
+const feedSize = 20
+
+// rss is the root element of an RSS 2.0 document.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel describes the feed itself.
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssItem is a single recipe in the feed.
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        string        `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+// rssEnclosure attaches the recipe image to an item.
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RecipesFeed handles requests for an RSS feed of the most recent recipes.
+func (h *Handler) RecipesFeed(c *gin.Context) {
+	cuisine := c.Query("cuisine")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	recipes, err := h.RecipeStore.GetRecentRecipes(ctx, cuisine, feedSize)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	baseURL := requestBaseURL(c)
+	feed := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Snapchef recipes",
+			Link:        baseURL + "/recipes",
+			Description: "The latest recipes generated by Snapchef",
+		},
+	}
+	if cuisine != "" {
+		feed.Channel.Title = fmt.Sprintf("Snapchef %s recipes", cuisine)
+	}
+
+	for _, r := range recipes {
+		link := baseURL + "/recipes/" + r.ImageHash
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       r.Title,
+			Link:        link,
+			GUID:        link,
+			PubDate:     r.CreatedAt.Format(time.RFC1123Z),
+			Description: feedDescription(r),
+			Enclosure:   feedEnclosure(baseURL, r.ImagePath),
+		})
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to encode feed: %s", err.Error()))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// requestBaseURL returns the scheme and host the request was made to.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// feedDescription summarises a recipe for its feed item.
+func feedDescription(r *recipe.Recipe) string {
+	var parts []string
+	if r.Cuisine != "" {
+		parts = append(parts, "Cuisine: "+r.Cuisine)
+	}
+	if r.CookingTime != "" {
+		parts = append(parts, "Cooking time: "+r.CookingTime)
+	}
+	if r.Servings != "" {
+		parts = append(parts, "Servings: "+r.Servings)
+	}
+	if len(r.Ingredients) > 0 {
+		ingredients := make([]string, 0, len(r.Ingredients))
+		for name := range r.Ingredients {
+			ingredients = append(ingredients, name)
+		}
+		parts = append(parts, "Ingredients: "+strings.Join(ingredients, ", "))
+	}
+	return strings.Join(parts, ". ")
+}
+
+// feedEnclosure builds the image enclosure for a recipe, or nil if it has no image.
+func feedEnclosure(baseURL, imagePath string) *rssEnclosure {
+	if imagePath == "" {
+		return nil
+	}
+
+	enclosure := &rssEnclosure{
+		URL:  baseURL + "/" + filepath.ToSlash(imagePath),
+		Type: mime.TypeByExtension(filepath.Ext(imagePath)),
+	}
+	if info, err := os.Stat(imagePath); err == nil {
+		enclosure.Length = info.Size()
+	}
+	return enclosure
+}
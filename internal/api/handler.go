@@ -1,7 +1,10 @@
 package api
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,41 +13,126 @@ import (
 	"image/png"
 	"io"
 	"log"
+	"maps"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/nfnt/resize"
 
-	"snapchef/internal/platform/gemini"
 	"snapchef/internal/recipe"
 )
 
-// GeminiClient defines the interface for interacting with the Gemini API.
-type GeminiClient interface {
+// RecipeClient is the behaviour shared by every recipe generation engine.
+//
+// Recipe generation doesn't run its own food check, since the handler has
+// already done so or skipped it on purpose. Engines still refuse images
+// without food with recipe.ErrNotFoodImage, as part of the same request.
+type RecipeClient interface {
 	IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error)
 	GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error)
+	GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error)
+	// GenerateShoppingCart generates only the shopping list for the dish in an image.
+	GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error)
+	// SuggestPairings suggests drinks to go with a recipe, without an image.
+	SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error)
+	// ExtractIngredients lists the ingredients visible in an image, with estimated quantities.
+	ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error)
+	// RegenerateShoppingCart generates the shopping list for a recipe's ingredients, without an image.
+	RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error)
+	// DescribeImage returns the engine's raw answer to a free-form prompt about
+	// an image, such as recipe.DescribePrompt, for debugging.
+	DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error)
+	// ModerateImage returns a *recipe.ModerationError if the image is inappropriate.
+	ModerateImage(ctx context.Context, imageData []byte) error
+	// Warmup sends a tiny request so the engine loads its model before real traffic arrives.
+	Warmup(ctx context.Context) error
+	// Chat replies to the last of the messages, a conversation about a recipe
+	// seeded with a system message. The reply is passed to onChunk as it
+	// arrives, in one or more pieces, and returned whole.
+	Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error)
+}
+
+// GeminiClient defines the interface for interacting with the Gemini API.
+type GeminiClient interface {
+	RecipeClient
 }
 
 // LocalLLMClient defines the interface for interacting with the Local LLM API.
 type LocalLLMClient interface {
-	IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error)
-	GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error)
+	RecipeClient
+}
+
+// ClaudeClient defines the interface for interacting with the Anthropic Claude API.
+type ClaudeClient interface {
+	RecipeClient
+}
+
+// OpenAIClient defines the interface for interacting with the OpenAI API.
+type OpenAIClient interface {
+	RecipeClient
 }
 
+// Engine names accepted by the ?engine= query parameter.
+const (
+	EngineGemini = "gemini"
+	EngineLocal  = "local"
+	EngineClaude = "claude"
+	EngineOpenAI = "openai"
+)
+
+// maxImageSize is the largest image accepted by the upload endpoints.
+const maxImageSize = 10 << 20
+
+// maxImagesPerDish is the most images UploadMulti accepts for a single dish.
+const maxImagesPerDish = 5
+
+var (
+	// ErrUnknownEngine is returned when the requested engine does not exist.
+	ErrUnknownEngine = errors.New("unknown engine")
+	// ErrEngineNotConfigured is returned when the requested engine has no client configured.
+	ErrEngineNotConfigured = errors.New("engine not configured")
+)
+
 // RecipeStore defines the interface for recipe data operations.
 type RecipeStore interface {
 	GetRecipeByImageHash(ctx context.Context, imageHash string) (*recipe.Recipe, error)
 	SaveRecipe(ctx context.Context, recipe *recipe.Recipe) error
-	GetImageMetadata(ctx context.Context, imageHash string) (string, error)
-	SaveImageMetadata(ctx context.Context, imageHash, description string) error
-	GetRecipesByCuisineOrDietaryPreference(ctx context.Context, cuisine, dietaryPreference string) ([]*recipe.Recipe, error)
+	GetImageMetadata(ctx context.Context, imageHash string) (*recipe.ImageMetadata, error)
+	SaveImageMetadata(ctx context.Context, imageHash, description string, isFood bool) error
+	GetRecipes(ctx context.Context, filter recipe.Filter) ([]*recipe.Recipe, error)
+	GetRecipesPage(ctx context.Context, filter recipe.Filter, limit, offset int) ([]*recipe.Recipe, int, error)
+	StreamRecipes(ctx context.Context, filter recipe.Filter, fn func(*recipe.Recipe) error) error
 	SaveImageData(ctx context.Context, imageHash, imageData string) error
 	GetImageData(ctx context.Context, imageHash string) (string, error)
+	GetImageDataHashes(ctx context.Context) ([]string, error)
+	GetRecipesByHashes(ctx context.Context, imageHashes []string) (map[string]*recipe.Recipe, error)
+	GetRecentRecipes(ctx context.Context, cuisine string, limit int) ([]*recipe.Recipe, error)
+	DeleteRecipe(ctx context.Context, imageHash string) error
+	DeleteRecipes(ctx context.Context, cuisine, dietaryPreference string) ([]string, error)
+	DeleteStaleRecipes(ctx context.Context, before time.Time) ([]string, error)
+	MergeRecipes(ctx context.Context, keep, merge string) (string, error)
+	TouchRecipes(ctx context.Context, imageHashes []string) error
+	GetRecipesUsingIngredient(ctx context.Context, ingredient, excludeImageHash string) ([]*recipe.Recipe, error)
+	SaveReport(ctx context.Context, report *recipe.Report) (int, error)
+	GetReports(ctx context.Context) ([]*recipe.Report, error)
+	ArchiveRecipe(ctx context.Context, imageHash string) error
+	SetStepImages(ctx context.Context, imageHash string, stepImages []string) error
+	SetShoppingCart(ctx context.Context, imageHash string, shoppingCart map[string]string) error
+	GetPairings(ctx context.Context, imageHash string) ([]recipe.Pairing, error)
+	SetPairings(ctx context.Context, imageHash string, pairings []recipe.Pairing) error
+	SetPerceptualHash(ctx context.Context, imageHash, perceptualHash string) error
+	GetPerceptualHashes(ctx context.Context) (map[string]string, error)
+	GetStorageStats(ctx context.Context) (*recipe.StorageStats, error)
 }
 
 // Handler handles HTTP requests.
@@ -52,11 +140,341 @@ type Handler struct {
 	GeminiClient   GeminiClient
 	LocalLLMClient LocalLLMClient
 	RecipeStore    RecipeStore
+
+	// ClaudeClient and OpenAIClient are optional and only set when the
+	// corresponding API key is configured.
+	ClaudeClient ClaudeClient
+	OpenAIClient OpenAIClient
+
+	// DefaultEngine is the engine used when a request doesn't pick one with
+	// ?engine=, EngineGemini if empty.
+	DefaultEngine string
+
+	// StrictValidation regenerates a recipe once when PlausibilityWarnings
+	// finds its cooking time, difficulty and steps don't add up.
+	StrictValidation bool
+
+	// MinRecipeConfidence is the lowest confidence a generated recipe needs
+	// to be saved. Recipes below it are returned with a warning, but the
+	// next upload of the image generates a new one. Recipes whose engine
+	// gave no confidence are always saved. Zero saves every recipe.
+	MinRecipeConfidence float64
+
+	// RequireRealPhoto rejects food images that the food check reports as drawings,
+	// illustrations or AI-generated pictures.
+	RequireRealPhoto bool
+
+	// Watermark, when set, is drawn on saved recipe images.
+	Watermark *Watermark
+
+	// EnableModeration checks uploads for inappropriate content before generating recipes.
+	EnableModeration bool
+
+	// BlockedTerms rejects uploads whose cuisine or dietary preference contains
+	// one of the terms, ignoring case. With BlockDescriptions the food check's
+	// description of the image is checked too.
+	BlockedTerms      []string
+	BlockDescriptions bool
+
+	// LocalQueue, when set, bounds the requests waiting for the local engine.
+	// Requests that don't fit are answered with a 503.
+	LocalQueue *LLMQueue
+
+	// CircuitBreakers, by engine, fail calls to an engine straight away
+	// while it keeps failing. Engines without one are always called.
+	CircuitBreakers map[string]*CircuitBreaker
+
+	// DiscardOriginals stores new recipe images in image_data at the size
+	// they are served in rather than as uploaded, to save space. Originals
+	// can't be downloaded then.
+	DiscardOriginals bool
+
+	// PlaceholderImage is the path of an image served in place of recipe
+	// images that are missing, instead of a 404. Empty disables it.
+	PlaceholderImage string
+
+	// HashMode is how uploads are hashed to find their recipe, HashModeBytes
+	// if empty. Changing it means existing recipes are no longer found for
+	// new uploads of the same image.
+	HashMode string
+
+	// ImagePreprocessor, when set, scales images down before they are sent to an engine.
+	ImagePreprocessor *ImagePreprocessor
+
+	// ImageQuota, when set, is told about served images so it can evict the least recently used ones.
+	ImageQuota *ImageQuota
+
+	// AccessTracker, when set, is told about served recipes so their last access time is kept.
+	AccessTracker *AccessTracker
+
+	// MaxUploadBytes and MaxMultipartParts bound multipart requests, see
+	// LimitMultipart. Zero disables a limit.
+	MaxUploadBytes    int64
+	MaxMultipartParts int
+
+	// ChatSessions bounds the recipe chats open at once and how long they last.
+	ChatSessions *ChatSessions
+
+	// UploadDedup, when set, answers double submits of an upload with the
+	// first one's response.
+	UploadDedup *UploadDedup
+
+	// MaxUnfilteredResults is the most recipes GET /recipes lists without a
+	// filter or pagination parameters; more give a 400. Zero disables the cap.
+	MaxUnfilteredResults int
+
+	// ReportArchiveThreshold is the number of reports that archives a recipe. Zero disables archiving.
+	ReportArchiveThreshold int
+
+	// Styles maps the recipe styles an upload may ask for with ?style= to
+	// the sentence each adds to the recipe prompt.
+	Styles map[string]string
+
+	// SimilarityThreshold is the largest number of differing perceptual hash
+	// bits for which SearchImages counts two images as similar.
+	SimilarityThreshold int
+
+	// AllowedModels lists the models a request may pick with ?model=, for the
+	// Gemini and local engines. When empty, ?model= is rejected.
+	AllowedModels []string
+
+	// AdminToken authenticates admin requests. Admin features are disabled when it is empty.
+	AdminToken string
+
+	// PrettyJSON indents every JSON response, as if each request asked for ?pretty=true.
+	PrettyJSON bool
+
+	// errorCounts counts error responses by class, see CountErrors.
+	errorCounts [numErrorClasses]atomic.Int64
+	// multipartCleanupErrors counts multipart temp files that couldn't be removed.
+	multipartCleanupErrors atomic.Int64
 }
 
 // NewHandler creates a new Handler.
 func NewHandler(geminiClient GeminiClient, localLLMClient LocalLLMClient, recipeStore RecipeStore) *Handler {
-	return &Handler{GeminiClient: geminiClient, LocalLLMClient: localLLMClient, RecipeStore: recipeStore}
+	return &Handler{
+		GeminiClient:           geminiClient,
+		LocalLLMClient:         localLLMClient,
+		RecipeStore:            recipeStore,
+		ReportArchiveThreshold: defaultReportArchiveThreshold,
+		SimilarityThreshold:    defaultSimilarityThreshold,
+		MaxUnfilteredResults:   DefaultMaxUnfilteredResults,
+		Styles:                 recipe.DefaultStyles,
+		MaxUploadBytes:         DefaultMaxUploadBytes,
+		MaxMultipartParts:      DefaultMaxMultipartParts,
+		ChatSessions:           NewChatSessions(DefaultMaxChatSessions, DefaultChatSessionLifetime),
+	}
+}
+
+// isAdmin reports whether the request carries the admin token as a bearer token.
+func (h *Handler) isAdmin(c *gin.Context) bool {
+	if h.AdminToken == "" {
+		return false
+	}
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) == 1
+}
+
+// writeJSON responds with obj as JSON, indented for reading by eye if
+// h.PrettyJSON is set or the request asks for it with ?pretty=true.
+func (h *Handler) writeJSON(c *gin.Context, code int, obj any) {
+	if pretty, _ := strconv.ParseBool(c.Query("pretty")); pretty || h.PrettyJSON {
+		c.IndentedJSON(code, obj)
+		return
+	}
+	c.JSON(code, obj)
+}
+
+// RequireAdmin is middleware that rejects requests without the admin token.
+func (h *Handler) RequireAdmin(c *gin.Context) {
+	if !h.isAdmin(c) {
+		c.Abort()
+		h.writeJSON(c, http.StatusUnauthorized, gin.H{"error": "admin authentication required"})
+		return
+	}
+	c.Next()
+}
+
+// skipFoodCheck reports whether the request asked to skip the food check with
+// ?skip_food_check=true. Only admins may skip it; anyone else gets a 403 and
+// ok is false.
+func (h *Handler) skipFoodCheck(c *gin.Context) (skip bool, ok bool) {
+	if c.Query("skip_food_check") != "true" {
+		return false, true
+	}
+	if !h.isAdmin(c) {
+		c.String(http.StatusForbidden, "skip_food_check requires admin authentication")
+		return false, false
+	}
+	return true, true
+}
+
+// blockedTerm returns the first of h.BlockedTerms contained in any of the
+// values, ignoring case, or "" if none is.
+func (h *Handler) blockedTerm(values ...string) string {
+	for _, term := range h.BlockedTerms {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term == "" {
+			continue
+		}
+		for _, value := range values {
+			if strings.Contains(strings.ToLower(value), term) {
+				return term
+			}
+		}
+	}
+	return ""
+}
+
+// maxRequestedServings is the most servings an upload may ask for with ?servings=.
+const maxRequestedServings = 50
+
+// parseServings reads the optional ?servings= parameter, the number of
+// servings to generate the recipe for. It returns 0 if there is none.
+func parseServings(c *gin.Context) (int, error) {
+	value := c.Query("servings")
+	if value == "" {
+		return 0, nil
+	}
+	servings, err := strconv.Atoi(value)
+	if err != nil || servings < 1 || servings > maxRequestedServings {
+		return 0, fmt.Errorf("servings must be a whole number between 1 and %d", maxRequestedServings)
+	}
+	return servings, nil
+}
+
+// parseStyle reads a recipe style, from ?style= on uploads or the recipe
+// list filter, and returns its normalized name and prompt snippet. The style
+// must be one of h.Styles. It returns "" if there is none.
+func (h *Handler) parseStyle(value string) (string, string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", "", nil
+	}
+	style := recipe.NormalizeStyle(value)
+	snippet, ok := h.Styles[style]
+	if !ok {
+		styles := slices.Sorted(maps.Keys(h.Styles))
+		return "", "", fmt.Errorf("invalid style %q, expected one of %s", value, strings.Join(styles, ", "))
+	}
+	return style, snippet, nil
+}
+
+// parseModel returns the model asked for with ?model=, or "" to use the
+// engine's default. The model must be one of h.AllowedModels, and only the
+// Gemini and local engines can switch models.
+func (h *Handler) parseModel(c *gin.Context, engine string) (string, error) {
+	model := c.Query("model")
+	if model == "" {
+		return "", nil
+	}
+	if engine != EngineGemini && engine != EngineLocal {
+		return "", fmt.Errorf("the %s engine doesn't support choosing a model", engine)
+	}
+	if !slices.Contains(h.AllowedModels, model) {
+		return "", fmt.Errorf("unknown model %q", model)
+	}
+	return model, nil
+}
+
+// localClient returns the local engine's client, for the handlers that only
+// use the local engine.
+func (h *Handler) localClient() RecipeClient {
+	return h.ImagePreprocessor.wrap(h.CircuitBreakers[EngineLocal].wrap(h.LocalQueue.wrap(h.LocalLLMClient)))
+}
+
+// defaultEngine returns the engine used when a request doesn't name one.
+func (h *Handler) defaultEngine() string {
+	return cmp.Or(h.DefaultEngine, EngineGemini)
+}
+
+// CheckEngine returns an error wrapping ErrUnknownEngine or
+// ErrEngineNotConfigured if the named engine can't be used.
+func (h *Handler) CheckEngine(engine string) error {
+	_, err := h.engineClient(engine)
+	return err
+}
+
+// engineClient returns the client backing the named engine.
+func (h *Handler) engineClient(engine string) (RecipeClient, error) {
+	var client RecipeClient
+	switch engine {
+	case EngineGemini:
+		if h.GeminiClient == nil {
+			return nil, fmt.Errorf("%w: %s", ErrEngineNotConfigured, engine)
+		}
+		client = h.GeminiClient
+	case EngineLocal:
+		if h.LocalLLMClient == nil {
+			return nil, fmt.Errorf("%w: %s", ErrEngineNotConfigured, engine)
+		}
+		client = h.LocalQueue.wrap(h.LocalLLMClient)
+	case EngineClaude:
+		if h.ClaudeClient == nil {
+			return nil, fmt.Errorf("%w: %s", ErrEngineNotConfigured, engine)
+		}
+		client = h.ClaudeClient
+	case EngineOpenAI:
+		if h.OpenAIClient == nil {
+			return nil, fmt.Errorf("%w: %s", ErrEngineNotConfigured, engine)
+		}
+		client = h.OpenAIClient
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
+	}
+	return h.ImagePreprocessor.wrap(h.CircuitBreakers[engine].wrap(client)), nil
+}
+
+// defaultRetryAfter is the Retry-After sent with quota errors when the engine
+// didn't say how long to wait.
+const defaultRetryAfter = time.Minute
+
+// writeQuotaError responds with 429 and a Retry-After header if err is an
+// engine quota or rate limit error, and reports whether it did.
+func writeQuotaError(c *gin.Context, engine string, err error) bool {
+	if !errors.Is(err, recipe.ErrQuotaExceeded) {
+		return false
+	}
+
+	retryAfter := defaultRetryAfter
+	var quotaErr *recipe.QuotaError
+	if errors.As(err, &quotaErr) && quotaErr.RetryAfter > 0 {
+		retryAfter = quotaErr.RetryAfter
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	log.Printf("%s quota exceeded, asking the client to retry in %ds: %s", engine, seconds, err.Error())
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	setErrorClass(c, errorLLM)
+	c.String(http.StatusTooManyRequests, fmt.Sprintf("%s is over its request quota. Please try again in %d seconds.", engine, seconds))
+	return true
+}
+
+// writeEngineError responds to any of the engine errors that have their own
+// status: quota, a full local queue, an open circuit, or a blocked or cut-off
+// response. It reports whether it wrote a response.
+func (h *Handler) writeEngineError(c *gin.Context, engine string, err error) bool {
+	return writeQuotaError(c, engine, err) || h.writeQueueFullError(c, engine, err) || h.writeCircuitOpenError(c, engine, err) || writeResponseError(c, engine, err)
+}
+
+// writeResponseError responds to an engine response that was blocked or cut
+// off, and reports whether err was one. Blocked content is a 422, since
+// retrying the same image won't help, and a truncated response a 502 that may
+// well succeed on a retry.
+func writeResponseError(c *gin.Context, engine string, err error) bool {
+	switch {
+	case errors.Is(err, recipe.ErrContentBlocked):
+		log.Printf("%s blocked the request: %s", engine, err.Error())
+		setErrorClass(c, errorClient)
+		c.String(http.StatusUnprocessableEntity, "Pixel Chef says: We can't make a recipe from this image. Please try a different photo of your dish.")
+		return true
+	case errors.Is(err, recipe.ErrResponseTruncated):
+		log.Printf("%s response was truncated: %s", engine, err.Error())
+		setErrorClass(c, errorLLM)
+		c.String(http.StatusBadGateway, fmt.Sprintf("%s's response was cut off. Please try again.", engine))
+		return true
+	default:
+		return false
+	}
 }
 
 // Upload handles image uploads and generates recipes.
@@ -64,7 +482,7 @@ func (h *Handler) Upload(c *gin.Context) {
 	// Source
 	var file *multipart.FileHeader
 	var err error
-	file, err = c.FormFile("file")
+	file, err = formFile(c)
 	if err != nil {
 		log.Printf("Error getting form file: %v", err)
 		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
@@ -82,15 +500,36 @@ func (h *Handler) Upload(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
 		return
 	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
 
 	dietaryPreference := c.Query("dietary_preference")
 	cuisine := c.Query("cuisine")
 
+	// Pick the engine used for the food check and recipe generation
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	skipFoodCheck, ok := h.skipFoodCheck(c)
+	if !ok {
+		return
+	}
+
 	// Read the image file into memory
 	var src multipart.File
 	src, err = file.Open()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("open file err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("open file err: %s", err.Error()))
 		return
 	}
 	defer src.Close()
@@ -98,156 +537,764 @@ func (h *Handler) Upload(c *gin.Context) {
 	var imageData []byte
 	imageData, err = io.ReadAll(src)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("read image err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	h.generateRecipe(c, recipeRequest{
+		engine:            engine,
+		client:            client,
+		images:            [][]byte{imageData},
+		extension:         extension,
+		dietaryPreference: dietaryPreference,
+		cuisine:           cuisine,
+		skipFoodCheck:     skipFoodCheck,
+	})
+}
+
+// recipeRequest holds the inputs of the recipe pipeline for one upload.
+type recipeRequest struct {
+	engine string
+	client RecipeClient
+
+	// images are all images of the dish. The first one is checked for food
+	// and saved for display, and extension is its file extension.
+	images    [][]byte
+	extension string
+
+	dietaryPreference string
+	cuisine           string
+
+	// skipFoodCheck skips the up-front food check for trusted clients.
+	skipFoodCheck bool
+}
+
+// uploadResponse is the response to a successful upload: the recipe, with the
+// result of the food check and any implausible combinations in the recipe
+// alongside its fields.
+type uploadResponse struct {
+	*recipe.Recipe
+	IsFood      bool     `json:"is_food"`
+	Description string   `json:"description"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// Statuses of an upload rejected for what its image shows, in the status
+// field of rejectionResponse.
+const (
+	rejectedNotFood  = "not_food"
+	rejectedNotPhoto = "not_photo"
+)
+
+// rejectionMessages are the messages shown for each rejection status.
+var rejectionMessages = map[string]string{
+	rejectedNotFood:  "Pixel Chef says: It doesn't look like food. We're here to help you whip up amazing dishes from your ingredients. Just snap a pic of your culinary creations (or ingredients!) and let's get cooking!",
+	rejectedNotPhoto: "Pixel Chef says: That looks like a drawing rather than a photo. Snap a real pic of your dish (or ingredients!) and let's get cooking!",
+}
+
+// rejectionResponse is the response to an upload whose image can't be made
+// into a recipe, so clients can tell it from a recipe by the status code
+// and branch on Status.
+type rejectionResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Description is what the food check saw in the image, "" if it wasn't run.
+	Description string `json:"description"`
+}
+
+// writeRejection responds to an upload rejected with status, one of the
+// rejection statuses, with a 422.
+func (h *Handler) writeRejection(c *gin.Context, status, description string) {
+	h.writeJSON(c, http.StatusUnprocessableEntity, rejectionResponse{Status: status, Message: rejectionMessages[status], Description: description})
+}
+
+// generateRecipe runs the recipe pipeline for uploaded images of one dish and
+// writes the response: the food check (cached in image_metadata), the recipe
+// cache lookup, generation with the given engine, and saving the image and
+// recipe.
+func (h *Handler) generateRecipe(c *gin.Context, req recipeRequest) {
+	engine, client := req.engine, req.client
+	images, extension := req.images, req.extension
+	dietaryPreference, cuisine := recipe.NormalizeDietaryPreference(req.dietaryPreference), req.cuisine
+	imageData := images[0]
+
+	locale, err := parseLocale(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	model, err := h.parseModel(c, engine)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	servings, err := parseServings(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	notes, err := recipe.CleanNotes(c.DefaultQuery("notes", c.PostForm("notes")))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	style, styleSnippet, err := h.parseStyle(c.Query("style"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	language, err := recipe.ParseLanguage(c.Query("response_lang"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	exclusions, err := recipe.ParseExclusions(c.Query("exclude"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if term := h.blockedTerm(req.cuisine, req.dietaryPreference); term != "" {
+		log.Printf("Rejected upload from %s, request contains blocked term %q", c.ClientIP(), term)
+		c.String(http.StatusUnprocessableEntity, "Pixel Chef says: We can't make recipes for that request. Please try a different cuisine or dietary preference.")
+		return
+	}
+
+	// Calculate image hash, combining all images of the dish
+	imageHash := h.imageHash(images...)
+
+	finish, duplicate := h.dedupUpload(c, imageHash, engine, model, strconv.Itoa(servings), style, language, dietaryPreference, cuisine, notes)
+	if duplicate {
+		return
+	}
+	defer finish()
+
+	// Create a context with a 45-second timeout for external calls
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+	if model != "" {
+		ctx = recipe.WithModel(ctx, model)
+	}
+	if servings > 0 {
+		ctx = recipe.WithServings(ctx, servings)
+	}
+	if notes != "" {
+		ctx = recipe.WithNotes(ctx, notes)
+	}
+	if styleSnippet != "" {
+		ctx = recipe.WithStyle(ctx, styleSnippet)
+	}
+	if language != "" {
+		ctx = recipe.WithLanguage(ctx, language)
+	}
+	if len(exclusions) > 0 {
+		ctx = recipe.WithExclusions(ctx, exclusions)
+	}
+
+	// Reject inappropriate images before anything about them is saved
+	if h.EnableModeration {
+		for _, image := range images {
+			err := client.ModerateImage(ctx, image)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, recipe.ErrImageFlagged) {
+				log.Printf("Rejected upload %s from %s, flagged by %s moderation: %s", imageHash, c.ClientIP(), engine, err.Error())
+				c.String(http.StatusUnprocessableEntity, "Pixel Chef says: This image can't be used. Please upload a photo of your dish (or ingredients!).")
+				return
+			}
+			if h.writeEngineError(c, engine, err) {
+				return
+			}
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s moderation failed: %s", engine, err.Error()))
+			return
+		}
+	}
+
+	// --- Image Validation and Metadata Handling ---
+	metadata, err := h.RecipeStore.GetImageMetadata(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	var isFood bool
+	var description string
+
+	if req.skipFoodCheck {
+		// Trusted client, rely on the engine's own not-food fallback during generation
+		log.Printf("Skipping food check for trusted upload, image hash: %s", imageHash)
+		isFood = true
+	} else if metadata == nil {
+		// No metadata found, ask the engine to determine if it's food
+		log.Printf("Image metadata not found in database, calling %s API for image hash: %s", engine, imageHash)
+		isFood, description, err = client.IsFoodImage(ctx, imageData)
+		if err != nil {
+			if h.writeEngineError(c, engine, err) {
+				return
+			}
+			h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+			return
+		}
+
+		// Save the new metadata to the database
+		saveErr := h.RecipeStore.SaveImageMetadata(ctx, imageHash, description, isFood)
+		if saveErr != nil {
+			log.Printf("failed to save image metadata: %s", saveErr.Error())
+		}
+	} else {
+		// Metadata found, use it to determine if it's food
+		log.Printf("Image metadata found in database for image hash: %s", imageHash)
+		isFood = metadata.IsFood
+		description = metadata.Description // Use existing description
+	}
+
+	// If not food, save to non_food_images and return
+	if !isFood {
+		log.Printf("Image is not food, saving to non_food_images: %s", imageHash)
+		savePath, saveErr := saveNonFoodImage(imageData, imageHash, extension)
+		if saveErr != nil {
+			log.Printf("failed to save non-food image %s: %s", savePath, saveErr.Error())
+		}
+		h.writeRejection(c, rejectedNotFood, description)
+		return
+	}
+
+	// Illustrations and AI art produce nonsensical recipes, reject them like non-food images
+	if h.RequireRealPhoto && !req.skipFoodCheck && !recipe.IsPhoto(description) {
+		log.Printf("Image is not a real photo, saving to non_food_images: %s", imageHash)
+		savePath, saveErr := saveNonFoodImage(imageData, imageHash, extension)
+		if saveErr != nil {
+			log.Printf("failed to save non-food image %s: %s", savePath, saveErr.Error())
+		}
+		h.writeRejection(c, rejectedNotPhoto, description)
+		return
+	}
+
+	if h.BlockDescriptions {
+		if term := h.blockedTerm(description); term != "" {
+			log.Printf("Rejected upload %s from %s, description contains blocked term %q", imageHash, c.ClientIP(), term)
+			c.String(http.StatusUnprocessableEntity, "Pixel Chef says: We can't make recipes for this image. Please try a different dish.")
+			return
+		}
+	}
+
+	// --- If it is food, proceed with recipe generation and saving ---
+
+	// Try to get recipe from store first (only for food images)
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 2 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	if r != nil {
+		mismatch := recipeMismatch(r, c.Query("engine") != "", engine, model, servings, style, language)
+		if mismatch == "" {
+			log.Printf("Recipe found in database for image hash: %s", imageHash)
+			h.AccessTracker.Touch(r.ImageHash)
+			// Recipe found in database, return it
+			h.writeJSON(c, http.StatusOK, uploadResponse{Recipe: localizeRecipe(r, locale), IsFood: isFood, Description: description, Warnings: uploadWarnings(r, exclusions)})
+			return
+		}
+		log.Printf("Recipe found in database for image hash %s was made with a different %s, generating it again", imageHash, mismatch)
+	}
+
+	// Recipe not found in database, generate with the selected engine
+	log.Printf("Recipe not found in database, generating with %s for image hash: %s, dietaryPreference: %s, cuisine: %s", engine, imageHash, dietaryPreference, cuisine)
+	generate := func() (*recipe.Recipe, error) {
+		if len(images) > 1 {
+			return client.GenerateRecipeFromImages(ctx, images, dietaryPreference, cuisine)
+		}
+		return client.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
+	}
+	r, err = generate()
+	if err == nil && h.StrictValidation {
+		if warnings := recipe.PlausibilityWarnings(r); len(warnings) > 0 {
+			// One more try; if it fails, the first recipe is kept with its warnings
+			log.Printf("Regenerating implausible recipe for image hash %s: %s", imageHash, strings.Join(warnings, "; "))
+			if retry, retryErr := generate(); retryErr != nil {
+				log.Printf("failed to regenerate recipe for image hash %s: %s", imageHash, retryErr.Error())
+			} else {
+				r = retry
+			}
+		}
+	}
+	if err == nil {
+		if used := recipe.ExcludedIngredients(r, exclusions); len(used) > 0 {
+			// One more try; if it fails too, the recipe is saved as it is
+			log.Printf("Regenerating recipe for image hash %s, it uses excluded ingredients: %s", imageHash, strings.Join(used, ", "))
+			if retry, retryErr := generate(); retryErr != nil {
+				log.Printf("failed to regenerate recipe for image hash %s: %s", imageHash, retryErr.Error())
+			} else {
+				r = retry
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		// This error case should ideally be caught by IsFoodImage, but as a fallback
+		if errors.Is(err, recipe.ErrNotFoodImage) {
+			h.writeRejection(c, rejectedNotFood, description)
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned an incomplete recipe (%s). Please try again.", engine, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	r.ImageHash = imageHash
+	r.Engine = engine
+	r.RequestedServings = servings
+	r.Style = style
+	r.Language = language
+	r.Exclusions = exclusions
+	if r.Servings == "" && servings > 0 {
+		r.Servings = strconv.Itoa(servings)
+	}
+	// Checked before anything is written, so an unsaved recipe leaves no image behind
+	if h.MinRecipeConfidence > 0 && r.Confidence != nil && *r.Confidence < h.MinRecipeConfidence {
+		log.Printf("Not saving recipe for image hash %s, %s's confidence %.2f is below %.2f", imageHash, engine, *r.Confidence, h.MinRecipeConfidence)
+		warnings := append(uploadWarnings(r, exclusions), fmt.Sprintf("the engine isn't confident in this recipe (%.2f), so it wasn't saved; uploading the image again generates a new one", *r.Confidence))
+		h.writeJSON(c, http.StatusOK, uploadResponse{Recipe: localizeRecipe(r, locale), IsFood: isFood, Description: description, Warnings: warnings})
+		return
+	}
+
+	// image_data holds the one stored copy of the image. The file under
+	// images is only a cache of it, written by ServeImage the first time the
+	// image is requested and evicted by the image quota, so uploads aren't
+	// stored twice. Without originals a copy at the saved size, but without
+	// the watermark, does the same job.
+	storedData := imageData
+	if h.DiscardOriginals {
+		if storedData, err = resizedImageData(imageData, extension); err != nil {
+			log.Printf("failed to resize image data %s: %s", imageHash, err.Error())
+			storedData = imageData
+		}
+	}
+	if err := h.RecipeStore.SaveImageData(ctx, imageHash, base64.StdEncoding.EncodeToString(storedData)); err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to save image: %s", err.Error()))
+		return
+	}
+	r.ImagePath = recipeImagePath(imageHash, extension)
+
+	// Save the new recipe to the database
+	err = h.RecipeStore.SaveRecipe(ctx, r)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database save timed out after 2 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to save recipe: %s", err.Error()))
+		return
+	}
+	if hash := perceptualHash(imageData); hash != "" {
+		if err := h.RecipeStore.SetPerceptualHash(ctx, imageHash, hash); err != nil {
+			log.Printf("failed to save perceptual hash %s: %s", imageHash, err.Error())
+		}
+	}
+
+	h.writeJSON(c, http.StatusOK, uploadResponse{Recipe: localizeRecipe(r, locale), IsFood: isFood, Description: description, Warnings: uploadWarnings(r, exclusions)})
+}
+
+// recipeMismatch returns the first option an upload asked for that the saved
+// recipe r wasn't generated with, or "" if r can be served as it is. Options
+// the upload leaves out match any recipe; the engine only counts if
+// engineChosen.
+func recipeMismatch(r *recipe.Recipe, engineChosen bool, engine, model string, servings int, style, language string) string {
+	switch {
+	case engineChosen && engine != r.Engine:
+		return "engine"
+	case model != "" && model != r.Model:
+		return "model"
+	case servings > 0 && servings != r.RequestedServings:
+		return "servings"
+	case style != "" && style != r.Style:
+		return "style"
+	case language != "" && language != r.Language:
+		return "response_lang"
+	}
+	return ""
+}
+
+// uploadWarnings returns the warnings for the recipe of an upload: its
+// plausibility warnings, and the excluded ingredients it uses anyway, which
+// happens when the engine ignored them twice or the recipe was saved before.
+func uploadWarnings(r *recipe.Recipe, exclusions []string) []string {
+	warnings := recipe.PlausibilityWarnings(r)
+	if used := recipe.ExcludedIngredients(r, exclusions); len(used) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the recipe uses excluded ingredients: %s", strings.Join(used, ", ")))
+	}
+	return warnings
+}
+
+// UploadMulti handles uploads of several images of the same dish, sent as
+// repeated "file" fields, and generates a single recipe from all of them.
+func (h *Handler) UploadMulti(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 || len(files) > maxImagesPerDish {
+		c.String(http.StatusBadRequest, fmt.Sprintf("Upload between 1 and %d images of the same dish.", maxImagesPerDish))
+		return
+	}
+
+	// Validate file extensions
+	allowedExtensions := map[string]bool{
+		".jpeg": true,
+		".jpg":  true,
+		".png":  true,
+	}
+	images := make([][]byte, 0, len(files))
+	for _, file := range files {
+		extension := strings.ToLower(filepath.Ext(file.Filename))
+		if !allowedExtensions[extension] {
+			c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
+			return
+		}
+		if file.Size > maxImageSize {
+			c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+			return
+		}
+
+		imageData, err := readFormFile(file)
+		if err != nil {
+			h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+			return
+		}
+		images = append(images, imageData)
+	}
+
+	dietaryPreference := c.Query("dietary_preference")
+	cuisine := c.Query("cuisine")
+
+	// Pick the engine used for the food check and recipe generation
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	skipFoodCheck, ok := h.skipFoodCheck(c)
+	if !ok {
+		return
+	}
+
+	h.generateRecipe(c, recipeRequest{
+		engine:            engine,
+		client:            client,
+		images:            images,
+		extension:         strings.ToLower(filepath.Ext(files[0].Filename)),
+		dietaryPreference: dietaryPreference,
+		cuisine:           cuisine,
+		skipFoodCheck:     skipFoodCheck,
+	})
+}
+
+// formFile returns the uploaded file of a request with a single "file"
+// field. c.FormFile would quietly take the first of several, so a client
+// could get a recipe for another image than the one it meant; several are
+// rejected instead.
+func formFile(c *gin.Context) (*multipart.FileHeader, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File["file"]
+	switch len(files) {
+	case 0:
+		return nil, http.ErrMissingFile
+	case 1:
+		return files[0], nil
+	default:
+		return nil, fmt.Errorf("upload exactly one file, got %d", len(files))
+	}
+}
+
+// readFormFile reads an uploaded file into memory.
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return io.ReadAll(src)
+}
+
+// base64UploadRequest is the JSON body accepted by UploadBase64.
+type base64UploadRequest struct {
+	Image             string `json:"image" binding:"required"`
+	Cuisine           string `json:"cuisine"`
+	DietaryPreference string `json:"dietary_preference"`
+}
+
+// UploadBase64 handles base64-encoded image uploads sent as JSON and generates recipes.
+func (h *Handler) UploadBase64(c *gin.Context) {
+	// Leave room for the base64 overhead and the other JSON fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(base64.StdEncoding.EncodedLen(maxImageSize))+4096)
+
+	var req base64UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+			return
+		}
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
 		return
 	}
 
-	// Calculate image hash
-	imageHash := gemini.GenerateImageHash(imageData)
-
-	// Create a context with a 45-second timeout for external calls
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
-	defer cancel()
+	// Accept data URLs as well as bare base64
+	encodedImage := req.Image
+	if i := strings.Index(encodedImage, ";base64,"); strings.HasPrefix(encodedImage, "data:") && i != -1 {
+		encodedImage = encodedImage[i+len(";base64,"):]
+	}
 
-	// --- Image Validation and Metadata Handling ---
-	imageDescription, err := h.RecipeStore.GetImageMetadata(ctx, imageHash)
+	imageData, err := base64.StdEncoding.DecodeString(encodedImage)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid base64 image: %s", err.Error()))
+		return
+	}
+	if len(imageData) > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
 		return
 	}
 
-	var isFood bool
-	var geminiDescription string
+	// Validate the decoded bytes are a JPEG or PNG image
+	_, format, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid image. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+	var extension string
+	switch format {
+	case "jpeg":
+		extension = ".jpg"
+	case "png":
+		extension = ".png"
+	default:
+		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
 
-	if imageDescription == "" {
-		// No metadata found, call Gemini API to determine if it's food
-		log.Printf("Image metadata not found in database, calling Gemini API for image hash: %s", imageHash)
-		isFood, geminiDescription, err = h.GeminiClient.IsFoodImage(ctx, imageData)
-		if err != nil {
-			c.String(http.StatusInternalServerError, fmt.Sprintf("gemini err: %s", err.Error()))
+	// Pick the engine used for the food check and recipe generation
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
 			return
 		}
-
-		// Save the new metadata to the database
-		saveErr := h.RecipeStore.SaveImageMetadata(ctx, imageHash, geminiDescription)
-		if saveErr != nil {
-			log.Printf("failed to save image metadata: %s", saveErr.Error())
-		}
-	} else {
-		// Metadata found, use it to determine if it's food
-		log.Printf("Image metadata found in database for image hash: %s", imageHash)
-		isFood = !strings.HasPrefix(strings.ToLower(strings.TrimSpace(imageDescription)), "no")
-		geminiDescription = imageDescription // Use existing description
+		c.String(http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// If not food, save to non_food_images and return
-	if !isFood {
-		log.Printf("Image is not food, saving to non_food_images: %s", imageHash)
-		savePath, saveErr := saveNonFoodImage(imageData, imageHash, extension)
-		if saveErr != nil {
-			log.Printf("failed to save non-food image %s: %s", savePath, saveErr.Error())
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "Pixel Chef says: It doesn't look like food. We're here to help you whip up amazing dishes from your ingredients. Just snap a pic of your culinary creations (or ingredients!) and let's get cooking!"})
+	skipFoodCheck, ok := h.skipFoodCheck(c)
+	if !ok {
 		return
 	}
 
-	// --- If it is food, proceed with recipe generation and saving ---
+	h.generateRecipe(c, recipeRequest{
+		engine:            engine,
+		client:            client,
+		images:            [][]byte{imageData},
+		extension:         extension,
+		dietaryPreference: req.DietaryPreference,
+		cuisine:           req.Cuisine,
+		skipFoodCheck:     skipFoodCheck,
+	})
+}
 
-	// Try to get recipe from store first (only for food images)
-	recipe, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+// recipesPage is the response of GET /recipes.
+type recipesPage struct {
+	Recipes    []*recipe.Recipe `json:"recipes"`
+	TotalCount int              `json:"total_count"`
+	// HasMore is whether there are recipes after this page.
+	HasMore bool `json:"has_more"`
+}
+
+// GetRecipes handles requests to retrieve recipes based on cuisine or dietary preference.
+func (h *Handler) GetRecipes(c *gin.Context) {
+	filter, err := h.parseRecipeFilter(c)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database query timed out after 2 seconds")
-			return
-		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
+		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if recipe != nil {
-		log.Printf("Recipe found in database for image hash: %s", imageHash)
-		// Recipe found in database, return it
-		c.JSON(http.StatusOK, recipe)
+	page, paginated, err := parsePagination(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Recipe not found in database, generate with Gemini
-	log.Printf("Recipe not found in database, generating with Gemini for image hash: %s, dietaryPreference: %s, cuisine: %s", imageHash, dietaryPreference, cuisine)
-	recipe, err = h.GeminiClient.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
+	slice, sliced, err := parseOffsetPagination(c)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Gemini API call timed out after 45 seconds")
-			return
-		}
-		// This error case should ideally be caught by IsFoodImage, but as a fallback
-		if errors.Is(err, gemini.ErrNotFoodImage) {
-			c.String(http.StatusBadRequest, "Oops! That doesn't look like food. We're here to help you whip up amazing dishes from your ingredients. Just snap a pic of your culinary creations (or ingredients!) and let's get cooking!")
-			return
-		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("gemini err: %s", err.Error()))
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if paginated && sliced {
+		c.String(http.StatusBadRequest, "Paginate with either page and per_page or limit and offset, not both")
 		return
 	}
+	if paginated {
+		slice = offsetPagination{limit: page.perPage, offset: page.offset()}
+	}
 
-	// Save the image to the 'images' directory
-	imagePath, err := saveImage(imageData, imageHash, extension)
+	locale, err := parseLocale(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to save image: %s", err.Error()))
+		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
-	recipe.ImagePath = imagePath
-
 
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
 
-	// Save the new recipe to the database
-	recipe.ImageHash = imageHash
-	err = h.RecipeStore.SaveRecipe(ctx, recipe)
+	recipes, total, err := h.RecipeStore.GetRecipesPage(ctx, filter, slice.limit, slice.offset)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database save timed out after 2 seconds")
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
 			return
 		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to save recipe: %s", err.Error()))
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if !paginated && !sliced && filter.IsEmpty() && h.MaxUnfilteredResults > 0 && total > h.MaxUnfilteredResults {
+		c.String(http.StatusBadRequest, fmt.Sprintf("There are %d recipes, more than the %d listed without a filter. Filter the list, or paginate it with limit and offset or page and per_page.", total, h.MaxUnfilteredResults))
 		return
 	}
 
-	c.JSON(http.StatusOK, recipe)
+	if locale != nil {
+		for i, r := range recipes {
+			recipes[i] = r.Localized(*locale)
+		}
+	}
+
+	if paginated {
+		setPaginationHeaders(c, page, total)
+	}
+	if recipes == nil {
+		recipes = []*recipe.Recipe{}
+	}
+	h.writeJSON(c, http.StatusOK, recipesPage{
+		Recipes:    recipes,
+		TotalCount: total,
+		HasMore:    slice.offset+len(recipes) < total,
+	})
 }
 
-// GetRecipes handles requests to retrieve recipes based on cuisine or dietary preference.
-func (h *Handler) GetRecipes(c *gin.Context) {
-	cuisine := c.Query("cuisine")
-	dietaryPreference := c.Query("dietary_preference")
+// parseDate parses a date query parameter, either RFC3339 or YYYY-MM-DD. A
+// bare date is the start of that day in UTC, or its last instant if
+// endOfDay is set, so a to date includes the whole day. Empty values give the
+// zero time.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp or a YYYY-MM-DD date", value)
+	}
+	if endOfDay {
+		// Postgres timestamps have microsecond precision
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t, nil
+}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
+// parseRecipeFilter reads the recipe list filters from the query string:
+// cuisine, dietary_preference, meal_type, style, max_cooking_time (minutes),
+// from and to (created_at) and sort.
+func (h *Handler) parseRecipeFilter(c *gin.Context) (recipe.Filter, error) {
+	filter := recipe.Filter{
+		Cuisine:           c.Query("cuisine"),
+		DietaryPreference: recipe.NormalizeDietaryPreference(c.Query("dietary_preference")),
+		Sort:              c.Query("sort"),
+	}
 
-	recipes, err := h.RecipeStore.GetRecipesByCuisineOrDietaryPreference(ctx, cuisine, dietaryPreference)
+	if mealType := c.Query("meal_type"); mealType != "" {
+		if !recipe.IsMealType(mealType) {
+			return recipe.Filter{}, fmt.Errorf("invalid meal_type %q, expected one of %s", mealType, strings.Join(recipe.MealTypes, ", "))
+		}
+		filter.MealType = recipe.NormalizeMealType(mealType)
+	}
+	style, _, err := h.parseStyle(c.Query("style"))
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database query timed out after 5 seconds")
-			return
+		return recipe.Filter{}, err
+	}
+	filter.Style = style
+
+	if maxCookingTime := c.Query("max_cooking_time"); maxCookingTime != "" {
+		minutes, err := strconv.Atoi(maxCookingTime)
+		if err != nil || minutes < 1 {
+			return recipe.Filter{}, fmt.Errorf("max_cooking_time must be a positive number of minutes")
 		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
-		return
+		filter.MaxCookingTime = minutes
 	}
 
-	c.JSON(http.StatusOK, recipes)
+	if filter.CreatedFrom, err = parseDate(c.Query("from"), false); err != nil {
+		return recipe.Filter{}, fmt.Errorf("invalid from date: %s", err.Error())
+	}
+	if filter.CreatedTo, err = parseDate(c.Query("to"), true); err != nil {
+		return recipe.Filter{}, fmt.Errorf("invalid to date: %s", err.Error())
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && filter.CreatedFrom.After(filter.CreatedTo) {
+		return recipe.Filter{}, fmt.Errorf("from must not be after to")
+	}
+
+	switch filter.Sort {
+	case "", recipe.SortCookingTime:
+	default:
+		return recipe.Filter{}, fmt.Errorf("invalid sort %q, the only supported sort is %q", filter.Sort, recipe.SortCookingTime)
+	}
+
+	return filter, nil
 }
 
 // GetRecipe handles requests to retrieve a single recipe by image hash.
 func (h *Handler) GetRecipe(c *gin.Context) {
 	imageHash := c.Param("image_hash")
 
+	locale, err := parseLocale(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	recipe, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database query timed out after 5 seconds")
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
 			return
 		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
 		return
 	}
 
@@ -255,8 +1302,86 @@ func (h *Handler) GetRecipe(c *gin.Context) {
 		c.String(http.StatusNotFound, "Recipe not found")
 		return
 	}
+	h.AccessTracker.Touch(recipe.ImageHash)
+
+	recipe = localizeRecipe(recipe, locale)
+	if wantsYAML(c) {
+		c.YAML(http.StatusOK, recipe)
+		return
+	}
+	h.writeJSON(c, http.StatusOK, recipe)
+}
+
+// parseLocale reads the optional ?locale= parameter, e.g. "de-DE", used to
+// format ingredient quantities. It returns nil if there is none.
+func parseLocale(c *gin.Context) (*recipe.Locale, error) {
+	tag := c.Query("locale")
+	if tag == "" {
+		return nil, nil
+	}
+	locale, err := recipe.ParseLocale(tag)
+	if err != nil {
+		return nil, err
+	}
+	return &locale, nil
+}
+
+// localizeRecipe returns the recipe with its quantities formatted for the
+// locale, or the recipe itself if locale is nil.
+func localizeRecipe(r *recipe.Recipe, locale *recipe.Locale) *recipe.Recipe {
+	if locale == nil {
+		return r
+	}
+	return r.Localized(*locale)
+}
+
+// wantsYAML reports whether the client asked for YAML with ?format=yaml or an
+// Accept header that prefers YAML over JSON.
+func wantsYAML(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return format == "yaml"
+	}
+	switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEYAML2, binding.MIMEYAML) {
+	case binding.MIMEYAML2, binding.MIMEYAML:
+		return true
+	}
+	return false
+}
+
+// RecipesAlsoUsing handles requests for the other recipes that use an
+// ingredient of a recipe, e.g. /recipes/:image_hash/also-using?ingredient=garlic.
+func (h *Handler) RecipesAlsoUsing(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+	ingredient := strings.TrimSpace(c.Query("ingredient"))
+	if ingredient == "" {
+		c.String(http.StatusBadRequest, "ingredient is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	anchor, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if anchor == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	recipes, err := h.RecipeStore.GetRecipesUsingIngredient(ctx, ingredient, anchor.ImageHash)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
 
-	c.JSON(http.StatusOK, recipe)
+	h.writeJSON(c, http.StatusOK, recipes)
 }
 
 // GetImageDescription handles requests to retrieve image metadata description.
@@ -266,24 +1391,24 @@ func (h *Handler) GetImageDescription(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	description, err := h.RecipeStore.GetImageMetadata(ctx, imageHash)
+	metadata, err := h.RecipeStore.GetImageMetadata(ctx, imageHash)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
 		return
 	}
 
-	if description == "" {
+	if metadata == nil {
 		c.String(http.StatusNotFound, "Description not found for this image hash")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"description": description})
+	h.writeJSON(c, http.StatusOK, metadata)
 }
 
 // UploadImage handles image uploads, converts to base64, and saves to the database.
 func (h *Handler) UploadImage(c *gin.Context) {
 	// Source
-	file, err := c.FormFile("file")
+	file, err := formFile(c)
 	if err != nil {
 		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
 		return
@@ -304,19 +1429,19 @@ func (h *Handler) UploadImage(c *gin.Context) {
 	// Read the image file into memory
 	src, err := file.Open()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("open file err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("open file err: %s", err.Error()))
 		return
 	}
 	defer src.Close()
 
 	imageData, err := io.ReadAll(src)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("read image err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
 		return
 	}
 
 	// Calculate image hash
-	imageHash := gemini.GenerateImageHash(imageData)
+	imageHash := h.imageHash(imageData)
 
 	// Encode image to base64
 	encodedImage := base64.StdEncoding.EncodeToString(imageData)
@@ -328,47 +1453,68 @@ func (h *Handler) UploadImage(c *gin.Context) {
 	// Save image data to the database
 	err = h.RecipeStore.SaveImageData(ctx, imageHash, encodedImage)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to save image data: %s", err.Error()))
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to save image data: %s", err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"image_hash": imageHash})
+	h.writeJSON(c, http.StatusOK, gin.H{"image_hash": imageHash})
 }
 
+// IsFood handles POST /is-food, running only the food check of the engine
+// picked with ?engine=, the local one by default. Running it once per engine
+// on the same image gives a second opinion on a suspected false negative.
 func (h *Handler) IsFood(c *gin.Context) {
-	file, err := c.FormFile("file")
+	file, err := formFile(c)
 	if err != nil {
 		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
 		return
 	}
 
+	engine := c.DefaultQuery("engine", EngineLocal)
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	src, err := file.Open()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("open file err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("open file err: %s", err.Error()))
 		return
 	}
 	defer src.Close()
 
 	imageData, err := io.ReadAll(src)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("read image err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
 	defer cancel()
 
-	isFood, description, err := h.LocalLLMClient.IsFoodImage(ctx, imageData)
+	isFood, description, err := client.IsFoodImage(ctx, imageData)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("local llm err: %s", err.Error()))
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"is_food": isFood, "description": description})
+	h.writeJSON(c, http.StatusOK, gin.H{"engine": engine, "is_food": isFood, "is_photo": recipe.IsPhoto(description), "description": description})
 }
 
 func (h *Handler) RecipeFinderLocal(c *gin.Context) {
-	file, err := c.FormFile("file")
+	file, err := formFile(c)
 	if err != nil {
 		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
 		return
@@ -376,37 +1522,56 @@ func (h *Handler) RecipeFinderLocal(c *gin.Context) {
 
 	dietaryPreference := c.Query("dietary_preference")
 	cuisine := c.Query("cuisine")
+	if term := h.blockedTerm(cuisine, dietaryPreference); term != "" {
+		c.String(http.StatusUnprocessableEntity, "Pixel Chef says: We can't make recipes for that request. Please try a different cuisine or dietary preference.")
+		return
+	}
 
 	src, err := file.Open()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("open file err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("open file err: %s", err.Error()))
 		return
 	}
 	defer src.Close()
 
 	imageData, err := io.ReadAll(src)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("read image err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
 	defer cancel()
 
-	recipe, err := h.LocalLLMClient.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
+	r, err := h.localClient().GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("local llm err: %s", err.Error()))
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, "local API call timed out after 45 seconds")
+			return
+		}
+		if h.writeEngineError(c, EngineLocal, err) {
+			return
+		}
+		if errors.Is(err, recipe.ErrNotFoodImage) {
+			c.String(http.StatusBadRequest, "Oops! That doesn't look like food. Snap a pic of a dish and we'll find its recipe.")
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned an incomplete recipe (%s). Please try again.", EngineLocal, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("local llm err: %s", err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, recipe)
+	h.writeJSON(c, http.StatusOK, r)
 }
 
 func (h *Handler) UploadV2(c *gin.Context) {
 	// Source
 	var file *multipart.FileHeader
 	var err error
-	file, err = c.FormFile("file")
+	file, err = formFile(c)
 	if err != nil {
 		log.Printf("Error getting form file: %v", err)
 		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
@@ -424,15 +1589,24 @@ func (h *Handler) UploadV2(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
 		return
 	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
 
 	dietaryPreference := c.Query("dietary_preference")
 	cuisine := c.Query("cuisine")
 
+	skipFoodCheck, ok := h.skipFoodCheck(c)
+	if !ok {
+		return
+	}
+
 	// Read the image file into memory
 	var src multipart.File
 	src, err = file.Open()
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("open file err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("open file err: %s", err.Error()))
 		return
 	}
 	defer src.Close()
@@ -440,184 +1614,149 @@ func (h *Handler) UploadV2(c *gin.Context) {
 	var imageData []byte
 	imageData, err = io.ReadAll(src)
 	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("read image err: %s", err.Error()))
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
 		return
 	}
 
-	// Calculate image hash
-	imageHash := gemini.GenerateImageHash(imageData)
-
-	// Create a context with a 45-second timeout for external calls
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
-	defer cancel()
+	h.generateRecipe(c, recipeRequest{
+		engine:            EngineLocal,
+		client:            h.localClient(),
+		images:            [][]byte{imageData},
+		extension:         extension,
+		dietaryPreference: dietaryPreference,
+		cuisine:           cuisine,
+		skipFoodCheck:     skipFoodCheck,
+	})
+}
 
-	// --- Image Validation and Metadata Handling ---
-	imageDescription, err := h.RecipeStore.GetImageMetadata(ctx, imageHash)
-	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
-		return
-	}
+// savedImageWidth is the width images are resized to when saved.
+const savedImageWidth = 800
 
-	var isFood bool
-	var localLLMDescription string
+// saveImage saves a recipe image for display, with the watermark if there is one.
+func saveImage(imageData []byte, imageHash string, originalExtension string, watermark *Watermark) (string, error) {
+	return saveResizedImage(imageData, "images", imageHash, originalExtension, savedImageWidth, watermark)
+}
 
-	if imageDescription == "" {
-		// No metadata found, call Local LLM API to determine if it's food
-		log.Printf("Image metadata not found in database, calling Local LLM API for image hash: %s", imageHash)
-		isFood, localLLMDescription, err = h.LocalLLMClient.IsFoodImage(ctx, imageData)
-		if err != nil {
-			c.String(http.StatusInternalServerError, fmt.Sprintf("local llm err: %s", err.Error()))
-			return
-		}
+// recipeImagePath returns the path saveImage saves a recipe image at.
+func recipeImagePath(imageHash, extension string) string {
+	return filepath.Join("images", imageHash+extension)
+}
 
-		// Save the new metadata to the database
-		saveErr := h.RecipeStore.SaveImageMetadata(ctx, imageHash, localLLMDescription)
-		if saveErr != nil {
-			log.Printf("failed to save image metadata: %s", saveErr.Error())
-		}
-	} else {
-		// Metadata found, use it to determine if it's food
-		log.Printf("Image metadata found in database for image hash: %s", imageHash)
-		isFood = !strings.HasPrefix(strings.ToLower(strings.TrimSpace(imageDescription)), "no")
-		localLLMDescription = imageDescription // Use existing description
-	}
+// nonFoodImageDir is where images that turned out not to show food are kept.
+const nonFoodImageDir = "images/NoneFoodImages"
 
-	// If not food, save to non_food_images and return
-	if !isFood {
-		log.Printf("Image is not food, saving to non_food_images: %s", imageHash)
-		savePath, saveErr := saveNonFoodImage(imageData, imageHash, extension)
-		if saveErr != nil {
-			log.Printf("failed to save non-food image %s: %s", savePath, saveErr.Error())
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "Pixel Chef says: It doesn't look like food. We're here to help you whip up amazing dishes from your ingredients. Just snap a pic of your culinary creations (or ingredients!) and let's get cooking!"})
-		return
-	}
+func saveNonFoodImage(imageData []byte, imageHash string, originalExtension string) (string, error) {
+	return saveResizedImage(imageData, nonFoodImageDir, imageHash, originalExtension, savedImageWidth, nil)
+}
 
-	// --- If it is food, proceed with recipe generation and saving ---
+// errCorruptImage is returned when a saved image file doesn't decode.
+var errCorruptImage = errors.New("saved image is corrupt")
 
-	// Try to get recipe from store first (only for food images)
-	recipe, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+// saveResizedImage resizes the image to the given width, draws the watermark
+// on it unless watermark is nil, and saves it as dir/name+originalExtension.
+// If the written file doesn't decode, the save is retried once.
+func saveResizedImage(imageData []byte, dir string, name string, originalExtension string, width uint, watermark *Watermark) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database query timed out after 2 seconds")
-			return
-		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("database error: %s", err.Error()))
-		return
+		return "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	if recipe != nil {
-		log.Printf("Recipe found in database for image hash: %s", imageHash)
-		// Recipe found in database, return it
-		c.JSON(http.StatusOK, recipe)
-		return
-	}
+	img = watermark.apply(resize.Resize(width, 0, img, resize.Lanczos3))
 
-	// Recipe not found in database, generate with Local LLM
-	log.Printf("Recipe not found in database, generating with Local LLM for image hash: %s, dietaryPreference: %s, cuisine: %s", imageHash, dietaryPreference, cuisine)
-	recipe, err = h.LocalLLMClient.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
-	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Local LLM API call timed out after 45 seconds")
-			return
-		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("local llm err: %s", err.Error()))
-		return
+	// Create the directory if it doesn't exist
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s directory: %w", dir, err)
 	}
 
-	// Save the image to the 'images' directory
-	imagePath, err := saveImage(imageData, imageHash, extension)
-	if err != nil {
-		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to save image: %s", err.Error()))
-		return
+	imagePath, err := writeImageFile(img, dir, name, originalExtension)
+	if errors.Is(err, errCorruptImage) {
+		log.Printf("retrying save of %s: %s", name+originalExtension, err.Error())
+		imagePath, err = writeImageFile(img, dir, name, originalExtension)
 	}
-	recipe.ImagePath = imagePath
-
-
+	return imagePath, err
+}
 
-	// Save the new recipe to the database
-	recipe.ImageHash = imageHash
-	err = h.RecipeStore.SaveRecipe(ctx, recipe)
+// writeImageFile encodes the image into a temporary file in dir, checks that
+// the file decodes, and renames it to dir/name+extension, so readers never see
+// a partially written or corrupt file.
+func writeImageFile(img image.Image, dir string, name string, extension string) (string, error) {
+	imagePath := filepath.Join(dir, name+extension)
+	out, err := os.CreateTemp(dir, name+"-*.tmp")
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			c.String(http.StatusRequestTimeout, "Database save timed out after 2 seconds")
-			return
-		}
-		c.String(http.StatusInternalServerError, fmt.Sprintf("failed to save recipe: %s", err.Error()))
-		return
+		return "", fmt.Errorf("failed to create image file: %w", err)
 	}
+	tmpPath := out.Name()
 
-	c.JSON(http.StatusOK, recipe)
-}
-
-func saveImage(imageData []byte, imageHash string, originalExtension string) (string, error) {
-	img, _, err := image.Decode(strings.NewReader(string(imageData)))
+	err = encodeImage(out, img, extension)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %w", err)
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to encode image: %w", err)
 	}
 
-	img = resize.Resize(800, 0, img, resize.Lanczos3)
+	if err := verifyImageFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
 
-	// Create the images directory if it doesn't exist
-	if err := os.MkdirAll("images", 0755); err != nil {
-		return "", fmt.Errorf("failed to create images directory: %w", err)
+	// CreateTemp uses 0600; images are served to everyone
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to set image permissions: %w", err)
 	}
 
-	imagePath := filepath.Join("images", imageHash+originalExtension)
-	out, err := os.Create(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create image file: %w", err)
+	if err := os.Rename(tmpPath, imagePath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to move image into place: %w", err)
 	}
-	defer out.Close()
 
-	switch originalExtension {
+	return imagePath, nil
+}
+
+// encodeImage encodes img in the format of the file extension.
+func encodeImage(w io.Writer, img image.Image, extension string) error {
+	switch extension {
 	case ".jpeg", ".jpg":
-		err = jpeg.Encode(out, img, nil)
+		return jpeg.Encode(w, img, nil)
 	case ".png":
-		err = png.Encode(out, img)
+		return png.Encode(w, img)
 	default:
-		return "", fmt.Errorf("unsupported image format: %s", originalExtension)
-	}
-
-	if err != nil {
-		return "", fmt.Errorf("failed to encode image: %w", err)
+		return fmt.Errorf("unsupported image format: %s", extension)
 	}
-
-	return imagePath, nil
 }
 
-func saveNonFoodImage(imageData []byte, imageHash string, originalExtension string) (string, error) {
-	img, _, err := image.Decode(strings.NewReader(string(imageData)))
+// resizedImageData returns the image scaled down to the width recipe images
+// are saved in, without a watermark, encoded in the format of extension.
+func resizedImageData(imageData []byte, extension string) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
 	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %w", err)
-	}
-
-	img = resize.Resize(800, 0, img, resize.Lanczos3)
-
-	// Create the non_food_images directory if it doesn't exist
-	if err := os.MkdirAll("images/NoneFoodImages", 0755); err != nil {
-		return "", fmt.Errorf("failed to create non_food_images directory: %w", err)
+		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
-
-	imagePath := filepath.Join("images/NoneFoodImages", imageHash+originalExtension)
-	out, err := os.Create(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create image file: %w", err)
+	if img.Bounds().Dx() <= savedImageWidth {
+		return imageData, nil
 	}
-	defer out.Close()
 
-	switch originalExtension {
-	case ".jpeg", ".jpg":
-		err = jpeg.Encode(out, img, nil)
-	case ".png":
-		err = png.Encode(out, img)
-	default:
-		return "", fmt.Errorf("unsupported image format: %s", originalExtension)
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, resize.Resize(savedImageWidth, 0, img, resize.Lanczos3), extension); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
 	}
+	return buf.Bytes(), nil
+}
 
+// verifyImageFile reads the image file back from disk and decodes it, to
+// catch truncated or corrupted writes. The returned error wraps
+// errCorruptImage if the file doesn't decode.
+func verifyImageFile(path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to encode image: %w", err)
+		return fmt.Errorf("failed to open image for verification: %w", err)
 	}
+	defer f.Close()
 
-	return imagePath, nil
+	if _, _, err := image.Decode(f); err != nil {
+		return fmt.Errorf("%w: %s", errCorruptImage, err.Error())
+	}
+	return nil
 }
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/nfnt/resize"
+
+	"snapchef/internal/platform/gemini"
+)
+
+// Hash modes, which decide when two uploads count as the same image and so
+// share a recipe.
+const (
+	// HashModeBytes hashes the uploaded file as it is. Any change to the
+	// file, even to its metadata, gives a new hash.
+	HashModeBytes = "bytes"
+	// HashModePixels hashes the decoded pixels, so a photo with its metadata
+	// stripped or saved again without loss keeps its hash, see pixelHash.
+	HashModePixels = "pixels"
+)
+
+// pixelHashSize is the size of the grid differenceHash compares, giving a
+// pixelHashSize*pixelHashSize bit perceptual hash.
+const pixelHashSize = 16
+
+// canonicalImageSize is the width and height images are scaled to before
+// pixelHash hashes their pixels.
+const canonicalImageSize = 64
+
+// imageHash returns the hash images of one dish are stored under, in the
+// handler's hash mode. Several images get a single hash that doesn't depend
+// on their order, combined as in gemini.GenerateImagesHash.
+func (h *Handler) imageHash(images ...[]byte) string {
+	hash := gemini.GenerateImageHash
+	if h.HashMode == HashModePixels {
+		hash = pixelHash
+	}
+	if len(images) == 1 {
+		return hash(images[0])
+	}
+
+	hashes := make([]string, 0, len(images))
+	for _, imageData := range images {
+		hashes = append(hashes, hash(imageData))
+	}
+	sort.Strings(hashes)
+	return gemini.GenerateImageHash([]byte(strings.Join(hashes, "")))
+}
+
+// pixelHash returns a hash of the image's pixels rather than of its bytes:
+// the SHA-256 of the RGB values of the image scaled to canonicalImageSize
+// square. It is exact, unlike differenceHash, so different images, even
+// flat ones, don't share a recipe, but lossy re-encoding usually changes
+// it. Images that don't decode are hashed by their bytes.
+func pixelHash(imageData []byte) string {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return gemini.GenerateImageHash(imageData)
+	}
+	img = resize.Resize(canonicalImageSize, canonicalImageSize, img, resize.Bilinear)
+
+	bounds := img.Bounds()
+	pixels := make([]byte, 0, canonicalImageSize*canonicalImageSize*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			pixels = append(pixels, c.R, c.G, c.B)
+		}
+	}
+	hash := sha256.Sum256(pixels)
+	return hex.EncodeToString(hash[:])
+}
+
+// perceptualHash returns the differenceHash bits of an image in hex, for
+// finding similar images with hammingDistance in /images/search. It is too
+// coarse to tell recipes apart, see pixelHash. It returns "" if the image
+// doesn't decode.
+func perceptualHash(imageData []byte) string {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(differenceHash(img))
+}
+
+// hammingDistance returns the number of bits that differ between two
+// perceptual hashes, or -1 if they can't be compared.
+func hammingDistance(a, b string) int {
+	x, errA := hex.DecodeString(a)
+	y, errB := hex.DecodeString(b)
+	if errA != nil || errB != nil || len(x) != len(y) || len(x) == 0 {
+		return -1
+	}
+	distance := 0
+	for i := range x {
+		distance += bits.OnesCount8(x[i] ^ y[i])
+	}
+	return distance
+}
+
+// differenceHash returns a pixelHashSize*pixelHashSize bit difference hash of
+// an image: the image is scaled to a grayscale grid pixelHashSize+1 wide and
+// pixelHashSize high, and each bit says whether a cell is brighter than its
+// right neighbor. Re-encoding a photo rarely flips a bit, and similar
+// looking images differ in few bits.
+func differenceHash(img image.Image) []byte {
+	img = resize.Resize(pixelHashSize+1, pixelHashSize, img, resize.Bilinear)
+
+	bounds := img.Bounds()
+	hash := make([]byte, pixelHashSize*pixelHashSize/8)
+	for y := 0; y < pixelHashSize; y++ {
+		for x := 0; x < pixelHashSize; x++ {
+			left := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			right := color.GrayModel.Convert(img.At(bounds.Min.X+x+1, bounds.Min.Y+y)).(color.Gray).Y
+			if left > right {
+				bit := y*pixelHashSize + x
+				hash[bit/8] |= 1 << (bit % 8)
+			}
+		}
+	}
+	return hash
+}
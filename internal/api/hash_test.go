@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"snapchef/internal/platform/gemini"
+)
+
+// gradient returns a smooth 200x150 test image, getting brighter to the
+// right, or to the left if reversed.
+func gradient(reversed bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 150; y++ {
+			shade := x
+			if reversed {
+				shade = 199 - x
+			}
+			img.Set(x, y, color.RGBA{R: uint8(shade), G: uint8(y), B: 120, A: 255})
+		}
+	}
+	return img
+}
+
+func decode(t *testing.T, imageData []byte) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	assert.NoError(t, err)
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image, level png.CompressionLevel) []byte {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: level}
+	assert.NoError(t, encoder.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}))
+	return buf.Bytes()
+}
+
+// withComment returns the PNG with a tEXt metadata chunk after its header.
+func withComment(pngData []byte, comment string) []byte {
+	data := append([]byte("tEXt"), "Comment\x00"+comment...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)-4))
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(data))
+
+	// The 8 byte signature and the 25 byte IHDR chunk come first
+	const headerEnd = 8 + 25
+	return append(append(append([]byte{}, pngData[:headerEnd]...), chunk...), pngData[headerEnd:]...)
+}
+
+// flat returns a 200x150 test image of a single color.
+func flat(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 150))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestImageHash(t *testing.T) {
+	bytesMode := &Handler{HashMode: HashModeBytes}
+	pixelsMode := &Handler{HashMode: HashModePixels}
+
+	tests := []struct {
+		name       string
+		a, b       []byte
+		samePixels bool
+	}{
+		{"png compression", encodePNG(t, gradient(false), png.BestSpeed), encodePNG(t, gradient(false), png.BestCompression), true},
+		{"png metadata", encodePNG(t, gradient(false), png.DefaultCompression), withComment(encodePNG(t, gradient(false), png.DefaultCompression), "resaved"), true},
+		{"different image", encodePNG(t, gradient(false), png.DefaultCompression), encodePNG(t, gradient(true), png.DefaultCompression), false},
+		// Flat images have the same perceptual hash, but aren't the same dish
+		{"flat colors", encodePNG(t, flat(color.RGBA{R: 200, A: 255}), png.DefaultCompression), encodePNG(t, flat(color.RGBA{B: 200, A: 255}), png.DefaultCompression), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotEqual(t, tt.a, tt.b)
+
+			// Bytes mode tells every encoding apart
+			assert.NotEqual(t, bytesMode.imageHash(tt.a), bytesMode.imageHash(tt.b))
+
+			if tt.samePixels {
+				assert.Equal(t, pixelsMode.imageHash(tt.a), pixelsMode.imageHash(tt.b))
+			} else {
+				assert.NotEqual(t, pixelsMode.imageHash(tt.a), pixelsMode.imageHash(tt.b))
+			}
+		})
+	}
+}
+
+func TestImageHash_SeveralImages(t *testing.T) {
+	a := encodePNG(t, gradient(false), png.DefaultCompression)
+	b := encodePNG(t, gradient(true), png.DefaultCompression)
+
+	// The default stays compatible with hashes of existing recipes
+	assert.Equal(t, gemini.GenerateImageHash(a), (&Handler{}).imageHash(a))
+	assert.Equal(t, gemini.GenerateImagesHash([][]byte{a, b}), (&Handler{}).imageHash(a, b))
+
+	for _, mode := range []string{HashModeBytes, HashModePixels} {
+		h := &Handler{HashMode: mode}
+		assert.Equal(t, h.imageHash(a, b), h.imageHash(b, a), mode)
+		assert.True(t, isImageHash(h.imageHash(a, b)), mode)
+		assert.True(t, isImageHash(h.imageHash(a)), mode)
+	}
+
+	// Bytes that aren't an image fall back to hashing the bytes
+	assert.Equal(t, gemini.GenerateImageHash([]byte("not an image")), (&Handler{HashMode: HashModePixels}).imageHash([]byte("not an image")))
+}
+
+func TestHammingDistance(t *testing.T) {
+	a := perceptualHash(encodePNG(t, gradient(false), png.DefaultCompression))
+	b := perceptualHash(encodeJPEG(t, gradient(false), 70))
+	reversed := perceptualHash(encodePNG(t, gradient(true), png.DefaultCompression))
+
+	assert.Len(t, a, pixelHashSize*pixelHashSize/4)
+	assert.Equal(t, 0, hammingDistance(a, a))
+	assert.LessOrEqual(t, hammingDistance(a, b), defaultSimilarityThreshold)
+	assert.Greater(t, hammingDistance(a, reversed), defaultSimilarityThreshold)
+
+	assert.Equal(t, "", perceptualHash([]byte("not an image")))
+	assert.Equal(t, -1, hammingDistance(a, ""))
+	assert.Equal(t, -1, hammingDistance(a, "not hex"))
+}
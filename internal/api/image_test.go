@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 1000x10 images of a "dish", wider than savedImageWidth so saving resizes them.
+var (
+	//go:embed testdata/dish.png
+	dishPNG []byte
+	//go:embed testdata/dish.jpg
+	dishJPEG []byte
+)
+
+// inTempDir runs the test from a temporary directory, since images are
+// saved relative to the working directory.
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSaveImage(t *testing.T) {
+	inTempDir(t)
+
+	tests := []struct {
+		name      string
+		imageData []byte
+		extension string
+		format    string
+	}{
+		{"png", dishPNG, ".png", "png"},
+		{"jpg", dishJPEG, ".jpg", "jpeg"},
+		{"jpeg", dishJPEG, ".jpeg", "jpeg"},
+		// The extension decides the saved format, not the uploaded one
+		{"png saved as jpg", dishPNG, ".jpg", "jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imagePath, err := saveImage(tt.imageData, "hash-"+tt.name, tt.extension, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join("images", "hash-"+tt.name+tt.extension), imagePath)
+
+			saved, err := os.ReadFile(imagePath)
+			assert.NoError(t, err)
+			config, format, err := image.DecodeConfig(bytes.NewReader(saved))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, savedImageWidth, config.Width)
+			assert.Equal(t, 8, config.Height)
+
+			info, err := os.Stat(imagePath)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+		})
+	}
+
+	// No temporary files are left behind
+	leftovers, err := filepath.Glob(filepath.Join("images", "*.tmp"))
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestSaveImage_Invalid(t *testing.T) {
+	inTempDir(t)
+
+	_, err := saveImage([]byte("not an image"), "hash", ".png", nil)
+	assert.Error(t, err)
+
+	_, err = saveImage(dishPNG, "hash", ".gif", nil)
+	assert.Error(t, err)
+
+	leftovers, _ := filepath.Glob(filepath.Join("images", "*"))
+	assert.Empty(t, leftovers)
+}
+
+func TestVerifyImageFile(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.png")
+	assert.NoError(t, os.WriteFile(valid, dishPNG, 0644))
+	assert.NoError(t, verifyImageFile(valid))
+
+	truncated := filepath.Join(dir, "truncated.jpg")
+	assert.NoError(t, os.WriteFile(truncated, dishJPEG[:len(dishJPEG)/2], 0644))
+	assert.ErrorIs(t, verifyImageFile(truncated), errCorruptImage)
+}
+
+func TestResizedImageData(t *testing.T) {
+	resized, err := resizedImageData(dishPNG, ".png")
+	assert.NoError(t, err)
+	config, format, err := image.DecodeConfig(bytes.NewReader(resized))
+	assert.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, savedImageWidth, config.Width)
+
+	// Images already small enough are kept as they are
+	small, err := resizedImageData(resized, ".png")
+	assert.NoError(t, err)
+	assert.Equal(t, resized, small)
+}
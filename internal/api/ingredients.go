@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// ExtractIngredients handles POST /ingredients. It asks the engine for only
+// the ingredients visible in the uploaded image, with estimated quantities,
+// which is quicker and cheaper than generating a full recipe. Nothing is
+// looked up or saved.
+func (h *Handler) ExtractIngredients(c *gin.Context) {
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+	switch extension {
+	case ".jpeg", ".jpg", ".png":
+	default:
+		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	ingredients, err := client.ExtractIngredients(ctx, imageData)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		if errors.Is(err, recipe.ErrNotFoodImage) {
+			c.String(http.StatusBadRequest, "Oops! That doesn't look like food. Snap a pic of a dish and we'll tell you what's in it.")
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned no ingredients (%s). Please try again.", engine, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, ingredients)
+}
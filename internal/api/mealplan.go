@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// defaultMealPlanDays and maxMealPlanDays are how many days a meal plan
+// covers when the request doesn't say, and at most.
+const (
+	defaultMealPlanDays = 7
+	maxMealPlanDays     = 14
+)
+
+// mealPlanRequest is the JSON body of POST /meal-plan. Every field is
+// optional.
+type mealPlanRequest struct {
+	// Days is how many recipes to plan, one a day, defaultMealPlanDays if 0.
+	Days int `json:"days"`
+	// Cuisines restricts the plan to recipes of these cuisines.
+	Cuisines          []string `json:"cuisines"`
+	DietaryPreference string   `json:"dietary_preference"`
+	// MealType is one of recipe.MealTypes, dinner if empty.
+	MealType string `json:"meal_type"`
+	// Servings scales the shopping list to this many servings a meal.
+	Servings int `json:"servings"`
+}
+
+// mealPlanResponse is the response of POST /meal-plan.
+type mealPlanResponse struct {
+	Recipes      []*recipe.Recipe  `json:"recipes"`
+	ShoppingList map[string]string `json:"shopping_list"`
+	Warnings     []string          `json:"warnings,omitempty"`
+}
+
+// MealPlan handles POST /meal-plan, planning a week of meals, or the number
+// of days asked for, from the saved recipes matching the request: see
+// recipe.PlanMeals for how they are picked. Candidates are shuffled first,
+// so each request gets a different plan. It returns the recipes in the order
+// of the days, and the consolidated shopping list for all of them. Recipes
+// are only picked from those already generated, since generating one needs
+// an image; a plan with fewer recipes than days comes with a warning.
+func (h *Handler) MealPlan(c *gin.Context) {
+	var req mealPlanRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+			return
+		}
+	}
+	if req.Days == 0 {
+		req.Days = defaultMealPlanDays
+	}
+	if req.Days < 1 || req.Days > maxMealPlanDays {
+		c.String(http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxMealPlanDays))
+		return
+	}
+	if req.Servings < 0 || req.Servings > maxRequestedServings {
+		c.String(http.StatusBadRequest, fmt.Sprintf("servings must be a whole number between 1 and %d", maxRequestedServings))
+		return
+	}
+	mealType := recipe.MealTypeDinner
+	if req.MealType != "" {
+		if !recipe.IsMealType(req.MealType) {
+			c.String(http.StatusBadRequest, fmt.Sprintf("invalid meal_type %q, expected one of %s", req.MealType, strings.Join(recipe.MealTypes, ", ")))
+			return
+		}
+		mealType = recipe.NormalizeMealType(req.MealType)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	recipes, err := h.RecipeStore.GetRecipes(ctx, recipe.Filter{
+		DietaryPreference: recipe.NormalizeDietaryPreference(req.DietaryPreference),
+		MealType:          mealType,
+	})
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if len(req.Cuisines) > 0 {
+		recipes = slices.DeleteFunc(recipes, func(r *recipe.Recipe) bool {
+			return !slices.ContainsFunc(req.Cuisines, func(cuisine string) bool {
+				return strings.EqualFold(strings.TrimSpace(cuisine), strings.TrimSpace(r.Cuisine))
+			})
+		})
+	}
+	rand.Shuffle(len(recipes), func(i, j int) {
+		recipes[i], recipes[j] = recipes[j], recipes[i]
+	})
+
+	plan := recipe.PlanMeals(recipes, req.Days)
+	resp := mealPlanResponse{
+		Recipes:      plan,
+		ShoppingList: recipe.ShoppingList(plan, req.Servings),
+	}
+	if len(plan) < req.Days {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("only %d saved recipes match, so the plan covers %d of %d days", len(plan), len(plan), req.Days))
+	}
+	h.writeJSON(c, http.StatusOK, resp)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mergeRecipesRequest is the JSON body of POST /admin/recipes/merge.
+type mergeRecipesRequest struct {
+	Keep  string `json:"keep" binding:"required"`
+	Merge string `json:"merge" binding:"required"`
+}
+
+// MergeRecipes handles POST /admin/recipes/merge, merging two recipes for
+// the same dish: the recipe for the image hash merge is deleted, with its
+// image, and its hash is redirected to the recipe for keep, which gets its
+// reports. It returns the kept recipe.
+func (h *Handler) MergeRecipes(c *gin.Context) {
+	var req mergeRecipesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	kept, err := h.RecipeStore.GetRecipeByImageHash(ctx, req.Keep)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	merged, err := h.RecipeStore.GetRecipeByImageHash(ctx, req.Merge)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if kept == nil || merged == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+	// A hash merged before is looked up as the recipe it was merged into
+	if merged.ImageHash != req.Merge {
+		c.String(http.StatusConflict, fmt.Sprintf("Recipe %s was already merged into %s", req.Merge, merged.ImageHash))
+		return
+	}
+	if kept.ImageHash == merged.ImageHash {
+		c.String(http.StatusBadRequest, "Can't merge a recipe into itself")
+		return
+	}
+
+	imagePath, err := h.RecipeStore.MergeRecipes(ctx, kept.ImageHash, merged.ImageHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.String(http.StatusNotFound, "Recipe not found")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	removeImageFiles(imagePath)
+	log.Printf("Merged recipe %s into %s", merged.ImageHash, kept.ImageHash)
+
+	h.writeJSON(c, http.StatusOK, kept)
+}
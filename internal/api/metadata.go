@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// RegenerateImageMetadata handles POST /image-metadata/:image_hash/regenerate,
+// running the food check on a stored image again with the current prompt and
+// overwriting the image's metadata with the result. Nothing else about the
+// image or its recipe changes.
+func (h *Handler) RegenerateImageMetadata(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+	if !isImageHash(imageHash) {
+		c.String(http.StatusBadRequest, "Invalid image hash")
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	imageData, err := h.loadFoodCheckImage(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to load image: %s", err.Error()))
+		return
+	}
+	if imageData == nil {
+		c.String(http.StatusNotFound, "Image not found")
+		return
+	}
+
+	isFood, description, err := client.IsFoodImage(ctx, imageData)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	if err := h.RecipeStore.SaveImageMetadata(ctx, imageHash, description, isFood); err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to save image metadata: %s", err.Error()))
+		return
+	}
+	log.Printf("Regenerated image metadata for %s with %s", imageHash, engine)
+
+	h.writeJSON(c, http.StatusOK, &recipe.ImageMetadata{Description: description, IsFood: isFood})
+}
+
+// loadFoodCheckImage returns the image to run the food check on for the
+// hash: the uploaded image from image_data, or else the saved recipe image
+// or non-food image on disk. It returns nil if there is none.
+func (h *Handler) loadFoodCheckImage(ctx context.Context, imageHash string) ([]byte, error) {
+	encodedImage, err := h.RecipeStore.GetImageData(ctx, imageHash)
+	if err != nil {
+		return nil, err
+	}
+	if encodedImage != "" {
+		return base64.StdEncoding.DecodeString(encodedImage)
+	}
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(nonFoodImageDir, imageHash+".*"))
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && r.ImagePath != "" {
+		paths = append([]string{r.ImagePath}, paths...)
+	}
+	for _, path := range paths {
+		imageData, err := os.ReadFile(path)
+		if err == nil {
+			return imageData, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics handles GET /metrics, reporting the server's gauges and counters
+// in the Prometheus text format.
+func (h *Handler) Metrics(c *gin.Context) {
+	var b strings.Builder
+	if q := h.LocalQueue; q != nil {
+		writeMetric(&b, "snapchef_local_queue_depth", "gauge", "Requests waiting for the local engine.", int64(q.Depth()))
+		writeMetric(&b, "snapchef_local_queue_running", "gauge", "Requests the local engine is working on.", int64(len(q.running)))
+		writeMetric(&b, "snapchef_local_queue_capacity", "gauge", "Requests the local engine can run and queue at once.", int64(cap(q.pending)))
+		writeMetric(&b, "snapchef_local_queue_rejected_total", "counter", "Requests turned away because the local engine's queue was full.", q.rejected.Load())
+	}
+	if len(h.CircuitBreakers) > 0 {
+		engines := slices.Sorted(maps.Keys(h.CircuitBreakers))
+		fmt.Fprintf(&b, "# HELP snapchef_engine_circuit_state Circuit breaker state by engine: 0 closed, 1 half-open, 2 open.\n# TYPE snapchef_engine_circuit_state gauge\n")
+		for _, engine := range engines {
+			fmt.Fprintf(&b, "snapchef_engine_circuit_state{engine=%q} %d\n", engine, h.CircuitBreakers[engine].State())
+		}
+		fmt.Fprintf(&b, "# HELP snapchef_engine_circuit_trips_total Times an engine's circuit breaker opened.\n# TYPE snapchef_engine_circuit_trips_total counter\n")
+		for _, engine := range engines {
+			fmt.Fprintf(&b, "snapchef_engine_circuit_trips_total{engine=%q} %d\n", engine, h.CircuitBreakers[engine].trips.Load())
+		}
+		fmt.Fprintf(&b, "# HELP snapchef_engine_circuit_rejected_total Calls failed without calling the engine because its circuit breaker was open.\n# TYPE snapchef_engine_circuit_rejected_total counter\n")
+		for _, engine := range engines {
+			fmt.Fprintf(&b, "snapchef_engine_circuit_rejected_total{engine=%q} %d\n", engine, h.CircuitBreakers[engine].rejected.Load())
+		}
+	}
+	reprompts := make(map[string]repromptCounter)
+	for engine, client := range map[string]RecipeClient{
+		EngineGemini: h.GeminiClient,
+		EngineLocal:  h.LocalLLMClient,
+		EngineClaude: h.ClaudeClient,
+		EngineOpenAI: h.OpenAIClient,
+	} {
+		if counter, ok := client.(repromptCounter); ok {
+			reprompts[engine] = counter
+		}
+	}
+	if len(reprompts) > 0 {
+		fmt.Fprintf(&b, "# HELP snapchef_engine_json_reprompts_total Recipes asked for again because the engine's reply wasn't valid JSON.\n# TYPE snapchef_engine_json_reprompts_total counter\n")
+		for _, engine := range slices.Sorted(maps.Keys(reprompts)) {
+			fmt.Fprintf(&b, "snapchef_engine_json_reprompts_total{engine=%q} %d\n", engine, reprompts[engine].Reprompts())
+		}
+	}
+	fmt.Fprintf(&b, "# HELP snapchef_errors_total Error responses, by the kind of failure.\n# TYPE snapchef_errors_total counter\n")
+	for class := errorClass(0); class < numErrorClasses; class++ {
+		fmt.Fprintf(&b, "snapchef_errors_total{class=%q} %d\n", class.String(), h.errorCounts[class].Load())
+	}
+	writeMetric(&b, "snapchef_multipart_cleanup_errors_total", "counter", "Requests whose multipart temp files couldn't be removed.", h.multipartCleanupErrors.Load())
+	if usage, err := multipartTempUsage(); err == nil {
+		writeMetric(&b, "snapchef_multipart_temp_files", "gauge", "Multipart upload temp files on disk.", int64(usage.Files))
+		writeMetric(&b, "snapchef_multipart_temp_bytes", "gauge", "Size of the multipart upload temp files on disk.", usage.Bytes)
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// repromptCounter is implemented by the engine clients that ask again for
+// recipes whose reply wasn't valid JSON.
+type repromptCounter interface {
+	Reprompts() int64
+}
+
+func writeMetric(b *strings.Builder, name, kind, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Multipart limits used unless configured otherwise. The largest upload is
+// a dish with maxImagesPerDish images, plus a little for the other fields.
+const (
+	DefaultMaxUploadBytes    = maxImagesPerDish*maxImageSize + 1<<20
+	DefaultMaxMultipartParts = 20
+)
+
+// errTooManyParts is returned while reading a multipart body with more parts than allowed.
+var errTooManyParts = errors.New("too many multipart parts")
+
+// LimitMultipart is middleware that bounds multipart/form-data requests
+// before anything is buffered: bodies larger than h.MaxUploadBytes get a 413,
+// and bodies with more than h.MaxMultipartParts fields and files a 400, so a
+// flood of tiny parts can't tie up the server. The form is parsed here, and
+// handlers get it from c.MultipartForm as before. Once the handler is done,
+// the temporary files of large uploads are removed. Other requests pass
+// through.
+func (h *Handler) LimitMultipart(c *gin.Context) {
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		c.Next()
+		return
+	}
+
+	if h.MaxUploadBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxUploadBytes)
+	}
+	if h.MaxMultipartParts > 0 {
+		c.Request.Body = &partLimitReader{
+			ReadCloser: c.Request.Body,
+			delimiter:  []byte("--" + params["boundary"]),
+			// The closing delimiter comes after the last part
+			remaining: h.MaxMultipartParts + 1,
+		}
+	}
+
+	if _, err := c.MultipartForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is too large. The maximum size is %d MB.", h.MaxUploadBytes>>20))
+		case errors.Is(err, errTooManyParts):
+			c.String(http.StatusBadRequest, fmt.Sprintf("Too many form fields. Send at most %d fields and files.", h.MaxMultipartParts))
+		default:
+			c.String(http.StatusBadRequest, fmt.Sprintf("invalid multipart form: %s", err.Error()))
+		}
+		c.Abort()
+		return
+	}
+	defer h.removeMultipartFiles(c)
+	c.Next()
+}
+
+// removeMultipartFiles removes the temporary files the multipart form of a
+// request was spooled to. net/http removes them too once the response is
+// finished, but only after the connection is done with the request, which
+// under load leaves them behind for a long time.
+func (h *Handler) removeMultipartFiles(c *gin.Context) {
+	if c.Request.MultipartForm == nil {
+		return
+	}
+	if err := c.Request.MultipartForm.RemoveAll(); err != nil {
+		h.multipartCleanupErrors.Add(1)
+		log.Printf("failed to remove multipart temp files: %s", err.Error())
+	}
+}
+
+// multipartTempUsage adds up the temporary files of multipart uploads, which
+// mime/multipart creates in the temp directory as multipart-*.
+func multipartTempUsage() (diskUsage, error) {
+	var usage diskUsage
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), "multipart-*"))
+	if err != nil {
+		return diskUsage{}, err
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			// Removed since the glob, by a request that finished
+			continue
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+	}
+	return usage, nil
+}
+
+// partLimitReader fails with errTooManyParts once more than remaining
+// boundary delimiters have been read. It only counts delimiters, so the parts
+// themselves are never buffered.
+type partLimitReader struct {
+	io.ReadCloser
+	delimiter []byte
+	remaining int
+
+	// tail holds the end of the previous read, for delimiters split across reads.
+	tail []byte
+}
+
+func (r *partLimitReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		// tail is shorter than the delimiter, so no delimiter is counted twice
+		buf := append(r.tail, p[:n]...)
+		r.remaining -= bytes.Count(buf, r.delimiter)
+		r.tail = append(r.tail[:0], buf[len(buf)-min(len(buf), len(r.delimiter)-1):]...)
+		if r.remaining < 0 {
+			// Drop what was read: the form parser only sees an error once
+			// it runs out of data, and could otherwise finish without it
+			return 0, errTooManyParts
+		}
+	}
+	return n, err
+}
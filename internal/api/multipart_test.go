@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartBody returns a multipart body with the given number of fields, and its boundary.
+func multipartBody(t *testing.T, fields int) ([]byte, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for range fields {
+		assert.NoError(t, writer.WriteField("field", "value"))
+	}
+	assert.NoError(t, writer.Close())
+	return body.Bytes(), writer.Boundary()
+}
+
+func TestPartLimitReader(t *testing.T) {
+	body, boundary := multipartBody(t, 3)
+
+	read := func(maxParts int) error {
+		// One byte at a time, so delimiters are split across reads
+		r := &partLimitReader{
+			ReadCloser: io.NopCloser(iotest.OneByteReader(bytes.NewReader(body))),
+			delimiter:  []byte("--" + boundary),
+			remaining:  maxParts + 1,
+		}
+		form, err := multipart.NewReader(r, boundary).ReadForm(1 << 20)
+		if err == nil {
+			assert.Len(t, form.Value["field"], 3)
+		}
+		return err
+	}
+
+	assert.NoError(t, read(3))
+	assert.NoError(t, read(10))
+	assert.ErrorIs(t, read(2), errTooManyParts)
+}
+
+func TestLimitMultipart_RemovesTempFiles(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	// Spool every file to disk
+	r.MaxMultipartMemory = 1
+	h := &Handler{}
+	var during diskUsage
+	r.POST("/upload", h.LimitMultipart, func(c *gin.Context) {
+		during, _ = multipartTempUsage()
+		c.Status(http.StatusOK)
+	})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "dish.png")
+	assert.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte("x"), 4096))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, 1, during.Files)
+	assert.Equal(t, int64(4096), during.Bytes)
+	after, err := multipartTempUsage()
+	assert.NoError(t, err)
+	assert.Zero(t, after.Files)
+	assert.Zero(t, h.multipartCleanupErrors.Load())
+}
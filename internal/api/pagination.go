@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// DefaultMaxUnfilteredResults is the most recipes GET /recipes lists without
+// a filter or pagination parameters, unless configured otherwise.
+const DefaultMaxUnfilteredResults = 1000
+
+// pagination is a page of a list requested with ?page= and ?per_page=.
+type pagination struct {
+	page    int
+	perPage int
+}
+
+// offset returns the number of items before the page.
+func (p pagination) offset() int {
+	return (p.page - 1) * p.perPage
+}
+
+// parsePagination reads ?page= (1-based) and ?per_page= from the request.
+// ok is false when neither is set.
+func parsePagination(c *gin.Context) (p pagination, ok bool, err error) {
+	pageParam, perPageParam := c.Query("page"), c.Query("per_page")
+	if pageParam == "" && perPageParam == "" {
+		return pagination{}, false, nil
+	}
+
+	p = pagination{page: 1, perPage: defaultPerPage}
+	if pageParam != "" {
+		if p.page, err = strconv.Atoi(pageParam); err != nil || p.page < 1 {
+			return pagination{}, false, fmt.Errorf("page must be a positive integer")
+		}
+	}
+	if perPageParam != "" {
+		if p.perPage, err = strconv.Atoi(perPageParam); err != nil || p.perPage < 1 || p.perPage > maxPerPage {
+			return pagination{}, false, fmt.Errorf("per_page must be between 1 and %d", maxPerPage)
+		}
+	}
+	return p, true, nil
+}
+
+// offsetPagination is a slice of a list requested with ?limit= and ?offset=.
+type offsetPagination struct {
+	limit  int
+	offset int
+}
+
+// parseOffsetPagination reads ?limit= (defaultPerPage if not set) and
+// ?offset= (0 if not set) from the request. ok is false when neither is set,
+// in which case p is the first page.
+func parseOffsetPagination(c *gin.Context) (p offsetPagination, ok bool, err error) {
+	limitParam, offsetParam := c.Query("limit"), c.Query("offset")
+	p = offsetPagination{limit: defaultPerPage}
+	if limitParam == "" && offsetParam == "" {
+		return p, false, nil
+	}
+
+	if limitParam != "" {
+		if p.limit, err = strconv.Atoi(limitParam); err != nil || p.limit < 1 || p.limit > maxPerPage {
+			return offsetPagination{}, false, fmt.Errorf("limit must be between 1 and %d", maxPerPage)
+		}
+	}
+	if offsetParam != "" {
+		if p.offset, err = strconv.Atoi(offsetParam); err != nil || p.offset < 0 {
+			return offsetPagination{}, false, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return p, true, nil
+}
+
+// setPaginationHeaders sets X-Total-Count, X-Page and an RFC 5988 Link header
+// with the next and prev pages, when there are any.
+func setPaginationHeaders(c *gin.Context, p pagination, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Header("X-Page", strconv.Itoa(p.page))
+
+	var links []string
+	if p.offset()+p.perPage < total {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(c.Request, p.page+1)))
+	}
+	if p.page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(c.Request, p.page-1)))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL returns the request URL with ?page= set to the given page.
+func pageURL(req *http.Request, page int) string {
+	u := *req.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
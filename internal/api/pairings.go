@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// GetPairings handles GET /recipes/:image_hash/pairings, suggesting drinks
+// to go with a recipe: wine, beer and non-alcoholic, or only non-alcoholic
+// for diets that rule alcohol out. The engine is asked once per recipe and
+// the suggestions are saved, until the recipe is saved again.
+func (h *Handler) GetPairings(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	// A merged hash resolves to the recipe it was merged into, which the
+	// pairings are cached on
+	imageHash = r.ImageHash
+	pairings, err := h.RecipeStore.GetPairings(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if pairings != nil {
+		h.writeJSON(c, http.StatusOK, pairings)
+		return
+	}
+
+	pairings, err = client.SuggestPairings(ctx, r)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned no usable pairings (%s). Please try again.", engine, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	// The pairings are still worth returning if they can't be cached
+	if err := h.RecipeStore.SetPairings(ctx, imageHash, pairings); err != nil {
+		log.Printf("failed to save pairings for %s: %s", imageHash, err.Error())
+	}
+
+	h.writeJSON(c, http.StatusOK, pairings)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// maxServingsRequest is the JSON body of POST /recipes/:image_hash/max-servings.
+type maxServingsRequest struct {
+	// Pantry maps ingredient names to the quantities at hand, e.g. {"flour": "1 kg"}.
+	Pantry map[string]string `json:"pantry" binding:"required"`
+}
+
+// MaxServings handles POST /recipes/:image_hash/max-servings. It works out
+// how many servings of the recipe the posted pantry can make, and which
+// ingredient runs out first.
+func (h *Handler) MaxServings(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	var req maxServingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	estimate, err := recipe.MaxServings(r, req.Pantry)
+	if err != nil {
+		if errors.Is(err, recipe.ErrUnknownServings) || errors.Is(err, recipe.ErrNothingMeasurable) {
+			c.String(http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, estimate)
+}
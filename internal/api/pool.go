@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// Item statuses reported by runPool.
+const (
+	ItemDone     = "done"
+	ItemFailed   = "failed"
+	ItemCanceled = "canceled"
+)
+
+// ItemResult is the outcome of one item of a batch.
+type ItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runPool runs task for items 0 to n-1, at most workers at a time, and
+// returns their results in order. Once ctx is done, e.g. because the client
+// disconnected, no more items are started: those left are reported as
+// canceled, while those already running are left to finish or fail on
+// their own. If progress is set it is called with each result as it comes
+// in, one call at a time, so it can stream progress to the client.
+func runPool(ctx context.Context, workers, n int, task func(ctx context.Context, i int) error, progress func(ItemResult)) []ItemResult {
+	results := make([]ItemResult, n)
+	var mu sync.Mutex
+	report := func(result ItemResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[result.Index] = result
+		if progress != nil {
+			progress(result)
+		}
+	}
+
+	slots := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i := range n {
+		select {
+		case slots <- struct{}{}:
+			// select picks at random when a slot frees up as ctx is done
+			if ctx.Err() != nil {
+				<-slots
+				report(ItemResult{Index: i, Status: ItemCanceled, Error: ctx.Err().Error()})
+				continue
+			}
+		case <-ctx.Done():
+			report(ItemResult{Index: i, Status: ItemCanceled, Error: ctx.Err().Error()})
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := task(ctx, i); err != nil {
+				report(ItemResult{Index: i, Status: ItemFailed, Error: err.Error()})
+				return
+			}
+			report(ItemResult{Index: i, Status: ItemDone})
+		}()
+	}
+	wg.Wait()
+	return results
+}
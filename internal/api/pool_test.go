@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPool(t *testing.T) {
+	var running, peak atomic.Int64
+	task := func(ctx context.Context, i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if i%3 == 0 {
+			return fmt.Errorf("item %d failed", i)
+		}
+		return nil
+	}
+
+	var reported []ItemResult
+	results := runPool(context.Background(), 3, 10, task, func(result ItemResult) {
+		reported = append(reported, result)
+	})
+
+	assert.LessOrEqual(t, peak.Load(), int64(3))
+	assert.Len(t, reported, 10)
+	if assert.Len(t, results, 10) {
+		for i, result := range results {
+			assert.Equal(t, i, result.Index)
+			if i%3 == 0 {
+				assert.Equal(t, ItemResult{Index: i, Status: ItemFailed, Error: fmt.Sprintf("item %d failed", i)}, result)
+			} else {
+				assert.Equal(t, ItemResult{Index: i, Status: ItemDone}, result)
+			}
+		}
+	}
+}
+
+func TestRunPool_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	started := map[int]bool{}
+	task := func(ctx context.Context, i int) error {
+		mu.Lock()
+		started[i] = true
+		mu.Unlock()
+		if i == 1 {
+			cancel()
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	results := runPool(ctx, 2, 5, task, nil)
+
+	// Items 0 and 1 were running when the context was canceled, and failed on
+	// their own; the rest were never started
+	assert.Equal(t, map[int]bool{0: true, 1: true}, started)
+	for i, result := range results {
+		if i < 2 {
+			assert.Equal(t, ItemFailed, result.Status)
+		} else {
+			assert.Equal(t, ItemCanceled, result.Status)
+		}
+		assert.Equal(t, context.Canceled.Error(), result.Error)
+	}
+}
+
+func TestRunPool_Empty(t *testing.T) {
+	results := runPool(context.Background(), 4, 0, func(context.Context, int) error {
+		return errors.New("never called")
+	}, nil)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/nfnt/resize"
+
+	"snapchef/internal/recipe"
+)
+
+// ImagePreprocessor scales images down before they are sent to an engine.
+// Engines don't need full-resolution photos to recognize a dish, and smaller
+// images cost less bandwidth and fewer tokens. Only what the engine sees is
+// scaled: the image hash and the saved images still come from the uploaded
+// bytes.
+type ImagePreprocessor struct {
+	maxDimension uint
+}
+
+// NewImagePreprocessor creates a preprocessor that scales images down so
+// neither side is longer than maxDimension pixels.
+func NewImagePreprocessor(maxDimension uint) *ImagePreprocessor {
+	return &ImagePreprocessor{maxDimension: maxDimension}
+}
+
+// prepare returns imageData scaled down to fit the maximum dimension and
+// re-encoded in its original format. Images that already fit, that don't
+// decode, or that would only grow by being re-encoded are returned unchanged.
+func (p *ImagePreprocessor) prepare(imageData []byte) []byte {
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil || uint(max(config.Width, config.Height)) <= p.maxDimension {
+		return imageData
+	}
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return imageData
+	}
+
+	// Scale the longer side, resize keeps the aspect ratio for the 0 side
+	width, height := p.maxDimension, uint(0)
+	if config.Height > config.Width {
+		width, height = 0, p.maxDimension
+	}
+	img = resize.Resize(width, height, img, resize.Lanczos3)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		return imageData
+	}
+	if err != nil || buf.Len() >= len(imageData) {
+		return imageData
+	}
+	return buf.Bytes()
+}
+
+// wrap returns client with every image scaled down before it is sent. A nil
+// preprocessor returns client unchanged.
+func (p *ImagePreprocessor) wrap(client RecipeClient) RecipeClient {
+	if p == nil || client == nil {
+		return client
+	}
+	return &preprocessedClient{RecipeClient: client, preprocessor: p}
+}
+
+// preprocessedClient is a RecipeClient whose images go through an
+// ImagePreprocessor.
+type preprocessedClient struct {
+	RecipeClient
+	preprocessor *ImagePreprocessor
+}
+
+func (c *preprocessedClient) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
+	return c.RecipeClient.IsFoodImage(ctx, c.preprocessor.prepare(imageData))
+}
+
+func (c *preprocessedClient) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	return c.RecipeClient.GenerateRecipe(ctx, c.preprocessor.prepare(imageData), dietaryPreference, cuisine)
+}
+
+func (c *preprocessedClient) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	prepared := make([][]byte, len(images))
+	for i, imageData := range images {
+		prepared[i] = c.preprocessor.prepare(imageData)
+	}
+	return c.RecipeClient.GenerateRecipeFromImages(ctx, prepared, dietaryPreference, cuisine)
+}
+
+func (c *preprocessedClient) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	return c.RecipeClient.GenerateShoppingCart(ctx, c.preprocessor.prepare(imageData))
+}
+
+func (c *preprocessedClient) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	return c.RecipeClient.ExtractIngredients(ctx, c.preprocessor.prepare(imageData))
+}
+
+func (c *preprocessedClient) ModerateImage(ctx context.Context, imageData []byte) error {
+	return c.RecipeClient.ModerateImage(ctx, c.preprocessor.prepare(imageData))
+}
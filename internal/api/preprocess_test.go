@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImagePreprocessor(t *testing.T) {
+	preprocessor := NewImagePreprocessor(100)
+
+	tests := []struct {
+		name      string
+		imageData []byte
+		format    string
+		width     int
+		height    int
+	}{
+		{"png", dishPNG, "png", 100, 1},
+		{"jpeg", dishJPEG, "jpeg", 100, 1},
+		{"small image", encodeTestPNG(t, 50, 80), "png", 50, 80},
+		{"tall image", encodeTestPNG(t, 20, 400), "png", 5, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prepared := preprocessor.prepare(tt.imageData)
+			config, format, err := image.DecodeConfig(bytes.NewReader(prepared))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.width, config.Width)
+			assert.Equal(t, tt.height, config.Height)
+		})
+	}
+
+	// Bytes that aren't an image are left for the engine to reject
+	assert.Equal(t, []byte("not an image"), preprocessor.prepare([]byte("not an image")))
+}
+
+func TestImagePreprocessor_Wrap(t *testing.T) {
+	var nilPreprocessor *ImagePreprocessor
+	client := &sizeRecordingClient{}
+	assert.Same(t, client, nilPreprocessor.wrap(client))
+
+	wrapped := NewImagePreprocessor(100).wrap(client)
+	_, _, err := wrapped.IsFoodImage(context.Background(), dishPNG)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, client.width)
+}
+
+// sizeRecordingClient records the width of the image sent to IsFoodImage.
+type sizeRecordingClient struct {
+	RecipeClient
+	width int
+}
+
+func (c *sizeRecordingClient) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(imageData))
+	c.width = config.Width
+	return true, "", err
+}
+
+// encodeTestPNG returns a blank PNG of the given size.
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// ErrQueueFull is returned by a queued engine when its queue has no room
+// left for another request.
+var ErrQueueFull = errors.New("engine queue is full")
+
+// defaultQueueRetryAfter is the Retry-After sent when a queue is full.
+const defaultQueueRetryAfter = 30 * time.Second
+
+// LLMQueue limits how many requests an engine works on at once, and how many
+// more may wait for it. Requests beyond that are turned away with
+// ErrQueueFull straight away, rather than piling up until they time out.
+type LLMQueue struct {
+	// running holds a token per request being worked on, and pending one per
+	// request running or waiting.
+	running chan struct{}
+	pending chan struct{}
+
+	rejected atomic.Int64
+
+	// RetryAfter is how long clients turned away are asked to wait.
+	RetryAfter time.Duration
+}
+
+// NewLLMQueue creates a queue that runs up to workers requests at once and
+// lets up to size more wait.
+func NewLLMQueue(workers, size int) *LLMQueue {
+	workers = max(workers, 1)
+	return &LLMQueue{
+		running:    make(chan struct{}, workers),
+		pending:    make(chan struct{}, workers+max(size, 0)),
+		RetryAfter: defaultQueueRetryAfter,
+	}
+}
+
+// acquire waits for the queue's turn, and returns a func that must be called
+// when the request is done.
+func (q *LLMQueue) acquire(ctx context.Context) (func(), error) {
+	select {
+	case q.pending <- struct{}{}:
+	default:
+		q.rejected.Add(1)
+		return nil, ErrQueueFull
+	}
+
+	select {
+	case q.running <- struct{}{}:
+		return func() {
+			<-q.running
+			<-q.pending
+		}, nil
+	case <-ctx.Done():
+		<-q.pending
+		return nil, ctx.Err()
+	}
+}
+
+// Depth returns the number of requests waiting for their turn.
+func (q *LLMQueue) Depth() int {
+	return len(q.pending) - len(q.running)
+}
+
+// wrap returns client with every call going through the queue. A nil queue
+// returns client unchanged.
+func (q *LLMQueue) wrap(client RecipeClient) RecipeClient {
+	if q == nil || client == nil {
+		return client
+	}
+	return &queuedClient{RecipeClient: client, queue: q}
+}
+
+// queuedClient is a RecipeClient whose calls wait in a LLMQueue. Warmup
+// skips the queue, since it's meant to run before traffic arrives.
+type queuedClient struct {
+	RecipeClient
+	queue *LLMQueue
+}
+
+func (c *queuedClient) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	defer release()
+	return c.RecipeClient.IsFoodImage(ctx, imageData)
+}
+
+func (c *queuedClient) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.GenerateRecipe(ctx, imageData, dietaryPreference, cuisine)
+}
+
+func (c *queuedClient) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.GenerateRecipeFromImages(ctx, images, dietaryPreference, cuisine)
+}
+
+func (c *queuedClient) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.GenerateShoppingCart(ctx, imageData)
+}
+
+func (c *queuedClient) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.ExtractIngredients(ctx, imageData)
+}
+
+func (c *queuedClient) RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.RegenerateShoppingCart(ctx, ingredients)
+}
+
+func (c *queuedClient) SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.RecipeClient.SuggestPairings(ctx, r)
+}
+
+func (c *queuedClient) DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return c.RecipeClient.DescribeImage(ctx, imageData, prompt)
+}
+
+func (c *queuedClient) ModerateImage(ctx context.Context, imageData []byte) error {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return c.RecipeClient.ModerateImage(ctx, imageData)
+}
+
+func (c *queuedClient) Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error) {
+	release, err := c.queue.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return c.RecipeClient.Chat(ctx, messages, onChunk)
+}
+
+// writeQueueFullError responds with 503 and a Retry-After header if err is
+// ErrQueueFull, and reports whether it did.
+func (h *Handler) writeQueueFullError(c *gin.Context, engine string, err error) bool {
+	if !errors.Is(err, ErrQueueFull) || h.LocalQueue == nil {
+		return false
+	}
+	seconds := int(math.Ceil(h.LocalQueue.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	setErrorClass(c, errorLLM)
+	c.String(http.StatusServiceUnavailable, fmt.Sprintf("%s is busy. Please try again in %d seconds.", engine, seconds))
+	return true
+}
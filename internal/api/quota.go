@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageDataLister lists the images stored in image_data, see RecipeStore.
+type imageDataLister interface {
+	GetImageDataHashes(ctx context.Context) ([]string, error)
+}
+
+// ImageQuota keeps the images directory under a maximum total size by
+// evicting the least recently used files. Only files that come back on their
+// own are evicted: recipe images with a copy in image_data, which ServeImage
+// restores, and cached thumbnails, which are generated again. Recipe images
+// only on disk, step images, non-food images and anything else are left
+// alone, but still count towards the total. Accesses are tracked in memory,
+// falling back to a file's modification time when it hasn't been served
+// since startup.
+type ImageQuota struct {
+	dir      string
+	maxBytes int64
+	store    imageDataLister
+
+	mu         sync.Mutex
+	lastAccess map[string]time.Time
+}
+
+// NewImageQuota creates a quota of maxBytes for the files under dir, which
+// evicts recipe images only if store has a copy of them. With a nil store
+// only thumbnails are evicted.
+func NewImageQuota(dir string, maxBytes int64, store imageDataLister) *ImageQuota {
+	return &ImageQuota{dir: dir, maxBytes: maxBytes, store: store, lastAccess: make(map[string]time.Time)}
+}
+
+// Touch records that the file at path was just served. A nil quota records
+// nothing.
+func (q *ImageQuota) Touch(path string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lastAccess[filepath.Clean(path)] = time.Now()
+}
+
+// Run enforces the quota every interval until ctx is done.
+func (q *ImageQuota) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if evicted, freed, err := q.Enforce(ctx); err != nil {
+			log.Printf("failed to enforce image quota: %s", err.Error())
+		} else if evicted > 0 {
+			log.Printf("Image quota: evicted %d files, freed %d bytes", evicted, freed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// imageFile is a file under the quota directory.
+type imageFile struct {
+	path       string
+	size       int64
+	lastAccess time.Time
+	// imageHash is set for recipe images, which may only be evicted if
+	// image_data has a copy.
+	imageHash string
+}
+
+// evictable reports whether the file at path, relative to the quota
+// directory, may be evicted: a recipe image, whose hash it returns, or a
+// cached thumbnail.
+func evictable(rel string) (imageHash string, ok bool) {
+	dir, name := filepath.Split(filepath.ToSlash(rel))
+	switch dir {
+	case "":
+		imageHash, _, ok := recipeImageName(name)
+		return imageHash, ok
+	case filepath.Base(thumbnailDir) + "/":
+		return "", true
+	}
+	return "", false
+}
+
+// storedImages returns the set of image hashes with a copy in image_data.
+func (q *ImageQuota) storedImages(ctx context.Context) (map[string]bool, error) {
+	stored := make(map[string]bool)
+	if q.store == nil {
+		return stored, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	hashes, err := q.store.GetImageDataHashes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, imageHash := range hashes {
+		stored[imageHash] = true
+	}
+	return stored, nil
+}
+
+// Enforce deletes the least recently used evictable files until the
+// directory is within the quota, and returns how many files it deleted and
+// their size. Accesses of files that no longer exist are forgotten.
+func (q *ImageQuota) Enforce(ctx context.Context) (evicted int, freed int64, err error) {
+	var files []imageFile
+	var total int64
+
+	q.mu.Lock()
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(q.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Temporary files are images still being written
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		seen[filepath.Clean(path)] = true
+
+		rel, err := filepath.Rel(q.dir, path)
+		if err != nil {
+			return nil
+		}
+		imageHash, ok := evictable(rel)
+		if !ok {
+			return nil
+		}
+		lastAccess := info.ModTime()
+		if accessed, ok := q.lastAccess[filepath.Clean(path)]; ok && accessed.After(lastAccess) {
+			lastAccess = accessed
+		}
+		files = append(files, imageFile{path: path, size: info.Size(), lastAccess: lastAccess, imageHash: imageHash})
+		return nil
+	})
+	if err == nil {
+		for path := range q.lastAccess {
+			if !seen[path] {
+				delete(q.lastAccess, path)
+			}
+		}
+	}
+	q.mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	if total <= q.maxBytes {
+		return 0, 0, nil
+	}
+	stored, err := q.storedImages(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].lastAccess.Before(files[j].lastAccess)
+	})
+	for _, file := range files {
+		if total <= q.maxBytes {
+			break
+		}
+		if file.imageHash != "" && !stored[file.imageHash] {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to evict image %s: %s", file.path, err.Error())
+			continue
+		}
+		q.mu.Lock()
+		delete(q.lastAccess, filepath.Clean(file.path))
+		q.mu.Unlock()
+
+		total -= file.size
+		freed += file.size
+		evicted++
+	}
+
+	return evicted, freed, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageQuota_ForgetsRemovedFiles(t *testing.T) {
+	dir := t.TempDir()
+	kept, removed := filepath.Join(dir, "kept.png"), filepath.Join(dir, "removed.png")
+	for _, path := range []string{kept, removed} {
+		assert.NoError(t, os.WriteFile(path, []byte("image"), 0644))
+	}
+
+	quota := NewImageQuota(dir, 1<<20, nil)
+	quota.Touch(kept)
+	quota.Touch(removed)
+	assert.NoError(t, os.Remove(removed))
+
+	_, _, err := quota.Enforce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kept}, slices.Collect(maps.Keys(quota.lastAccess)))
+}
+
+func TestServeImage_OutsideImagesDir(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assert.NoError(t, os.WriteFile("outside.png", []byte("not an image"), 0644))
+	defer os.Remove("outside.png")
+
+	h := &Handler{ImageQuota: NewImageQuota(t.TempDir(), 1<<20, nil)}
+	r := gin.New()
+	r.GET("/images/*filepath", h.ServeImage)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/images/../outside.png", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	// The file outside isn't even looked at
+	assert.Empty(t, h.ImageQuota.lastAccess)
+}
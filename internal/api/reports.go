@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// defaultReportArchiveThreshold is the number of reports after which a recipe
+// is archived, unless configured otherwise.
+const defaultReportArchiveThreshold = 5
+
+// maxReportReasonLength caps the length of a report reason.
+const maxReportReasonLength = 1000
+
+// reportRequest is the JSON body of POST /recipes/:image_hash/report.
+type reportRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReportRecipe handles reports of problematic recipes. Once a recipe has
+// ReportArchiveThreshold reports it is archived, hiding it from recipe lists
+// until a moderator looks at it.
+func (h *Handler) ReportRecipe(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	var req reportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || len(reason) > maxReportReasonLength {
+		c.String(http.StatusBadRequest, fmt.Sprintf("reason must be between 1 and %d characters", maxReportReasonLength))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	existing, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if existing == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	// A merged hash is reported against the recipe it was merged into
+	imageHash = existing.ImageHash
+	reports, err := h.RecipeStore.SaveReport(ctx, &recipe.Report{
+		ImageHash:  imageHash,
+		Reason:     reason,
+		ReporterIP: c.ClientIP(),
+	})
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	archived := existing.Archived
+	if !archived && h.ReportArchiveThreshold > 0 && reports >= h.ReportArchiveThreshold {
+		if err := h.RecipeStore.ArchiveRecipe(ctx, imageHash); err != nil {
+			h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+			return
+		}
+		log.Printf("Archived recipe %s after %d reports", imageHash, reports)
+		archived = true
+	}
+
+	h.writeJSON(c, http.StatusCreated, gin.H{"reports": reports, "archived": archived})
+}
+
+// GetReports handles GET /admin/reports, listing all recipe reports for
+// moderation, newest first.
+func (h *Handler) GetReports(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	reports, err := h.RecipeStore.GetReports(ctx)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, reports)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// defaultSimilarityThreshold is the number of differing perceptual hash bits,
+// out of pixelHashSize*pixelHashSize, up to which two images count as similar.
+const defaultSimilarityThreshold = 40
+
+// maxSimilarResults caps how many recipes SearchImages returns.
+const maxSimilarResults = 20
+
+// similarRecipe is a recipe found by SearchImages, with how close its image
+// is to the searched one.
+type similarRecipe struct {
+	Recipe *recipe.Recipe `json:"recipe"`
+	// Distance is the number of perceptual hash bits that differ, 0 for
+	// images that look the same.
+	Distance int `json:"distance"`
+	// Similarity is the share of bits that match, from 0 to 1.
+	Similarity float64 `json:"similarity"`
+}
+
+// SearchImages handles POST /images/search, a reverse image search: it
+// returns the recipes whose images look like the uploaded one, most similar
+// first. Nothing is generated or saved. ?threshold= overrides how many
+// perceptual hash bits may differ.
+func (h *Handler) SearchImages(c *gin.Context) {
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	threshold := h.SimilarityThreshold
+	if value := c.Query("threshold"); value != "" {
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold < 0 || threshold > pixelHashSize*pixelHashSize {
+			c.String(http.StatusBadRequest, fmt.Sprintf("threshold must be a whole number between 0 and %d", pixelHashSize*pixelHashSize))
+			return
+		}
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+	hash := perceptualHash(imageData)
+	if hash == "" {
+		c.String(http.StatusBadRequest, "Invalid image. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// A linear scan is fine for now: hashes are 32 bytes, so even many
+	// thousands of recipes compare in well under the query time.
+	stored, err := h.RecipeStore.GetPerceptualHashes(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	distances := make(map[string]int)
+	for imageHash, other := range stored {
+		if distance := hammingDistance(hash, other); distance >= 0 && distance <= threshold {
+			distances[imageHash] = distance
+		}
+	}
+
+	results := []similarRecipe{}
+	if len(distances) > 0 {
+		imageHashes := make([]string, 0, len(distances))
+		for imageHash := range distances {
+			imageHashes = append(imageHashes, imageHash)
+		}
+		recipes, err := h.RecipeStore.GetRecipesByHashes(ctx, imageHashes)
+		if err != nil {
+			h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+			return
+		}
+		for imageHash, r := range recipes {
+			distance := distances[imageHash]
+			results = append(results, similarRecipe{
+				Recipe:     r,
+				Distance:   distance,
+				Similarity: 1 - float64(distance)/float64(pixelHashSize*pixelHashSize),
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Recipe.ImageHash < results[j].Recipe.ImageHash
+	})
+	if len(results) > maxSimilarResults {
+		results = results[:maxSimilarResults]
+	}
+
+	h.writeJSON(c, http.StatusOK, results)
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// GetShoppingCart handles GET /recipes/:image_hash/shopping-cart, returning
+// just the shopping cart of a recipe.
+func (h *Handler) GetShoppingCart(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	locale, err := parseLocale(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, dbError(err), "Database query timed out after 5 seconds")
+			return
+		}
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	cart := localizeRecipe(r, locale).ShoppingCart
+	if cart == nil {
+		cart = map[string]string{}
+	}
+	h.writeJSON(c, http.StatusOK, cart)
+}
+
+// GenerateShoppingCart handles POST /shopping-cart. It asks the engine for only
+// the shopping list of the dish in the uploaded image, which is quicker than
+// generating a full recipe. Nothing is saved, but if a recipe already exists
+// for the image its shopping cart is returned instead.
+func (h *Handler) GenerateShoppingCart(c *gin.Context) {
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+	switch extension {
+	case ".jpeg", ".jpg", ".png":
+	default:
+		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	existing, err := h.RecipeStore.GetRecipeByImageHash(ctx, h.imageHash(imageData))
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if existing != nil && len(existing.ShoppingCart) > 0 {
+		h.writeJSON(c, http.StatusOK, existing.ShoppingCart)
+		return
+	}
+
+	cart, err := client.GenerateShoppingCart(ctx, imageData)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		if errors.Is(err, recipe.ErrNotFoodImage) {
+			c.String(http.StatusBadRequest, "Oops! That doesn't look like food. Snap a pic of a dish and we'll tell you what to buy.")
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned an incomplete shopping cart (%s). Please try again.", engine, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, cart)
+}
+
+// regenerateCartRequest is the JSON body of POST /recipes/:image_hash/regenerate-cart.
+type regenerateCartRequest struct {
+	// Ingredients are the recipe's current ingredients, which may have been edited.
+	Ingredients map[string]string `json:"ingredients" binding:"required"`
+}
+
+// RegenerateShoppingCart handles POST /recipes/:image_hash/regenerate-cart.
+// After the user edits a recipe's ingredients, it asks the engine for a new
+// shopping cart from the posted ingredients, text only, and saves it in place
+// of the old one. The stored ingredients are left alone.
+func (h *Handler) RegenerateShoppingCart(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+
+	var req regenerateCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+	if len(req.Ingredients) == 0 {
+		c.String(http.StatusBadRequest, "invalid request body: ingredients must not be empty")
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+
+	cart, err := client.RegenerateShoppingCart(ctx, req.Ingredients)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		if errors.Is(err, recipe.ErrInvalidRecipe) {
+			c.String(http.StatusBadGateway, fmt.Sprintf("%s returned an incomplete shopping cart (%s). Please try again.", engine, err.Error()))
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	if err := h.RecipeStore.SetShoppingCart(ctx, r.ImageHash, cart); err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("failed to save shopping cart: %s", err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, cart)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/platform/gemini"
+)
+
+// stepImageDir is where images attached to recipe steps are saved. They
+// are the only copy, with no image_data to restore them from, so the image
+// quota never evicts them.
+const stepImageDir = "images/steps"
+
+// UploadStepImage handles POST /recipes/:image_hash/steps/:n/image, attaching
+// an uploaded image to step n (1-based) of a recipe's instructions. Uploading
+// again replaces the step's image.
+func (h *Handler) UploadStepImage(c *gin.Context) {
+	imageHash := c.Param("image_hash")
+	step, err := strconv.Atoi(c.Param("n"))
+	if err != nil || step < 1 {
+		c.String(http.StatusBadRequest, "Step must be a positive number")
+		return
+	}
+
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+	switch extension {
+	case ".jpeg", ".jpg", ".png":
+	default:
+		c.String(http.StatusBadRequest, "Invalid file type. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	r, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if r == nil {
+		c.String(http.StatusNotFound, "Recipe not found")
+		return
+	}
+	if step > len(r.Instructions) {
+		c.String(http.StatusNotFound, fmt.Sprintf("Recipe has %d steps", len(r.Instructions)))
+		return
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	// Step images are content addressed like recipe images
+	imagePath, err := saveResizedImage(imageData, stepImageDir, gemini.GenerateImageHash(imageData), extension, savedImageWidth, nil)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("failed to save image: %s", err.Error()))
+		return
+	}
+
+	stepImages := make([]string, len(r.Instructions))
+	copy(stepImages, r.StepImages)
+	stepImages[step-1] = imagePath
+	if err := h.RecipeStore.SetStepImages(ctx, r.ImageHash, stepImages); err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	r.StepImages = stepImages
+
+	h.writeJSON(c, http.StatusOK, r)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snapchef/internal/recipe"
+)
+
+// streamFlushEvery is how many recipes StreamRecipes writes between flushes.
+const streamFlushEvery = 100
+
+// StreamRecipes handles GET /recipes/stream.ndjson, writing every recipe
+// matching the filters of GET /recipes as newline-delimited JSON, one recipe
+// per line. Recipes are written as they are read from the database and
+// flushed every streamFlushEvery lines, so the whole table can be streamed
+// without holding it in memory, and consumers get lines as they come.
+//
+// A failure before the first line is an error response. After it the status
+// is sent, so the failure is logged and the stream ends early.
+func (h *Handler) StreamRecipes(c *gin.Context) {
+	filter, err := h.parseRecipeFilter(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(c.Writer)
+	streamed := 0
+	err = h.RecipeStore.StreamRecipes(c.Request.Context(), filter, func(r *recipe.Recipe) error {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+		streamed++
+		if streamed%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+			return
+		}
+		log.Printf("recipe stream failed after %d recipes: %s", streamed, err.Error())
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// thumbnailDir is where generated thumbnails are cached.
+const thumbnailDir = "images/thumbs"
+
+// thumbnailWidths are the widths thumbnails can be requested in. Only a few
+// are allowed so clients can't fill the disk or burn CPU with arbitrary sizes.
+var thumbnailWidths = map[uint]bool{
+	100: true,
+	200: true,
+	400: true,
+}
+
+// ServeImage serves the files under ./images, a thumbnail of a recipe image
+// for paths of the form /images/:image_hash/thumb, and the image as uploaded
+// for /images/:image_hash/original. Images are served with long-lived cache
+// headers, see setImageCacheHeaders.
+//
+// They share one route because gin can't register /images/:image_hash/thumb
+// next to a static /images/*filepath route.
+func (h *Handler) ServeImage(c *gin.Context) {
+	// Nothing outside ./images is ever looked at, not even to check it exists
+	if slices.Contains(strings.Split(c.Param("filepath"), "/"), "..") {
+		c.String(http.StatusNotFound, "Image not found")
+		return
+	}
+	path := filepath.ToSlash(filepath.Clean("/" + c.Param("filepath")))
+	if imageHash, ok := strings.CutSuffix(strings.TrimPrefix(path, "/"), "/thumb"); ok {
+		h.thumbnail(c, imageHash)
+		return
+	}
+	if imageHash, ok := strings.CutSuffix(strings.TrimPrefix(path, "/"), "/original"); ok {
+		h.original(c, imageHash)
+		return
+	}
+
+	imagePath := filepath.Join("images", filepath.FromSlash(path))
+	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+		if restored := h.restoreImage(c.Request.Context(), path); restored != "" && restored != path {
+			c.Redirect(http.StatusMovedPermanently, "/images"+restored)
+			return
+		}
+	}
+	info, err := os.Stat(imagePath)
+	if err == nil && !info.IsDir() {
+		h.ImageQuota.Touch(imagePath)
+		setImageCacheHeaders(c, imagePath)
+	}
+	if _, _, ok := recipeImageName(path); ok && os.IsNotExist(err) && h.servePlaceholder(c) {
+		return
+	}
+	c.FileFromFS(path, gin.Dir("images", false))
+}
+
+// recipeImageName splits a path under /images into the image hash and file
+// extension of a recipe image. ok is false for any other path.
+func recipeImageName(path string) (imageHash, extension string, ok bool) {
+	name := strings.TrimPrefix(path, "/")
+	extension = filepath.Ext(name)
+	imageHash = strings.TrimSuffix(name, extension)
+	switch extension {
+	case ".jpeg", ".jpg", ".png":
+	default:
+		return "", "", false
+	}
+	return imageHash, extension, isImageHash(imageHash)
+}
+
+// servePlaceholder serves h.PlaceholderImage in place of a missing recipe
+// image, and reports whether it did. The placeholder isn't cached, so the
+// real image shows up as soon as it is back.
+func (h *Handler) servePlaceholder(c *gin.Context) bool {
+	if h.PlaceholderImage == "" {
+		return false
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.File(h.PlaceholderImage)
+	return true
+}
+
+// restoreImage saves a recipe image again from image_data, e.g. after the
+// image quota evicted it. path is the requested path under /images. The file
+// gets the extension of the stored image's format rather than the requested
+// one, and its path under /images is returned. Failures are logged and give
+// "", and the caller then serves a 404 as usual.
+func (h *Handler) restoreImage(ctx context.Context, path string) string {
+	imageHash, extension, ok := recipeImageName(path)
+	if !ok {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	encodedImage, err := h.RecipeStore.GetImageData(ctx, imageHash)
+	if err != nil || encodedImage == "" {
+		return ""
+	}
+	imageData, err := base64.StdEncoding.DecodeString(encodedImage)
+	if err != nil {
+		log.Printf("failed to decode stored image data %s: %s", imageHash, err.Error())
+		return ""
+	}
+
+	// .jpeg uploads keep their spelling, as the recipe's image path does
+	if stored := imageExtension(http.DetectContentType(imageData)); extension != ".jpeg" || stored != ".jpg" {
+		extension = stored
+	}
+	if _, err := os.Stat(recipeImagePath(imageHash, extension)); err == nil {
+		return "/" + imageHash + extension
+	}
+	if _, err := saveImage(imageData, imageHash, extension, h.Watermark); err != nil {
+		log.Printf("failed to restore image %s: %s", imageHash, err.Error())
+		return ""
+	}
+	log.Printf("Restored image %s from image_data", imageHash)
+	return "/" + imageHash + extension
+}
+
+// imageExtension returns the file extension for an image of the content type
+// http.DetectContentType gives: .png for PNGs and .jpg for anything else.
+func imageExtension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// isImageHash reports whether s is a hex SHA-256 image hash. Hashes end up in
+// file paths, so anything else must be rejected.
+func isImageHash(s string) bool {
+	decoded, err := hex.DecodeString(s)
+	return err == nil && len(decoded) == 32
+}
+
+// thumbnail serves the image of a recipe resized to the width given by ?w=.
+// Thumbnails are generated on first request and cached on disk.
+func (h *Handler) thumbnail(c *gin.Context, imageHash string) {
+	width, err := strconv.ParseUint(c.DefaultQuery("w", "200"), 10, 0)
+	if err != nil || !thumbnailWidths[uint(width)] {
+		c.String(http.StatusBadRequest, "Invalid width. Allowed widths are 100, 200 and 400.")
+		return
+	}
+
+	if !isImageHash(imageHash) {
+		c.String(http.StatusBadRequest, "Invalid image hash")
+		return
+	}
+
+	name := fmt.Sprintf("%s-%d", imageHash, width)
+	for _, extension := range []string{".jpg", ".png"} {
+		cachedPath := filepath.Join(thumbnailDir, name+extension)
+		if _, err := os.Stat(cachedPath); err == nil {
+			h.ImageQuota.Touch(cachedPath)
+			setImageCacheHeaders(c, cachedPath)
+			c.File(cachedPath)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	imageData, err := h.loadStoredImage(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to load image: %s", err.Error()))
+		return
+	}
+	if imageData == nil {
+		if !h.servePlaceholder(c) {
+			c.String(http.StatusNotFound, "Image not found")
+		}
+		return
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to decode image: %s", err.Error()))
+		return
+	}
+	extension := ".jpg"
+	if format == "png" {
+		extension = ".png"
+	}
+
+	// Never scale images up
+	if uint(config.Width) < uint(width) {
+		width = uint64(config.Width)
+	}
+
+	thumbPath, err := saveResizedImage(imageData, thumbnailDir, name, extension, uint(width), nil)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to create thumbnail: %s", err.Error()))
+		return
+	}
+
+	setImageCacheHeaders(c, thumbPath)
+	c.File(thumbPath)
+}
+
+// original serves a recipe image as it was uploaded, at full resolution,
+// from image_data.
+func (h *Handler) original(c *gin.Context, imageHash string) {
+	if !isImageHash(imageHash) {
+		c.String(http.StatusBadRequest, "Invalid image hash")
+		return
+	}
+	if h.DiscardOriginals {
+		c.String(http.StatusNotFound, "Original images aren't kept")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	encodedImage, err := h.RecipeStore.GetImageData(ctx, imageHash)
+	if err != nil {
+		h.writeError(c, dbError(err), fmt.Sprintf("database error: %s", err.Error()))
+		return
+	}
+	if encodedImage == "" {
+		c.String(http.StatusNotFound, "Image not found")
+		return
+	}
+	imageData, err := base64.StdEncoding.DecodeString(encodedImage)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("failed to decode image: %s", err.Error()))
+		return
+	}
+
+	contentType := http.DetectContentType(imageData)
+	extension := imageExtension(contentType)
+	setImageCacheHeaders(c, imageHash+"-original"+extension)
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s%s"`, imageHash, extension))
+	c.Data(http.StatusOK, contentType, imageData)
+}
+
+// setImageCacheHeaders lets clients cache an image forever. Image file names
+// are content hashes, so the file behind a URL never changes and the name
+// doubles as the ETag. Only call it for files that exist, so 404s aren't
+// cached.
+func setImageCacheHeaders(c *gin.Context, path string) {
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", `"`+filepath.Base(path)+`"`)
+}
+
+// loadStoredImage returns the stored image for the hash, either the saved
+// recipe image or an image uploaded through /imageencoder. It returns nil if
+// there is no image for the hash.
+func (h *Handler) loadStoredImage(ctx context.Context, imageHash string) ([]byte, error) {
+	recipe, err := h.RecipeStore.GetRecipeByImageHash(ctx, imageHash)
+	if err != nil {
+		return nil, err
+	}
+	if recipe != nil && recipe.ImagePath != "" {
+		imageData, err := os.ReadFile(recipe.ImagePath)
+		if err == nil {
+			return imageData, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	encodedImage, err := h.RecipeStore.GetImageData(ctx, imageHash)
+	if err != nil {
+		return nil, err
+	}
+	if encodedImage == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(encodedImage)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Validate handles POST /validate, a quick check of an image before it is
+// uploaded for a recipe. It runs only the engine's food check and inspects
+// the image; nothing is generated, saved or looked up in the database.
+func (h *Handler) Validate(c *gin.Context) {
+	file, err := formFile(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		return
+	}
+	if file.Size > maxImageSize {
+		c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("Image is too large. The maximum size is %d MB.", maxImageSize>>20))
+		return
+	}
+
+	engine := c.DefaultQuery("engine", h.defaultEngine())
+	client, err := h.engineClient(engine)
+	if err != nil {
+		if errors.Is(err, ErrEngineNotConfigured) {
+			c.String(http.StatusNotImplemented, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imageData, err := readFormFile(file)
+	if err != nil {
+		h.writeError(c, storageError(err), fmt.Sprintf("read image err: %s", err.Error()))
+		return
+	}
+
+	// Check the bytes rather than the file name, so a renamed file is caught
+	// before it costs a call to the engine
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil || (format != "jpeg" && format != "png") {
+		c.String(http.StatusBadRequest, "Invalid image. Only JPEG, JPG, and PNG images are allowed.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 45*time.Second)
+	defer cancel()
+
+	isFood, description, err := client.IsFoodImage(ctx, imageData)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.writeError(c, err, fmt.Sprintf("%s API call timed out after 45 seconds", engine))
+			return
+		}
+		if h.writeEngineError(c, engine, err) {
+			return
+		}
+		h.writeError(c, err, fmt.Sprintf("%s err: %s", engine, err.Error()))
+		return
+	}
+
+	h.writeJSON(c, http.StatusOK, gin.H{
+		"is_food":     isFood,
+		"description": description,
+		"dimensions":  gin.H{"width": config.Width, "height": config.Height},
+		"format":      format,
+		"bytes":       len(imageData),
+	})
+}
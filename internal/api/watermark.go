@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+
+	"github.com/nfnt/resize"
+)
+
+// Watermark positions.
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+)
+
+// Watermark is a logo drawn in a corner of saved recipe images. Only the
+// saved file carries it; the uploaded bytes, and so the image hash, don't.
+type Watermark struct {
+	logo     image.Image
+	position string
+}
+
+// NewWatermark loads a PNG logo to draw at the given corner, bottom-right if
+// position is empty.
+func NewWatermark(logoPath string, position string) (*Watermark, error) {
+	switch position {
+	case "":
+		position = WatermarkBottomRight
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight:
+	default:
+		return nil, fmt.Errorf("invalid watermark position %q", position)
+	}
+
+	f, err := os.Open(logoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watermark logo: %w", err)
+	}
+	defer f.Close()
+
+	logo, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode watermark logo: %w", err)
+	}
+	return &Watermark{logo: logo, position: position}, nil
+}
+
+// apply returns a copy of img with the logo drawn in its corner. The logo is
+// scaled down to at most a fifth of the image width, and keeps its own
+// transparency. A nil Watermark returns img unchanged.
+func (w *Watermark) apply(img image.Image) image.Image {
+	if w == nil {
+		return img
+	}
+
+	bounds := img.Bounds()
+	logo := w.logo
+	if maxWidth := uint(bounds.Dx() / 5); uint(logo.Bounds().Dx()) > maxWidth {
+		if maxWidth == 0 {
+			return img
+		}
+		logo = resize.Resize(maxWidth, 0, logo, resize.Lanczos3)
+	}
+	size := logo.Bounds().Size()
+	margin := max(bounds.Dx()/50, 1)
+
+	var at image.Point
+	switch w.position {
+	case WatermarkTopLeft:
+		at = image.Pt(bounds.Min.X+margin, bounds.Min.Y+margin)
+	case WatermarkTopRight:
+		at = image.Pt(bounds.Max.X-margin-size.X, bounds.Min.Y+margin)
+	case WatermarkBottomLeft:
+		at = image.Pt(bounds.Min.X+margin, bounds.Max.Y-margin-size.Y)
+	default:
+		at = image.Pt(bounds.Max.X-margin-size.X, bounds.Max.Y-margin-size.Y)
+	}
+
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	draw.Draw(out, image.Rectangle{Min: at, Max: at.Add(size)}, logo, logo.Bounds().Min, draw.Over)
+	return out
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLogo writes a solid red PNG logo and returns its path.
+func writeLogo(t *testing.T, width, height int) string {
+	logo := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(logo, logo.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	path := filepath.Join(t.TempDir(), "logo.png")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, logo))
+	assert.NoError(t, f.Close())
+	return path
+}
+
+// whiteImage returns an encoded white PNG.
+func whiteImage(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xc000 && g < 0x4000 && b < 0x4000
+}
+
+func TestWatermark_Positions(t *testing.T) {
+	logoPath := writeLogo(t, 40, 20)
+	src, _, err := image.Decode(bytes.NewReader(whiteImage(t, 400, 200)))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		position string
+		inside   image.Point
+		outside  image.Point
+	}{
+		{"", image.Pt(380, 185), image.Pt(20, 15)},
+		{WatermarkBottomRight, image.Pt(380, 185), image.Pt(20, 15)},
+		{WatermarkTopLeft, image.Pt(20, 15), image.Pt(380, 185)},
+		{WatermarkTopRight, image.Pt(380, 15), image.Pt(20, 185)},
+		{WatermarkBottomLeft, image.Pt(20, 185), image.Pt(380, 15)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			watermark, err := NewWatermark(logoPath, tt.position)
+			assert.NoError(t, err)
+
+			out := watermark.apply(src)
+			assert.True(t, isRed(out.At(tt.inside.X, tt.inside.Y)))
+			assert.False(t, isRed(out.At(tt.outside.X, tt.outside.Y)))
+			// The source image is left alone
+			assert.False(t, isRed(src.At(tt.inside.X, tt.inside.Y)))
+		})
+	}
+
+	_, err = NewWatermark(logoPath, "center")
+	assert.Error(t, err)
+	_, err = NewWatermark(filepath.Join(t.TempDir(), "missing.png"), "")
+	assert.Error(t, err)
+}
+
+func TestWatermark_ScalesLargeLogos(t *testing.T) {
+	watermark, err := NewWatermark(writeLogo(t, 600, 60), "")
+	assert.NoError(t, err)
+	src, _, err := image.Decode(bytes.NewReader(whiteImage(t, 400, 200)))
+	assert.NoError(t, err)
+
+	out := watermark.apply(src)
+	// Scaled to 80x8 and drawn 8px from the corner
+	assert.True(t, isRed(out.At(395-8-40, 200-8-4)))
+	assert.False(t, isRed(out.At(400-8-80-5, 200-8-4)))
+}
+
+func TestSaveImage_Watermark(t *testing.T) {
+	watermark, err := NewWatermark(writeLogo(t, 100, 40), WatermarkBottomRight)
+	assert.NoError(t, err)
+	inTempDir(t)
+
+	imageData := whiteImage(t, 1000, 500)
+	for _, extension := range []string{".png", ".jpg"} {
+		t.Run(extension, func(t *testing.T) {
+			imagePath, err := saveImage(imageData, "hash", extension, watermark)
+			assert.NoError(t, err)
+
+			f, err := os.Open(imagePath)
+			assert.NoError(t, err)
+			defer f.Close()
+			saved, _, err := image.Decode(f)
+			assert.NoError(t, err)
+			assert.Equal(t, savedImageWidth, saved.Bounds().Dx())
+			assert.True(t, isRed(saved.At(savedImageWidth-20, 400-20)))
+			assert.False(t, isRed(saved.At(20, 20)))
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"snapchef/internal/recipe"
+)
+
+// ErrNotFoodImage is returned when the image does not contain food.
+var ErrNotFoodImage = recipe.ErrNotFoodImage
+
+const (
+	defaultAPIURL      = "https://api.anthropic.com/v1/messages"
+	defaultModel       = "claude-3-5-sonnet-latest"
+	defaultTemperature = 1
+	anthropicAPIVer    = "2023-06-01"
+)
+
+// Client is a client for the Anthropic Claude messages API.
+type Client struct {
+	httpClient  *http.Client
+	apiURL      string
+	apiKey      string
+	model       string
+	temperature float64
+
+	// FoodCheckPrompt is the prompt IsFoodImage sends with the image. It defaults to recipe.FoodCheckPrompt.
+	FoodCheckPrompt string
+}
+
+// NewClient creates a new Claude client.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		httpClient:      &http.Client{},
+		apiURL:          defaultAPIURL,
+		apiKey:          apiKey,
+		model:           defaultModel,
+		temperature:     defaultTemperature,
+		FoodCheckPrompt: recipe.FoodCheckPrompt,
+	}
+}
+
+// Request represents the request body for the messages API.
+type Request struct {
+	Model       string    `json:"model"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+}
+
+// Message represents a message in the request.
+type Message struct {
+	Role    string    `json:"role"`
+	Content []Content `json:"content"`
+}
+
+// Content represents a content block of a message.
+type Content struct {
+	Type   string       `json:"type"`
+	Text   string       `json:"text,omitempty"`
+	Source *ImageSource `json:"source,omitempty"`
+}
+
+// ImageSource represents an inline base64 image.
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// Response represents the response from the messages API.
+type Response struct {
+	Content    []Content `json:"content"`
+	StopReason string    `json:"stop_reason"`
+}
+
+// GenerateContent sends the images and prompt to Claude and returns the text response.
+func (c *Client) GenerateContent(ctx context.Context, text string, images ...[]byte) (string, error) {
+	var content []Content
+	for _, imageData := range images {
+		content = append(content, Content{
+			Type: "image",
+			Source: &ImageSource{
+				Type:      "base64",
+				MediaType: http.DetectContentType(imageData),
+				Data:      base64.StdEncoding.EncodeToString(imageData),
+			},
+		})
+	}
+	content = append(content, Content{
+		Type: "text",
+		Text: text,
+	})
+
+	return c.complete(ctx, "", []Message{
+		{
+			Role:    "user",
+			Content: content,
+		},
+	})
+}
+
+// complete sends the system prompt, if any, and the messages to Claude and
+// returns the text response.
+func (c *Client) complete(ctx context.Context, system string, messages []Message) (string, error) {
+	reqBody := Request{
+		Model:       c.model,
+		MaxTokens:   1024,
+		Temperature: c.temperature,
+		System:      system,
+		Messages:    messages,
+	}
+
+	reqBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVer)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("received non-OK status code: %d", resp.StatusCode)
+	}
+
+	var claudeResp Response
+	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
+		return "", fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	for _, block := range claudeResp.Content {
+		if block.Type == "text" {
+			return block.Text, nil
+		}
+	}
+
+	return "", fmt.Errorf("empty response from Claude")
+}
+
+// Chat continues a conversation about a recipe. The reply isn't streamed, so
+// onChunk is called once with the whole reply, which is also returned. The
+// last message is the one being answered.
+func (c *Client) Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error) {
+	system, messages := recipe.SplitSystemMessage(messages)
+	converted := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		converted = append(converted, Message{
+			Role:    message.Role,
+			Content: []Content{{Type: "text", Text: message.Content}},
+		})
+	}
+
+	reply, err := c.complete(ctx, system, converted)
+	if err != nil {
+		return "", err
+	}
+	onChunk(reply)
+	return reply, nil
+}
+
+// Warmup sends a tiny text-only request so the model is loaded before the
+// first real request.
+func (c *Client) Warmup(ctx context.Context) error {
+	if _, err := c.GenerateContent(ctx, "Reply with OK."); err != nil {
+		return fmt.Errorf("warmup request failed: %w", err)
+	}
+	return nil
+}
+
+// IsFoodImage checks if the given image contains food and returns a description.
+func (c *Client) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
+	prompt := c.FoodCheckPrompt
+
+	text, err := c.GenerateContent(ctx, prompt, imageData)
+	if err != nil {
+		return false, "", err
+	}
+
+	if recipe.IsNotFoodDescription(text) {
+		return false, text, nil // Return the actual response text as description
+	}
+	return true, text, nil
+}
+
+// DescribeImage returns the model's answer to prompt about the image as it
+// is, without any parsing.
+func (c *Client) DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error) {
+	return c.GenerateContent(ctx, prompt, imageData)
+}
+
+// ModerateImage checks the image for inappropriate content. It returns a
+// *recipe.ModerationError if the image is flagged.
+func (c *Client) ModerateImage(ctx context.Context, imageData []byte) error {
+	text, err := c.GenerateContent(ctx, recipe.ModerationPrompt, imageData)
+	if err != nil {
+		return err
+	}
+	return recipe.ParseModeration(text)
+}
+
+// GenerateShoppingCart generates only the shopping list for the dish in an image.
+func (c *Client) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	text, err := c.GenerateContent(ctx, recipe.ShoppingCartPrompt, imageData)
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseShoppingCart(text)
+}
+
+// SuggestPairings suggests drinks to go with a recipe, from text alone.
+func (c *Client) SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error) {
+	text, err := c.GenerateContent(ctx, recipe.PairingsPrompt(r))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParsePairings(text, r.DietaryPreference)
+}
+
+// ExtractIngredients lists the ingredients visible in an image, with estimated quantities.
+func (c *Client) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	text, err := c.GenerateContent(ctx, recipe.IngredientsPrompt, imageData)
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseIngredients(text)
+}
+
+// RegenerateShoppingCart generates the shopping list for a recipe's
+// ingredients, from text alone.
+func (c *Client) RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error) {
+	text, err := c.GenerateContent(ctx, recipe.IngredientsShoppingCartPrompt(ingredients))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseShoppingCart(text)
+}
+
+// GenerateRecipe generates a recipe from an image.
+func (c *Client) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	return c.GenerateRecipeFromImages(ctx, [][]byte{imageData}, dietaryPreference, cuisine)
+}
+
+// GenerateRecipeFromImages generates a single recipe from several images of the same dish.
+func (c *Client) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images provided")
+	}
+
+	promptText := "I need a recipe for the food item in this image. Please return a single, clean JSON object with the following keys and data types: 'title' (string), 'cuisine' (string), 'dietary_preference' (string), 'cooking_time' (string), 'servings' (string), 'meal_type' (string, one of 'breakfast', 'lunch', 'dinner', 'snack' or 'dessert'), 'difficulty' (string, one of 'easy', 'medium' or 'hard'), 'ingredients' (map of ingredient names to quantities), 'instructions' (array of step objects, each with 'text' (string) and, when the step has them, 'duration_minutes' (number) and 'temp_celsius' (number)), 'shopping_cart' (map of ingredient names to quantities), 'confidence' (number from 0 to 1, how sure you are the recipe matches the dish) and 'notes' (string, any assumptions you made, e.g. \"couldn't identify the sauce, assumed marinara\"). The JSON response should be clean and not contain any markdown formatting (e.g., ```json)."
+
+	if dietaryPreference != "" {
+		promptText += fmt.Sprintf(" The recipe should be %s.", dietaryPreference)
+	}
+	if cuisine != "" {
+		promptText += fmt.Sprintf(" The recipe should be %s cuisine.", cuisine)
+	}
+	if servings := recipe.ServingsFromContext(ctx); servings > 0 {
+		promptText += fmt.Sprintf(" Scale the recipe for %d servings.", servings)
+	}
+	promptText += recipe.StyleInstruction(ctx)
+	promptText += recipe.LanguageInstruction(ctx)
+	promptText += recipe.ExclusionInstruction(ctx)
+	promptText += recipe.NotesInstruction(ctx)
+	promptText += recipe.NotFoodInstruction
+	if len(images) > 1 {
+		promptText = "These images all show the same dish from different angles. " + promptText
+	}
+
+	jsonString, err := c.GenerateContent(ctx, promptText, images...)
+	if err != nil {
+		return nil, err
+	}
+	if recipe.IsNotFoodReply(jsonString) {
+		return nil, ErrNotFoodImage
+	}
+
+	// Extract the JSON from the response, which might be wrapped in markdown
+	cleanJSON, err := recipe.ExtractRecipeJSON(jsonString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the JSON into a Recipe struct
+	var r recipe.Recipe
+	if err := json.Unmarshal([]byte(cleanJSON), &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal recipe JSON: %w. Raw response: %s", err, cleanJSON)
+	}
+
+	r.Cuisine = cuisine
+	r.DietaryPreference = dietaryPreference
+	r.Model = c.model
+	r.Temperature = c.temperature
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
@@ -4,31 +4,273 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
 	"snapchef/internal/recipe"
 )
 
 // ErrNotFoodImage is returned when the image does not contain food.
-var ErrNotFoodImage = fmt.Errorf("image does not contain food")
+var ErrNotFoodImage = recipe.ErrNotFoodImage
+
+// ErrQuotaExceeded is matched by the errors returned when Gemini rejects a
+// request with a quota or rate limit error.
+var ErrQuotaExceeded = recipe.ErrQuotaExceeded
+
+// ErrUnknownModel is returned by CheckModel when Gemini doesn't know the
+// client's model.
+var ErrUnknownModel = errors.New("unknown Gemini model")
+
+const (
+	defaultModel       = "gemini-1.5-flash"
+	defaultTemperature = 1
+)
 
 // Client is a client for the Gemini API.
 type Client struct {
-	model *genai.GenerativeModel
+	client      *genai.Client
+	model       *genai.GenerativeModel
+	modelName   string
+	temperature float32
+
+	// overrides caches the models requested with recipe.WithModel, by name.
+	mu        sync.Mutex
+	overrides map[string]*genai.GenerativeModel
+
+	// FoodCheckPrompt is the prompt IsFoodImage sends with the image. It defaults to recipe.FoodCheckPrompt.
+	FoodCheckPrompt string
+
+	// JSONSchema has recipes generated in Gemini's JSON mode with a response
+	// schema, so the reply is always a JSON recipe rather than prose that
+	// hopefully contains one. Models that reject the schema are asked again
+	// without it.
+	JSONSchema bool
+
+	// JSONRetries is how many times a recipe whose reply isn't valid JSON is
+	// asked for again, with a stricter prompt. It defaults to
+	// recipe.DefaultJSONRetries.
+	JSONRetries int
+	reprompts   atomic.Int64
+
+	// Sampler records a share of the prompts sent to Gemini, including
+	// follow-ups in chats, and their responses. Nil records none.
+	Sampler *recipe.PromptSampler
 }
 
-// NewClient creates a new Gemini client.
-func NewClient(ctx context.Context, apiKey string) (*Client, error) {
+// NewClient creates a new Gemini client using the model modelName, or
+// gemini-1.5-flash if it is empty. The model isn't checked until it is used;
+// see CheckModel.
+func NewClient(ctx context.Context, apiKey string, modelName string) (*Client, error) {
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return nil, err
 	}
-	return &Client{model: client.GenerativeModel("gemini-1.5-flash")}, nil
+	if modelName == "" {
+		modelName = defaultModel
+	}
+	model := client.GenerativeModel(modelName)
+	model.SetTemperature(defaultTemperature)
+	return &Client{client: client, model: model, modelName: modelName, temperature: defaultTemperature, FoodCheckPrompt: recipe.FoodCheckPrompt, JSONRetries: recipe.DefaultJSONRetries}, nil
+}
+
+// Model returns the name of the model recipes are generated with by default.
+func (c *Client) Model() string {
+	return c.modelName
+}
+
+// CheckModel looks the client's model up with Gemini. It returns an error
+// matching ErrUnknownModel if Gemini doesn't know it (a 404), and other
+// errors, such as an invalid API key or a network failure, as they are.
+func (c *Client) CheckModel(ctx context.Context) error {
+	_, err := c.model.Info(ctx)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return fmt.Errorf("%w %q: %w", ErrUnknownModel, c.modelName, err)
+	}
+	return err
+}
+
+// Reprompts returns how many times recipes were asked for again because the
+// reply wasn't valid JSON.
+func (c *Client) Reprompts() int64 {
+	return c.reprompts.Load()
+}
+
+// generativeModel returns the model to use for a request: the one asked for
+// with recipe.WithModel, or the default one. Requested models share the
+// default's settings and are created once per name.
+func (c *Client) generativeModel(ctx context.Context) (*genai.GenerativeModel, string) {
+	name := recipe.ModelFromContext(ctx, c.modelName)
+	if name == c.modelName {
+		return c.model, name
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	model, ok := c.overrides[name]
+	if !ok {
+		model = c.client.GenerativeModel(name)
+		model.SetTemperature(c.temperature)
+		if c.overrides == nil {
+			c.overrides = make(map[string]*genai.GenerativeModel)
+		}
+		c.overrides[name] = model
+	}
+	return model, name
+}
+
+// quotaError turns Gemini's 429 responses into a *recipe.QuotaError, taking
+// the retry delay from the RetryInfo error detail or the Retry-After header.
+// Other errors are returned unchanged.
+func quotaError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return err
+	}
+
+	quotaErr := &recipe.QuotaError{Err: err}
+	for _, detail := range apiErr.Details {
+		fields, ok := detail.(map[string]interface{})
+		if !ok || !strings.HasSuffix(fmt.Sprint(fields["@type"]), "google.rpc.RetryInfo") {
+			continue
+		}
+		if delay, err := time.ParseDuration(fmt.Sprint(fields["retryDelay"])); err == nil {
+			quotaErr.RetryAfter = delay
+		}
+	}
+	if quotaErr.RetryAfter == 0 {
+		if seconds, err := strconv.Atoi(apiErr.Header.Get("Retry-After")); err == nil {
+			quotaErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return quotaErr
+}
+
+// generateContent is model.GenerateContent, offering the exchange to the
+// Sampler.
+func (c *Client) generateContent(ctx context.Context, model *genai.GenerativeModel, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	resp, err := model.GenerateContent(ctx, parts...)
+	c.sample(ctx, []*genai.Content{{Role: "user", Parts: parts}}, func() string { return responseText(resp) }, err)
+	return resp, err
+}
+
+// sendMessage is session.SendMessage, offering the exchange, along with the
+// history it was sent with, to the Sampler.
+func (c *Client) sendMessage(ctx context.Context, session *genai.ChatSession, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	sent := append(slices.Clip(session.History), &genai.Content{Role: "user", Parts: parts})
+	resp, err := session.SendMessage(ctx, parts...)
+	c.sample(ctx, sent, func() string { return responseText(resp) }, err)
+	return resp, err
+}
+
+// sample offers an exchange to the Sampler: the contents sent, ending with
+// the new message, and the reply, or the error returned instead. The turns
+// of a chat are labelled with their role, as the local LLM's are.
+func (c *Client) sample(ctx context.Context, sent []*genai.Content, reply func() string, err error) {
+	c.Sampler.Sample(ctx, func() *recipe.PromptSample {
+		sample := &recipe.PromptSample{Engine: "gemini", Model: recipe.ModelFromContext(ctx, c.modelName)}
+		var prompt []string
+		for _, content := range sent {
+			for _, part := range content.Parts {
+				switch part := part.(type) {
+				case genai.Text:
+					if len(sent) > 1 {
+						prompt = append(prompt, content.Role+": "+string(part))
+					} else {
+						prompt = append(prompt, string(part))
+					}
+				case genai.Blob:
+					sample.ImageHashes = append(sample.ImageHashes, recipe.HashImage(part.Data))
+				}
+			}
+		}
+		sample.Prompt = strings.Join(prompt, "\n")
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			sample.Response = reply()
+		}
+		return sample
+	})
+}
+
+// responseText returns all the text of the first candidate of a response.
+func responseText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if part, ok := part.(genai.Text); ok {
+			text.WriteString(string(part))
+		}
+	}
+	return text.String()
+}
+
+// generateError maps an error from GenerateContent. A prompt or response
+// blocked by Gemini's safety or recitation filters is wrapped in
+// recipe.ErrContentBlocked, and quota errors go through quotaError.
+func generateError(err error) error {
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return fmt.Errorf("%w: %s", recipe.ErrContentBlocked, blocked.Error())
+	}
+	return quotaError(err)
+}
+
+// finishReasonError returns an error for a candidate that didn't finish
+// normally, so a cut-off or blocked response isn't mistaken for a malformed
+// one. It returns nil for a normal stop or no candidate at all.
+func finishReasonError(resp *genai.GenerateContentResponse) error {
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	switch reason := resp.Candidates[0].FinishReason; reason {
+	case genai.FinishReasonMaxTokens:
+		return fmt.Errorf("%w: Gemini stopped at the maximum number of output tokens", recipe.ErrResponseTruncated)
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation:
+		return fmt.Errorf("%w: candidate: %s", recipe.ErrContentBlocked, reason)
+	default:
+		return nil
+	}
+}
+
+// generateText sends a prompt and returns the text of the reply, which what
+// describes in errors. Blocked and cut-off replies are reported like they
+// are for recipes.
+func (c *Client) generateText(ctx context.Context, what string, parts ...genai.Part) (string, error) {
+	model, _ := c.generativeModel(ctx)
+	resp, err := c.generateContent(ctx, model, parts...)
+	if err != nil {
+		return "", generateError(err)
+	}
+	if err := finishReasonError(resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("empty response from Gemini for %s", what)
+	}
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("unexpected response format from Gemini for %s", what)
+	}
+	return string(text), nil
 }
 
 // GenerateImageHash calculates the SHA256 hash of the image data.
@@ -37,20 +279,45 @@ func GenerateImageHash(imageData []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// GenerateImagesHash calculates a single hash for several images of the same
+// dish. The result doesn't depend on the order of the images.
+func GenerateImagesHash(images [][]byte) string {
+	hashes := make([]string, 0, len(images))
+	for _, imageData := range images {
+		hashes = append(hashes, GenerateImageHash(imageData))
+	}
+	sort.Strings(hashes)
+	return GenerateImageHash([]byte(strings.Join(hashes, "")))
+}
+
+// Warmup sends a tiny text-only request so the first real request doesn't
+// pay for connection setup.
+func (c *Client) Warmup(ctx context.Context) error {
+	model, _ := c.generativeModel(ctx)
+	if _, err := model.GenerateContent(ctx, genai.Text("Reply with OK.")); err != nil {
+		return fmt.Errorf("warmup request failed: %w", quotaError(err))
+	}
+	return nil
+}
+
 // IsFoodImage checks if the given image contains food and returns a description.
 func (c *Client) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
 	prompt := []genai.Part{
 		genai.ImageData("png", imageData),
 		// genai.Text("Does this image contain food? If yes, provide a brief description of the receipe. If no, just respond with 'NO' followed by a very short description of the image."),
-		genai.Text("Analyze the provided image. If it contains food, return a brief recipe description. If not, respond with 'NO' followed by a 5-word description of the image content."),
+		genai.Text(c.FoodCheckPrompt),
 	}
 
-	resp, err := c.model.GenerateContent(ctx, prompt...)
+	model, _ := c.generativeModel(ctx)
+	resp, err := c.generateContent(ctx, model, prompt...)
 	if err != nil {
+		return false, "", generateError(err)
+	}
+	if err := finishReasonError(resp); err != nil {
 		return false, "", err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
 		return false, "", fmt.Errorf("empty response from Gemini for food check")
 	}
 
@@ -59,27 +326,95 @@ func (c *Client) IsFoodImage(ctx context.Context, imageData []byte) (bool, strin
 		return false, "", fmt.Errorf("unexpected response format from Gemini for food check")
 	}
 
-	response := strings.ToLower(strings.TrimSpace(string(text)))
-	if strings.HasPrefix(response, "no") {
+	if recipe.IsNotFoodDescription(string(text)) {
 		return false, string(text), nil // Return the actual response text as description
 	}
 	return true, string(text), nil
 }
 
-// GenerateRecipe generates a recipe from an image.
-func (c *Client) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
-	// First, validate if the image contains food
-	isFood, _, err := c.IsFoodImage(ctx, imageData)
+// DescribeImage returns Gemini's answer to prompt about the image as it is,
+// without any parsing.
+func (c *Client) DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error) {
+	return c.generateText(ctx, "description", genai.ImageData("png", imageData), genai.Text(prompt))
+}
+
+// ModerateImage checks the image for inappropriate content, using both the
+// moderation prompt and Gemini's own safety filters. It returns a
+// *recipe.ModerationError if the image is flagged.
+func (c *Client) ModerateImage(ctx context.Context, imageData []byte) error {
+	model, _ := c.generativeModel(ctx)
+	resp, err := c.generateContent(ctx, model, genai.ImageData("png", imageData), genai.Text(recipe.ModerationPrompt))
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if image is food: %w", err)
+		// Gemini refusing to look at the image is as good as a flag
+		var blocked *genai.BlockedError
+		if errors.As(err, &blocked) {
+			return &recipe.ModerationError{Reason: blocked.Error()}
+		}
+		return quotaError(err)
 	}
-	if !isFood {
-		return nil, ErrNotFoodImage
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return fmt.Errorf("empty response from Gemini for moderation")
+	}
+
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return fmt.Errorf("unexpected response format from Gemini for moderation")
+	}
+	return recipe.ParseModeration(string(text))
+}
+
+// GenerateShoppingCart generates only the shopping list for the dish in an image.
+func (c *Client) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	text, err := c.generateText(ctx, "shopping cart", genai.ImageData("png", imageData), genai.Text(recipe.ShoppingCartPrompt))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseShoppingCart(text)
+}
+
+// SuggestPairings suggests drinks to go with a recipe, from text alone.
+func (c *Client) SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error) {
+	text, err := c.generateText(ctx, "pairings", genai.Text(recipe.PairingsPrompt(r)))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParsePairings(text, r.DietaryPreference)
+}
+
+// ExtractIngredients lists the ingredients visible in an image, with estimated quantities.
+func (c *Client) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	text, err := c.generateText(ctx, "ingredients", genai.ImageData("png", imageData), genai.Text(recipe.IngredientsPrompt))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseIngredients(text)
+}
+
+// RegenerateShoppingCart generates the shopping list for a recipe's
+// ingredients, from text alone.
+func (c *Client) RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error) {
+	text, err := c.generateText(ctx, "shopping cart", genai.Text(recipe.IngredientsShoppingCartPrompt(ingredients)))
+	if err != nil {
+		return nil, err
+	}
+	return recipe.ParseShoppingCart(text)
+}
+
+// GenerateRecipe generates a recipe from an image.
+func (c *Client) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	return c.GenerateRecipeFromImages(ctx, [][]byte{imageData}, dietaryPreference, cuisine)
+}
+
+// GenerateRecipeFromImages generates a single recipe from several images of the same dish.
+func (c *Client) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images provided")
 	}
 
 	// Build the prompt with optional dietary preferences and cuisine
 	// Original -- promptText := "Generate a recipe based on the food item in this image. The response should be a JSON object with four keys: 'title', 'cuisine', 'dietary_preference', 'ingredients', 'instructions', and 'shopping_cart'. 'title' should be a string, 'cuisine' should be a string, 'dietary_preference' should be a list of strings,'ingredients' should be a map of ingredient names to their quantities, 'instructions' should be an array of strings, and 'shopping_cart' should be a map of ingredient names to their quantities. The JSON response should be clean and not contain any markdown formatting (e.g., ```json).";
-	promptText := "I need a recipe for the food item in this image. Please return a single, clean JSON object with the following keys and data types: 'title' (string), 'cuisine' (string), 'dietary_preference' (string), 'cooking_time' (string), 'servings' (string), 'ingredients' (map of ingredient names to quantities), 'instructions' (array of strings), and 'shopping_cart' (map of ingredient names to quantities). .The JSON response should be clean and not contain any markdown formatting (e.g., ```json)."
+	promptText := "I need a recipe for the food item in this image. Please return a single, clean JSON object with the following keys and data types: 'title' (string), 'cuisine' (string), 'dietary_preference' (string), 'cooking_time' (string), 'servings' (string), 'meal_type' (string, one of 'breakfast', 'lunch', 'dinner', 'snack' or 'dessert'), 'difficulty' (string, one of 'easy', 'medium' or 'hard'), 'ingredients' (map of ingredient names to quantities), 'instructions' (array of step objects, each with 'text' (string) and, when the step has them, 'duration_minutes' (number) and 'temp_celsius' (number)), 'shopping_cart' (map of ingredient names to quantities), 'confidence' (number from 0 to 1, how sure you are the recipe matches the dish) and 'notes' (string, any assumptions you made, e.g. \"couldn't identify the sauce, assumed marinara\"). .The JSON response should be clean and not contain any markdown formatting (e.g., ```json)."
 
 	if dietaryPreference != "" {
 		promptText += fmt.Sprintf(" The recipe should be %s.", dietaryPreference)
@@ -87,44 +422,207 @@ func (c *Client) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPr
 	if cuisine != "" {
 		promptText += fmt.Sprintf(" The recipe should be %s cuisine.", cuisine)
 	}
+	if servings := recipe.ServingsFromContext(ctx); servings > 0 {
+		promptText += fmt.Sprintf(" Scale the recipe for %d servings.", servings)
+	}
+	promptText += recipe.StyleInstruction(ctx)
+	promptText += recipe.LanguageInstruction(ctx)
+	promptText += recipe.ExclusionInstruction(ctx)
+	promptText += recipe.NotesInstruction(ctx)
+	promptText += recipe.NotFoodInstruction
+	if len(images) > 1 {
+		promptText = "These images all show the same dish from different angles. " + promptText
+	}
 
-	prompt := []genai.Part{
-		genai.ImageData("png", imageData),
-		genai.Text(promptText),
+	var prompt []genai.Part
+	for _, imageData := range images {
+		prompt = append(prompt, genai.ImageData("png", imageData))
 	}
+	prompt = append(prompt, genai.Text(promptText))
 
-	resp, err := c.model.GenerateContent(ctx, prompt...)
+	model, modelName := c.generativeModel(ctx)
+	if c.JSONSchema {
+		model = withRecipeSchema(model)
+	}
+	jsonString, err := c.generateRecipeText(ctx, model, prompt)
+	if err != nil && c.JSONSchema && isSchemaRejected(err) {
+		log.Printf("Gemini model %s rejected the recipe schema, retrying without it: %s", modelName, err.Error())
+		model = withoutRecipeSchema(model)
+		jsonString, err = c.generateRecipeText(ctx, model, prompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseRecipeReply(jsonString)
+	for retries := 0; errors.Is(err, recipe.ErrMalformedJSON) && retries < c.JSONRetries; retries++ {
+		c.reprompts.Add(1)
+		log.Printf("Gemini model %s returned a recipe that isn't valid JSON, asking again: %s", modelName, err.Error())
+		if jsonString, err = c.reformatRecipeText(ctx, model, prompt, jsonString); err != nil {
+			return nil, err
+		}
+		r, err = parseRecipeReply(jsonString)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("empty response from Gemini")
+	r.Cuisine = cuisine
+	r.DietaryPreference = dietaryPreference
+	r.Model = modelName
+	r.Temperature = float64(c.temperature)
+
+	if err := r.Validate(); err != nil {
+		return nil, err
 	}
 
-	jsonString, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return nil, fmt.Errorf("unexpected response format from Gemini")
+	return r, nil
+}
+
+// parseRecipeReply returns the recipe in a reply to a recipe prompt. The JSON
+// might be wrapped in markdown when it wasn't generated with the schema.
+func parseRecipeReply(reply string) (*recipe.Recipe, error) {
+	if recipe.IsNotFoodReply(reply) {
+		return nil, ErrNotFoodImage
+	}
+	reply, isFood := schemaRecipeJSON(reply)
+	if !isFood {
+		return nil, ErrNotFoodImage
 	}
+	return recipe.UnmarshalRecipe(reply)
+}
 
-	// Extract the JSON from the response, which might be wrapped in markdown
-	startIndex := strings.Index(string(jsonString), "{")
-	endIndex := strings.LastIndex(string(jsonString), "}")
+// reformatRecipeText asks again for a recipe whose reply wasn't valid JSON,
+// in a chat that carries the prompt and the reply, and returns the new reply.
+func (c *Client) reformatRecipeText(ctx context.Context, model *genai.GenerativeModel, prompt []genai.Part, reply string) (string, error) {
+	session := model.StartChat()
+	session.History = []*genai.Content{
+		{Role: "user", Parts: prompt},
+		{Role: "model", Parts: []genai.Part{genai.Text(reply)}},
+	}
+	resp, err := c.sendMessage(ctx, session, genai.Text(recipe.ReformatPrompt))
+	if err != nil {
+		return "", generateError(err)
+	}
+	if err := finishReasonError(resp); err != nil {
+		return "", err
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("empty response from Gemini")
+	}
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", fmt.Errorf("unexpected response format from Gemini")
+	}
+	return string(text), nil
+}
 
-	if startIndex == -1 || endIndex == -1 || startIndex > endIndex {
-		return nil, fmt.Errorf("could not find JSON object in response: %s", jsonString)
+// generateRecipeText sends a recipe prompt and returns the reply. A reply cut
+// off at the token limit, or whose JSON is never closed, is continued up to
+// recipe.MaxContinuations times in a chat that carries the reply so far, and
+// the pieces are stitched together.
+func (c *Client) generateRecipeText(ctx context.Context, model *genai.GenerativeModel, prompt []genai.Part) (string, error) {
+	resp, err := c.generateContent(ctx, model, prompt...)
+	if err != nil {
+		return "", generateError(err)
 	}
 
-	cleanJSON := string(jsonString)[startIndex : endIndex+1]
+	var session *genai.ChatSession
+	text := ""
+	for continuations := 0; ; continuations++ {
+		truncated := false
+		if err := finishReasonError(resp); err != nil {
+			if !errors.Is(err, recipe.ErrResponseTruncated) {
+				return "", err
+			}
+			truncated = true
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+			return "", fmt.Errorf("empty response from Gemini")
+		}
+		piece, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+		if !ok {
+			return "", fmt.Errorf("unexpected response format from Gemini")
+		}
+		text = recipe.AppendContinuation(text, string(piece))
 
-	// Unmarshal the JSON into a Recipe struct
-	var r recipe.Recipe
-	if err := json.Unmarshal([]byte(cleanJSON), &r); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal recipe JSON: %w. Raw response: %s", err, cleanJSON)
+		if !truncated && !recipe.IsTruncatedJSON(text) {
+			return text, nil
+		}
+		if continuations == recipe.MaxContinuations {
+			return "", fmt.Errorf("%w: Gemini's recipe was still cut off after %d continuations", recipe.ErrResponseTruncated, continuations)
+		}
+
+		// The session records each exchange, so later continuations see
+		// everything sent so far
+		if session == nil {
+			// A continuation picks up mid-object, so it can't follow the schema
+			session = withoutRecipeSchema(model).StartChat()
+			session.History = []*genai.Content{
+				{Role: "user", Parts: prompt},
+				{Role: "model", Parts: []genai.Part{piece}},
+			}
+		}
+		resp, err = c.sendMessage(ctx, session, genai.Text(recipe.ContinuePrompt))
+		if err != nil {
+			return "", generateError(err)
+		}
 	}
+}
 
-	r.Cuisine = cuisine
-	r.DietaryPreference = dietaryPreference
+// Chat continues a conversation about a recipe, streaming the reply: onChunk
+// is called with each piece of text as Gemini sends it, and the whole reply
+// is returned. The last message is the one being answered.
+func (c *Client) Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error) {
+	system, messages := recipe.SplitSystemMessage(messages)
+	if len(messages) == 0 {
+		return "", fmt.Errorf("no message to reply to")
+	}
+
+	model, _ := c.generativeModel(ctx)
+	chatModel := *model
+	if system != "" {
+		chatModel.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	}
+	session := chatModel.StartChat()
+	for _, message := range messages[:len(messages)-1] {
+		role := "user"
+		if message.Role == recipe.ChatRoleAssistant {
+			role = "model"
+		}
+		session.History = append(session.History, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(message.Content)}})
+	}
+	last := genai.Text(messages[len(messages)-1].Content)
 
-	return &r, nil
+	// The whole exchange is offered to the Sampler once the stream ends
+	sent := append(slices.Clip(session.History), &genai.Content{Role: "user", Parts: []genai.Part{last}})
+	if system != "" {
+		sent = append([]*genai.Content{{Role: "system", Parts: []genai.Part{genai.Text(system)}}}, sent...)
+	}
+	var reply strings.Builder
+	iter := session.SendMessageStream(ctx, last)
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.sample(ctx, sent, reply.String, err)
+			return "", generateError(err)
+		}
+		if err := finishReasonError(resp); err != nil {
+			c.sample(ctx, sent, reply.String, err)
+			return "", err
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if text, ok := part.(genai.Text); ok {
+				reply.WriteString(string(text))
+				onChunk(string(text))
+			}
+		}
+	}
+	c.sample(ctx, sent, reply.String, nil)
+	return reply.String(), nil
 }
@@ -0,0 +1,129 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+
+	"snapchef/internal/recipe"
+)
+
+// quantitiesSchema is a list of ingredients with their quantities. Response
+// schemas can't describe a map with arbitrary keys, so the maps of
+// recipe.Recipe are asked for as lists and converted back by schemaRecipeJSON.
+var quantitiesSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"name":     {Type: genai.TypeString},
+			"quantity": {Type: genai.TypeString},
+		},
+		Required: []string{"name", "quantity"},
+	},
+}
+
+// recipeSchema is the response schema of recipe generation with
+// Client.JSONSchema set. It mirrors the JSON the recipe prompt asks for,
+// plus is_food, since a schema leaves no room for the prompt's "NO" reply.
+var recipeSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"is_food":            {Type: genai.TypeBoolean, Description: "false if the image does not contain food, in which case the other fields may be left empty"},
+		"title":              {Type: genai.TypeString},
+		"cuisine":            {Type: genai.TypeString},
+		"dietary_preference": {Type: genai.TypeString},
+		"cooking_time":       {Type: genai.TypeString},
+		"servings":           {Type: genai.TypeString},
+		"meal_type":          {Type: genai.TypeString, Enum: recipe.MealTypes},
+		"difficulty":         {Type: genai.TypeString, Enum: recipe.Difficulties},
+		"ingredients":        quantitiesSchema,
+		"instructions": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"text":             {Type: genai.TypeString},
+					"duration_minutes": {Type: genai.TypeInteger},
+					"temp_celsius":     {Type: genai.TypeInteger},
+				},
+				Required: []string{"text"},
+			},
+		},
+		"shopping_cart": quantitiesSchema,
+		"confidence":    {Type: genai.TypeNumber, Description: "from 0 to 1, how sure you are the recipe matches the dish"},
+		"notes":         {Type: genai.TypeString, Description: "any assumptions you made"},
+	},
+	Required: []string{"is_food", "title", "ingredients", "instructions", "shopping_cart"},
+}
+
+// withRecipeSchema returns a copy of model that answers with JSON following
+// recipeSchema.
+func withRecipeSchema(model *genai.GenerativeModel) *genai.GenerativeModel {
+	schemaModel := *model
+	schemaModel.ResponseMIMEType = "application/json"
+	schemaModel.ResponseSchema = recipeSchema
+	return &schemaModel
+}
+
+// withoutRecipeSchema returns model, or a copy of it without a response
+// schema if it has one.
+func withoutRecipeSchema(model *genai.GenerativeModel) *genai.GenerativeModel {
+	if model.ResponseSchema == nil {
+		return model
+	}
+	plainModel := *model
+	plainModel.ResponseMIMEType = ""
+	plainModel.ResponseSchema = nil
+	return &plainModel
+}
+
+// isSchemaRejected reports whether err is Gemini turning down a request as
+// invalid, which is how models without schema support answer one.
+func isSchemaRejected(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest
+}
+
+// schemaRecipeJSON converts a reply following recipeSchema to the JSON
+// recipe.Recipe unmarshals: the ingredient lists become maps again, and
+// is_food is dropped. It reports whether the image contains food, and
+// returns text unchanged if it isn't such a reply, e.g. from a model that
+// ignored the schema.
+func schemaRecipeJSON(text string) (string, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return text, true
+	}
+
+	if raw, ok := fields["is_food"]; ok {
+		var isFood bool
+		if json.Unmarshal(raw, &isFood) == nil && !isFood {
+			return text, false
+		}
+		delete(fields, "is_food")
+	}
+	for _, key := range []string{"ingredients", "shopping_cart"} {
+		var list []struct {
+			Name     string `json:"name"`
+			Quantity string `json:"quantity"`
+		}
+		if json.Unmarshal(fields[key], &list) != nil {
+			continue
+		}
+		quantities := make(map[string]string, len(list))
+		for _, item := range list {
+			quantities[item.Name] = item.Quantity
+		}
+		fields[key], _ = json.Marshal(quantities)
+	}
+
+	converted, err := json.Marshal(fields)
+	if err != nil {
+		return text, true
+	}
+	return string(converted), true
+}
@@ -5,27 +5,63 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"sync/atomic"
 
 	"snapchef/internal/recipe"
 )
 
+const (
+	defaultModel       = "gemma-3-12b-it:2"
+	defaultTemperature = 1
+)
+
 // Client represents a client for the local LLM.
 type Client struct {
-	httpClient *http.Client
-	apiURL     string
+	httpClient  *http.Client
+	apiURL      string
+	modelsURL   string
+	model       string
+	temperature float64
+
+	// FoodCheckPrompt is the prompt IsFoodImage sends with the image. It defaults to recipe.FoodCheckPrompt.
+	FoodCheckPrompt string
+
+	// JSONRetries is how many times a recipe whose reply isn't valid JSON is
+	// asked for again, with a stricter prompt. It defaults to
+	// recipe.DefaultJSONRetries.
+	JSONRetries int
+	reprompts   atomic.Int64
+
+	// Sampler records a share of the prompts sent to the model and their
+	// replies. Nil records none.
+	Sampler *recipe.PromptSampler
 }
 
 // NewClient creates a new client for the local LLM.
 func NewClient() *Client {
 	return &Client{
-		httpClient: &http.Client{},
-		apiURL:     "http://localhost:1234/v1/chat/completions",
+		httpClient:      &http.Client{},
+		apiURL:          "http://localhost:1234/v1/chat/completions",
+		modelsURL:       "http://localhost:1234/v1/models",
+		model:           defaultModel,
+		temperature:     defaultTemperature,
+		FoodCheckPrompt: recipe.FoodCheckPrompt,
+		JSONRetries:     recipe.DefaultJSONRetries,
 	}
 }
 
+// Reprompts returns how many times recipes were asked for again because the
+// reply wasn't valid JSON.
+func (c *Client) Reprompts() int64 {
+	return c.reprompts.Load()
+}
+
 // Request represents the request body for the local LLM.
 type Request struct {
 	Model       string    `json:"model"`
@@ -59,113 +95,389 @@ type Response struct {
 
 // Choice represents a choice in the response.
 type Choice struct {
-	Message ResponseMessage `json:"message"`
+	Message      ResponseMessage `json:"message"`
+	FinishReason string          `json:"finish_reason"`
 }
 
+// finishReasonLength is the finish reason of a reply cut off at max_tokens.
+const finishReasonLength = "length"
+
 // ResponseMessage represents a message in the response.
 type ResponseMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
-// GenerateContent sends a request to the local LLM and returns the response.
-func (c *Client) GenerateContent(ctx context.Context, text string, imageData string) (string, error) {
-	reqBody := Request{
-		Model: "gemma-3-12b-it:2",
-		Messages: []Message{
-			{
-				Role: "user",
-				Content: []Content{
-					{
-						Type: "text",
-						Text: text,
-					},
-					{
-						Type: "image_url",
-						ImageURL: &ImageURL{
-							URL: "data:image/jpeg;base64," + imageData,
-						},
-					},
-				},
-			},
+// contextError wraps err with the context's error if the context was
+// cancelled or timed out, so callers can tell with
+// errors.Is(err, context.DeadlineExceeded) or context.Canceled. The HTTP
+// client doesn't always wrap it itself, e.g. when the body is cut off
+// mid-read.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
+
+// GenerateContent sends a request with the given base64-encoded images to the
+// local LLM and returns the response.
+func (c *Client) GenerateContent(ctx context.Context, text string, images ...string) (string, error) {
+	return c.complete(ctx, []Message{userMessage(text, images...)})
+}
+
+// userMessage returns a user message with the given text and base64-encoded
+// images.
+func userMessage(text string, images ...string) Message {
+	content := []Content{
+		{
+			Type: "text",
+			Text: text,
 		},
-		Temperature: 1,
+	}
+	for _, imageData := range images {
+		content = append(content, Content{
+			Type: "image_url",
+			ImageURL: &ImageURL{
+				URL: "data:image/jpeg;base64," + imageData,
+			},
+		})
+	}
+
+	return Message{
+		Role:    "user",
+		Content: content,
+	}
+}
+
+// complete sends the messages to the local LLM and returns its reply.
+func (c *Client) complete(ctx context.Context, messages []Message) (string, error) {
+	choice, err := c.completeChoice(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	return choice.Message.Content, nil
+}
+
+// completeChoice is complete, returning the whole choice so callers can see
+// why the reply finished. The exchange is offered to the Sampler.
+func (c *Client) completeChoice(ctx context.Context, messages []Message) (*Choice, error) {
+	choice, err := c.requestChoice(ctx, messages)
+	c.Sampler.Sample(ctx, func() *recipe.PromptSample {
+		sample := &recipe.PromptSample{Engine: "local", Model: recipe.ModelFromContext(ctx, c.model)}
+		var prompt []string
+		for _, message := range messages {
+			for _, content := range message.Content {
+				if content.Text != "" {
+					prompt = append(prompt, message.Role+": "+content.Text)
+				}
+				if content.ImageURL == nil {
+					continue
+				}
+				_, encoded, _ := strings.Cut(content.ImageURL.URL, ",")
+				if imageData, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+					sample.ImageHashes = append(sample.ImageHashes, recipe.HashImage(imageData))
+				}
+			}
+		}
+		sample.Prompt = strings.Join(prompt, "\n\n")
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			sample.Response = choice.Message.Content
+		}
+		return sample
+	})
+	return choice, err
+}
+
+// requestChoice sends the messages to the local LLM and returns the first
+// choice of its reply.
+func (c *Client) requestChoice(ctx context.Context, messages []Message) (*Choice, error) {
+	reqBody := Request{
+		Model:       recipe.ModelFromContext(ctx, c.model),
+		Messages:    messages,
+		Temperature: c.temperature,
 		MaxTokens:   1024,
 	}
 
 	reqBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, contextError(ctx, fmt.Errorf("failed to send request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-OK status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("received non-OK status code: %d", resp.StatusCode)
 	}
 
 	var llmResp Response
 	if err := json.NewDecoder(resp.Body).Decode(&llmResp); err != nil {
-		return "", fmt.Errorf("failed to decode response body: %w", err)
+		return nil, contextError(ctx, fmt.Errorf("failed to decode response body: %w", err))
 	}
 
 	if len(llmResp.Choices) > 0 {
-		fmt.Printf("LLM Response: %s\n", llmResp.Choices[0].Message.Content)
-		return llmResp.Choices[0].Message.Content, nil
+		return &llmResp.Choices[0], nil
+	}
+
+	return nil, fmt.Errorf("no content found in response")
+}
+
+// Chat continues a conversation about a recipe. The local LLM replies in
+// one go, so onChunk is called once with the whole reply, which is also
+// returned. The last message is the one being answered.
+func (c *Client) Chat(ctx context.Context, messages []recipe.ChatMessage, onChunk func(string)) (string, error) {
+	reply, err := c.complete(ctx, ChatMessages(messages))
+	if err != nil {
+		return "", err
 	}
+	onChunk(reply)
+	return reply, nil
+}
+
+// ChatMessages converts a conversation to chat completions messages.
+func ChatMessages(messages []recipe.ChatMessage) []Message {
+	converted := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		converted = append(converted, Message{
+			Role:    message.Role,
+			Content: []Content{{Type: "text", Text: message.Content}},
+		})
+	}
+	return converted
+}
+
+// Model returns the model requests use unless they pick another one.
+func (c *Client) Model() string {
+	return c.model
+}
 
-	return "", fmt.Errorf("no content found in response")
+// modelsResponse is the response of the models endpoint.
+type modelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the IDs of the models the local LLM server has
+// available, from LM Studio's /v1/models endpoint.
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.modelsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, contextError(ctx, fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-OK status code: %d", resp.StatusCode)
+	}
+
+	var modelsResp modelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, contextError(ctx, fmt.Errorf("failed to decode response body: %w", err))
+	}
+
+	models := make([]string, 0, len(modelsResp.Data))
+	for _, model := range modelsResp.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+// Warmup sends a tiny text-only request so the model is loaded before the
+// first real request.
+func (c *Client) Warmup(ctx context.Context) error {
+	// Sent directly, so the Sampler doesn't record it
+	if _, err := c.requestChoice(ctx, []Message{userMessage("Reply with OK.")}); err != nil {
+		return fmt.Errorf("warmup request failed: %w", err)
+	}
+	return nil
 }
 
 func (c *Client) IsFoodImage(ctx context.Context, imageData []byte) (bool, string, error) {
-	prompt := "Analyze the provided image. If it contains food, return a brief recipe description. If not, respond with 'NO' followed by a 5-word description of the image content."
+	prompt := c.FoodCheckPrompt
 	encodedImage := base64.StdEncoding.EncodeToString(imageData)
 	responseText, err := c.GenerateContent(ctx, prompt, encodedImage)
 	if err != nil {
 		return false, "", fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	if len(responseText) > 2 && responseText[:2] == "No" {
+	if recipe.IsNotFoodDescription(responseText) {
 		return false, responseText, nil
 	}
 
 	return true, responseText, nil
 }
 
+// DescribeImage returns the model's answer to prompt about the image as it
+// is, without any parsing.
+func (c *Client) DescribeImage(ctx context.Context, imageData []byte, prompt string) (string, error) {
+	responseText, err := c.GenerateContent(ctx, prompt, base64.StdEncoding.EncodeToString(imageData))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+	return responseText, nil
+}
+
+// ModerateImage checks the image for inappropriate content. It returns a
+// *recipe.ModerationError if the image is flagged.
+func (c *Client) ModerateImage(ctx context.Context, imageData []byte) error {
+	responseText, err := c.GenerateContent(ctx, recipe.ModerationPrompt, base64.StdEncoding.EncodeToString(imageData))
+	if err != nil {
+		return fmt.Errorf("failed to generate content: %w", err)
+	}
+	return recipe.ParseModeration(responseText)
+}
+
+// GenerateShoppingCart generates only the shopping list for the dish in an image.
+func (c *Client) GenerateShoppingCart(ctx context.Context, imageData []byte) (map[string]string, error) {
+	responseText, err := c.GenerateContent(ctx, recipe.ShoppingCartPrompt, base64.StdEncoding.EncodeToString(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	return recipe.ParseShoppingCart(responseText)
+}
+
+// SuggestPairings suggests drinks to go with a recipe, from text alone.
+func (c *Client) SuggestPairings(ctx context.Context, r *recipe.Recipe) ([]recipe.Pairing, error) {
+	responseText, err := c.GenerateContent(ctx, recipe.PairingsPrompt(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	return recipe.ParsePairings(responseText, r.DietaryPreference)
+}
+
+// ExtractIngredients lists the ingredients visible in an image, with estimated quantities.
+func (c *Client) ExtractIngredients(ctx context.Context, imageData []byte) (map[string]string, error) {
+	responseText, err := c.GenerateContent(ctx, recipe.IngredientsPrompt, base64.StdEncoding.EncodeToString(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	return recipe.ParseIngredients(responseText)
+}
+
+// RegenerateShoppingCart generates the shopping list for a recipe's
+// ingredients, from text alone.
+func (c *Client) RegenerateShoppingCart(ctx context.Context, ingredients map[string]string) (map[string]string, error) {
+	responseText, err := c.GenerateContent(ctx, recipe.IngredientsShoppingCartPrompt(ingredients))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+	return recipe.ParseShoppingCart(responseText)
+}
+
 func (c *Client) GenerateRecipe(ctx context.Context, imageData []byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
-	prompt := "I need a recipe for the food item in this image. Please return a single, clean JSON object with the following keys and data types: 'title' (string), 'cuisine' (string), 'dietary_preference' (string), 'cooking_time' (string), 'servings' (string), 'ingredients' (map of ingredient names to quantities), 'instructions' (array of strings), and 'shopping_cart' (map of ingredient names to quantities). .The JSON response should be clean and not contain any markdown formatting."
+	return c.GenerateRecipeFromImages(ctx, [][]byte{imageData}, dietaryPreference, cuisine)
+}
+
+// GenerateRecipeFromImages generates a single recipe from several images of the same dish.
+func (c *Client) GenerateRecipeFromImages(ctx context.Context, images [][]byte, dietaryPreference, cuisine string) (*recipe.Recipe, error) {
+	prompt := "I need a recipe for the food item in this image. Please return a single, clean JSON object with the following keys and data types: 'title' (string), 'cuisine' (string), 'dietary_preference' (string), 'cooking_time' (string), 'servings' (string), 'meal_type' (string, one of 'breakfast', 'lunch', 'dinner', 'snack' or 'dessert'), 'difficulty' (string, one of 'easy', 'medium' or 'hard'), 'ingredients' (map of ingredient names to quantities), 'instructions' (array of step objects, each with 'text' (string) and, when the step has them, 'duration_minutes' (number) and 'temp_celsius' (number)), 'shopping_cart' (map of ingredient names to quantities), 'confidence' (number from 0 to 1, how sure you are the recipe matches the dish) and 'notes' (string, any assumptions you made, e.g. \"couldn't identify the sauce, assumed marinara\"). .The JSON response should be clean and not contain any markdown formatting."
 	if dietaryPreference != "" {
 		prompt += fmt.Sprintf(" The recipe should be %s.", dietaryPreference)
 	}
 	if cuisine != "" {
 		prompt += fmt.Sprintf(" The cuisine should be %s.", cuisine)
 	}
+	if servings := recipe.ServingsFromContext(ctx); servings > 0 {
+		prompt += fmt.Sprintf(" Scale the recipe for %d servings.", servings)
+	}
+	prompt += recipe.StyleInstruction(ctx)
+	prompt += recipe.LanguageInstruction(ctx)
+	prompt += recipe.ExclusionInstruction(ctx)
+	prompt += recipe.NotesInstruction(ctx)
+	prompt += recipe.NotFoodInstruction
+	if len(images) > 1 {
+		prompt = "These images all show the same dish from different angles. " + prompt
+	}
 
-	encodedImage := base64.StdEncoding.EncodeToString(imageData)
-	responseText, err := c.GenerateContent(ctx, prompt, encodedImage)
+	encodedImages := make([]string, 0, len(images))
+	for _, imageData := range images {
+		encodedImages = append(encodedImages, base64.StdEncoding.EncodeToString(imageData))
+	}
+	message := userMessage(prompt, encodedImages...)
+	responseText, err := c.generateRecipeText(ctx, []Message{message})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
+	r, err := parseRecipeReply(responseText)
+	for retries := 0; errors.Is(err, recipe.ErrMalformedJSON) && retries < c.JSONRetries; retries++ {
+		c.reprompts.Add(1)
+		log.Printf("Local LLM returned a recipe that isn't valid JSON, asking again: %s", err.Error())
+		responseText, err = c.generateRecipeText(ctx, []Message{
+			message,
+			{Role: "assistant", Content: []Content{{Type: "text", Text: responseText}}},
+			{Role: "user", Content: []Content{{Type: "text", Text: recipe.ReformatPrompt}}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate content: %w", err)
+		}
+		r, err = parseRecipeReply(responseText)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Clean up the response text
-	cleanedResponse := strings.TrimPrefix(responseText, "```json")
-	cleanedResponse = strings.TrimSuffix(cleanedResponse, "```")
-	cleanedResponse = strings.TrimSpace(cleanedResponse)
+	r.Model = recipe.ModelFromContext(ctx, c.model)
+	r.Temperature = c.temperature
 
-	var r recipe.Recipe
-	if err := json.Unmarshal([]byte(cleanedResponse), &r); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal recipe from response: %w", err)
+	if err := r.Validate(); err != nil {
+		return nil, err
 	}
 
-	return &r, nil
+	return r, nil
+}
+
+// parseRecipeReply returns the recipe in a reply to a recipe prompt, which
+// might be wrapped in markdown.
+func parseRecipeReply(reply string) (*recipe.Recipe, error) {
+	if recipe.IsNotFoodReply(reply) {
+		return nil, recipe.ErrNotFoodImage
+	}
+	return recipe.UnmarshalRecipe(reply)
+}
+
+// generateRecipeText sends a recipe prompt, the conversation ending with it,
+// and returns the reply. A reply cut off at max_tokens, or whose JSON is
+// never closed, is continued up to recipe.MaxContinuations times by sending
+// the reply so far back with a request to carry on, and the pieces are
+// stitched together.
+func (c *Client) generateRecipeText(ctx context.Context, prompt []Message) (string, error) {
+	messages := prompt
+	text := ""
+	for continuations := 0; ; continuations++ {
+		choice, err := c.completeChoice(ctx, messages)
+		if err != nil {
+			return "", err
+		}
+		text = recipe.AppendContinuation(text, choice.Message.Content)
+
+		if choice.FinishReason != finishReasonLength && !recipe.IsTruncatedJSON(text) {
+			return text, nil
+		}
+		if continuations == recipe.MaxContinuations {
+			return "", fmt.Errorf("%w: the recipe was still cut off after %d continuations", recipe.ErrResponseTruncated, continuations)
+		}
+
+		messages = append(slices.Clip(prompt),
+			Message{Role: "assistant", Content: []Content{{Type: "text", Text: text}}},
+			Message{Role: "user", Content: []Content{{Type: "text", Text: recipe.ContinuePrompt}}},
+		)
+	}
 }
@@ -0,0 +1,66 @@
+package recipe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Chat message roles.
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// ChatMessage is one message of a conversation with an engine about a recipe.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatSystemPrompt seeds a conversation about a recipe, so follow-up
+// questions such as "can I substitute X?" are answered for this recipe.
+func ChatSystemPrompt(r *Recipe) string {
+	var b strings.Builder
+	b.WriteString("You are Pixel Chef, helping a home cook with the recipe below. Answer their questions about it, such as substitutions, techniques or how to tell when something is done, briefly and in plain text without markdown. If a question has nothing to do with cooking, politely steer back to the recipe.\n\n")
+	fmt.Fprintf(&b, "Recipe: %s\n", r.Title)
+	if r.Cuisine != "" {
+		fmt.Fprintf(&b, "Cuisine: %s\n", r.Cuisine)
+	}
+	if r.DietaryPreference != "" {
+		fmt.Fprintf(&b, "Dietary preference: %s\n", r.DietaryPreference)
+	}
+	if r.CookingTime != "" {
+		fmt.Fprintf(&b, "Cooking time: %s\n", r.CookingTime)
+	}
+	if r.Servings != "" {
+		fmt.Fprintf(&b, "Servings: %s\n", r.Servings)
+	}
+
+	names := make([]string, 0, len(r.Ingredients))
+	for name := range r.Ingredients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("Ingredients:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "- %s: %s\n", name, r.Ingredients[name])
+	}
+
+	b.WriteString("Instructions:\n")
+	for i, step := range r.Instructions {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step.Text)
+	}
+	return b.String()
+}
+
+// SplitSystemMessage returns the content of a leading system message, and
+// the messages after it. Engines that take the system prompt separately from
+// the conversation use it.
+func SplitSystemMessage(messages []ChatMessage) (string, []ChatMessage) {
+	if len(messages) > 0 && messages[0].Role == ChatRoleSystem {
+		return messages[0].Content, messages[1:]
+	}
+	return "", messages
+}
@@ -0,0 +1,40 @@
+package recipe
+
+import "strings"
+
+// MaxContinuations is how many times an engine is asked to continue a
+// recipe that was cut off before giving up.
+const MaxContinuations = 2
+
+// ContinuePrompt asks an engine to carry on with a reply that was cut off.
+const ContinuePrompt = "Your reply was cut off. Continue exactly where you stopped, without repeating anything and without markdown formatting, so that your replies joined together form the complete JSON object."
+
+// DefaultJSONRetries is how many times an engine is asked again for a recipe
+// whose reply wasn't valid JSON, unless configured otherwise.
+const DefaultJSONRetries = 1
+
+// ReformatPrompt asks an engine to repeat a recipe that wasn't valid JSON as
+// the bare object.
+const ReformatPrompt = "Your previous response was not valid JSON; return ONLY the JSON object, without any other text or markdown formatting."
+
+// IsTruncatedJSON reports whether text opens a JSON object that it never
+// closes, the sign of a reply cut off mid-recipe. Text without an object,
+// such as a "NO ..." reply to the food check, isn't truncated.
+func IsTruncatedJSON(text string) bool {
+	start := strings.Index(text, "{")
+	return start != -1 && matchingBrace(text, start) == -1
+}
+
+// AppendContinuation joins a continuation to the reply so far. Models tend to
+// open a continuation with a fresh markdown fence, which is dropped. With no
+// reply so far, continuation is the reply and is returned as is.
+func AppendContinuation(text, continuation string) string {
+	if text == "" {
+		return continuation
+	}
+	trimmed := strings.TrimLeft(continuation, " \t\r\n")
+	if rest, ok := strings.CutPrefix(trimmed, "```"); ok {
+		continuation = strings.TrimPrefix(rest, "json")
+	}
+	return text + continuation
+}
@@ -0,0 +1,24 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTruncatedJSON(t *testing.T) {
+	assert.False(t, IsTruncatedJSON(`{"title": "Soup"}`))
+	assert.False(t, IsTruncatedJSON("NO a picture of a cat"))
+	assert.False(t, IsTruncatedJSON(`{"title": "Brace } in a string"}`))
+	assert.True(t, IsTruncatedJSON(`{"title": "Soup", "ingredients": {"Leek": "1"`))
+	assert.True(t, IsTruncatedJSON("```json\n{\"title\": \"Soup\", \"instructions\": [{\"text\": \"Chop the }"))
+}
+
+func TestAppendContinuation(t *testing.T) {
+	text := AppendContinuation(`{"title": "Soup", "ingredients": {"Le`, `ek": "1"}}`)
+	assert.Equal(t, `{"title": "Soup", "ingredients": {"Leek": "1"}}`, text)
+	assert.False(t, IsTruncatedJSON(text))
+
+	text = AppendContinuation(`{"title": "Soup", `, "```json\n\"servings\": \"2\"}")
+	assert.Equal(t, "{\"title\": \"Soup\", \n\"servings\": \"2\"}", text)
+}
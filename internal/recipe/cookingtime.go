@@ -0,0 +1,40 @@
+package recipe
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cookingTimePattern matches an amount, or a range of amounts, followed by an
+// hour or minute unit, e.g. "1 hour", "20-30 min" or "1.5 hrs".
+var cookingTimePattern = regexp.MustCompile(`(\d+(?:\.\d+)?)(?:\s*(?:-|–|to)\s*(\d+(?:\.\d+)?))?\s*(hours|hour|hrs|hr|h|minutes|minute|mins|min|m)`)
+
+// ParseCookingMinutes extracts the cooking time in minutes from free text
+// such as "30 min", "1 hour 15 minutes" or "20-30 min". Ranges count as
+// their upper bound, and a bare number counts as minutes. It returns 0 when
+// no time can be found.
+func ParseCookingMinutes(cookingTime string) int {
+	text := strings.ToLower(strings.TrimSpace(cookingTime))
+	if minutes, err := strconv.ParseFloat(text, 64); err == nil && minutes > 0 {
+		return int(math.Round(minutes))
+	}
+
+	var total float64
+	for _, match := range cookingTimePattern.FindAllStringSubmatch(text, -1) {
+		amount := match[1]
+		if match[2] != "" {
+			amount = match[2]
+		}
+		value, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(match[3], "h") {
+			value *= 60
+		}
+		total += value
+	}
+	return int(math.Round(total))
+}
@@ -0,0 +1,34 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCookingMinutes(t *testing.T) {
+	tests := []struct {
+		cookingTime string
+		want        int
+	}{
+		{"30 min", 30},
+		{"45 minutes", 45},
+		{"1 hour", 60},
+		{"1.5 hours", 90},
+		{"1 hour 15 minutes", 75},
+		{"1h 20m", 80},
+		{"20-30 min", 30},
+		{"20 to 25 mins", 25},
+		{"1-2 hours", 120},
+		{"About 40 Minutes", 40},
+		{"25", 25},
+		{"", 0},
+		{"quick", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cookingTime, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseCookingMinutes(tt.cookingTime))
+		})
+	}
+}
@@ -0,0 +1,5 @@
+package recipe
+
+// DescribePrompt asks an engine for a free-form description of an image, to
+// see what it makes of an image when a recipe for it turns out poorly.
+const DescribePrompt = "Describe this image in detail: the food and ingredients you can see, how they are prepared and presented, and anything else in the picture."
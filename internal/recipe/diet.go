@@ -0,0 +1,155 @@
+package recipe
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownDiet is returned by CheckDiet for a dietary preference it has no
+// rules for.
+var ErrUnknownDiet = errors.New("unknown diet")
+
+// dietGroup is a kind of ingredient some diets rule out. Terms are matched
+// as whole words against canonical ingredient names, so "chicken" matches
+// "chicken thigh" but "egg" doesn't match "eggplant".
+type dietGroup struct {
+	reason string
+	terms  []string
+}
+
+var (
+	meatGroup = dietGroup{"meat", []string{
+		"bacon", "beef", "bresaola", "chicken", "chorizo", "duck", "goose", "ham",
+		"lamb", "meat", "meatball", "mince", "mutton", "pancetta", "pepperoni",
+		"pork", "prosciutto", "salami", "sausage", "steak", "turkey", "veal",
+		"venison",
+	}}
+	seafoodGroup = dietGroup{"fish or seafood", []string{
+		"anchovy", "clam", "cod", "crab", "fish", "halibut", "lobster",
+		"mackerel", "mussel", "octopus", "oyster", "prawn", "salmon", "sardine",
+		"scallop", "shrimp", "squid", "tilapia", "trout", "tuna",
+		"worcestershire sauce",
+	}}
+	slaughterGroup = dietGroup{"made from slaughtered animals", []string{
+		"bone broth", "gelatin", "gelatine", "lard", "rennet", "suet",
+	}}
+	dairyGroup = dietGroup{"dairy", []string{
+		"butter", "buttermilk", "casein", "cheddar", "cheese", "cream",
+		"creme fraiche", "feta", "ghee", "mascarpone", "milk", "mozzarella",
+		"paneer", "parmesan", "ricotta", "whey", "yogurt", "yoghurt",
+	}}
+	eggGroup = dietGroup{"egg", []string{
+		"aioli", "egg", "mayo", "mayonnaise", "meringue",
+	}}
+	beeGroup = dietGroup{"made by bees", []string{
+		"beeswax", "honey",
+	}}
+	glutenGroup = dietGroup{"gluten", []string{
+		"barley", "beer", "bread", "breadcrumb", "bulgur", "couscous", "farro",
+		"flour", "noodle", "panko", "pasta", "rye", "seitan", "semolina",
+		"soy sauce", "spaghetti", "spelt", "tortilla", "wheat",
+	}}
+	carbGroup = dietGroup{"high in carbohydrates", []string{
+		"bean", "bread", "corn", "flour", "honey", "lentil", "maple syrup",
+		"noodle", "oat", "pasta", "potato", "quinoa", "rice", "spaghetti",
+		"sugar", "tortilla",
+	}}
+)
+
+// Ingredients that contain a term of a group but don't belong to it.
+var (
+	plantAlternatives = []string{
+		"almond butter", "almond milk", "butter bean", "butter lettuce",
+		"cashew butter", "cocoa butter", "coconut cream", "coconut milk",
+		"coconut yogurt", "cream of tartar", "dairy-free", "non-dairy",
+		"nut butter", "oat milk", "peanut butter", "plant-based", "rice milk",
+		"soy milk", "vegan",
+	}
+	glutenFreeAlternatives = []string{
+		"almond flour", "chickpea flour", "coconut flour", "corn flour",
+		"corn tortilla", "gluten-free", "rice flour", "rice noodle", "tamari",
+	}
+	ketoAlternatives = []string{
+		"almond flour", "cauliflower rice", "coconut flour", "green bean",
+		"sugar-free",
+	}
+)
+
+// dietRule is what a diet rules out.
+type dietRule struct {
+	groups  []dietGroup
+	allowed []string
+}
+
+// dietRules are the diets CheckDiet knows, by canonical dietary preference.
+var dietRules = map[string]dietRule{
+	"vegan":       {groups: []dietGroup{meatGroup, seafoodGroup, slaughterGroup, dairyGroup, eggGroup, beeGroup}, allowed: plantAlternatives},
+	"vegetarian":  {groups: []dietGroup{meatGroup, seafoodGroup, slaughterGroup}},
+	"pescatarian": {groups: []dietGroup{meatGroup, slaughterGroup}},
+	"dairy-free":  {groups: []dietGroup{dairyGroup}, allowed: plantAlternatives},
+	"gluten-free": {groups: []dietGroup{glutenGroup}, allowed: glutenFreeAlternatives},
+	"keto":        {groups: []dietGroup{carbGroup}, allowed: ketoAlternatives},
+}
+
+// Diets returns the dietary preferences CheckDiet knows, sorted.
+func Diets() []string {
+	diets := make([]string, 0, len(dietRules))
+	for diet := range dietRules {
+		diets = append(diets, diet)
+	}
+	sort.Strings(diets)
+	return diets
+}
+
+// DietViolation is an ingredient of a recipe that its diet rules out.
+type DietViolation struct {
+	// Ingredient is the name the recipe lists it under.
+	Ingredient string `json:"ingredient"`
+	// Reason is the kind of ingredient the diet rules out, e.g. "dairy".
+	Reason string `json:"reason"`
+}
+
+// CheckDiet returns the ingredients of r that diet, a dietary preference or
+// a synonym of one, rules out, sorted by name. It catches recipes labeled
+// vegan that call for butter, but only knows common ingredients, so no
+// violations doesn't prove a recipe complies.
+func CheckDiet(r *Recipe, diet string) ([]DietViolation, error) {
+	rule, ok := dietRules[strings.ToLower(NormalizeDietaryPreference(diet))]
+	if !ok {
+		return nil, ErrUnknownDiet
+	}
+
+	violations := []DietViolation{}
+	for name := range r.Ingredients {
+		canonical := CanonicalIngredient(name)
+		if hasTerm(canonical, rule.allowed) {
+			continue
+		}
+		for _, group := range rule.groups {
+			if hasTerm(canonical, group.terms) {
+				ingredient := name
+				if original, ok := r.IngredientNames[name]; ok {
+					ingredient = original
+				}
+				violations = append(violations, DietViolation{Ingredient: ingredient, Reason: group.reason})
+				break
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Ingredient < violations[j].Ingredient
+	})
+	return violations, nil
+}
+
+// hasTerm reports whether any of terms appears as whole words in name.
+func hasTerm(name string, terms []string) bool {
+	padded := " " + name + " "
+	for _, term := range terms {
+		if strings.Contains(padded, " "+term+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDiet(t *testing.T) {
+	r := &Recipe{Ingredients: map[string]string{
+		"Unsalted butter":  "50 g",
+		"Eggs":             "2",
+		"Honey":            "1 tbsp",
+		"Peanut butter":    "2 tbsp",
+		"Coconut milk":     "400 ml",
+		"Eggplant":         "1",
+		"Butternut squash": "1",
+		"Chicken stock":    "500 ml",
+		"Flour":            "200 g",
+	}}
+
+	violations, err := CheckDiet(r, "vegan")
+	assert.NoError(t, err)
+	assert.Equal(t, []DietViolation{
+		{Ingredient: "Chicken stock", Reason: "meat"},
+		{Ingredient: "Eggs", Reason: "egg"},
+		{Ingredient: "Honey", Reason: "made by bees"},
+		{Ingredient: "Unsalted butter", Reason: "dairy"},
+	}, violations)
+
+	violations, err = CheckDiet(r, "Veggie")
+	assert.NoError(t, err)
+	assert.Equal(t, []DietViolation{{Ingredient: "Chicken stock", Reason: "meat"}}, violations)
+
+	violations, err = CheckDiet(r, "gluten-free")
+	assert.NoError(t, err)
+	assert.Equal(t, []DietViolation{{Ingredient: "Flour", Reason: "gluten"}}, violations)
+
+	_, err = CheckDiet(r, "paleo")
+	assert.ErrorIs(t, err, ErrUnknownDiet)
+}
+
+func TestCheckDiet_Alternatives(t *testing.T) {
+	r := &Recipe{Ingredients: map[string]string{
+		"Rice flour":   "100 g",
+		"Tamari":       "2 tbsp",
+		"Vegan cheese": "50 g",
+		"Oat milk":     "200 ml",
+	}}
+
+	for _, diet := range []string{"vegan", "gluten-free", "dairy-free"} {
+		violations, err := CheckDiet(r, diet)
+		assert.NoError(t, err)
+		assert.Empty(t, violations, diet)
+	}
+}
+
+func TestCheckDiet_NormalizedRecipe(t *testing.T) {
+	r := &Recipe{Ingredients: map[string]string{"Parmesan cheese, grated": "30 g", "Basil leaves": "1 handful"}}
+	r.NormalizeIngredients()
+
+	violations, err := CheckDiet(r, "vegan")
+	assert.NoError(t, err)
+	assert.Equal(t, []DietViolation{{Ingredient: "Parmesan cheese, grated", Reason: "dairy"}}, violations)
+}
+
+func TestDietRules(t *testing.T) {
+	// Terms are matched against CanonicalIngredient, so must be canonical themselves
+	for diet, rule := range dietRules {
+		for _, group := range rule.groups {
+			for _, term := range group.terms {
+				assert.Equal(t, CanonicalIngredient(term), term, diet)
+			}
+		}
+		for _, term := range rule.allowed {
+			assert.Equal(t, CanonicalIngredient(term), term, diet)
+		}
+	}
+	assert.Equal(t, []string{"dairy-free", "gluten-free", "keto", "pescatarian", "vegan", "vegetarian"}, Diets())
+}
@@ -0,0 +1,39 @@
+package recipe
+
+import "strings"
+
+// dietarySynonyms maps lowercase dietary preference synonyms to their
+// canonical name, so "veggie" and "vegetarian" recipes end up in one bucket.
+var dietarySynonyms = map[string]string{
+	"veggie":        "vegetarian",
+	"veg":           "vegetarian",
+	"plant-based":   "vegan",
+	"plant based":   "vegan",
+	"gluten free":   "gluten-free",
+	"no gluten":     "gluten-free",
+	"dairy free":    "dairy-free",
+	"no dairy":      "dairy-free",
+	"lactose-free":  "dairy-free",
+	"lactose free":  "dairy-free",
+	"pescetarian":   "pescatarian",
+	"keto-friendly": "keto",
+	"ketogenic":     "keto",
+}
+
+// AddDietarySynonyms adds synonyms to the table, or overrides built-in ones.
+// It is meant to be called once at startup, before requests are served.
+func AddDietarySynonyms(synonyms map[string]string) {
+	for synonym, canonical := range synonyms {
+		dietarySynonyms[strings.ToLower(strings.TrimSpace(synonym))] = strings.ToLower(strings.TrimSpace(canonical))
+	}
+}
+
+// NormalizeDietaryPreference returns the canonical name for a dietary
+// preference synonym, matched case-insensitively. Anything else is returned
+// unchanged.
+func NormalizeDietaryPreference(dietaryPreference string) string {
+	if canonical, ok := dietarySynonyms[strings.ToLower(strings.TrimSpace(dietaryPreference))]; ok {
+		return canonical
+	}
+	return dietaryPreference
+}
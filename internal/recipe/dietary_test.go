@@ -0,0 +1,25 @@
+package recipe
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDietaryPreference(t *testing.T) {
+	assert.Equal(t, "vegetarian", NormalizeDietaryPreference("Veggie"))
+	assert.Equal(t, "vegan", NormalizeDietaryPreference(" plant-based "))
+	assert.Equal(t, "Vegetarian", NormalizeDietaryPreference("Vegetarian"))
+	assert.Equal(t, "", NormalizeDietaryPreference(""))
+
+	AddDietarySynonyms(map[string]string{"No Meat": "Vegetarian"})
+	defer delete(dietarySynonyms, "no meat")
+	assert.Equal(t, "vegetarian", NormalizeDietaryPreference("no meat"))
+}
+
+func TestRecipeUnmarshalJSON_DietarySynonyms(t *testing.T) {
+	var r Recipe
+	assert.NoError(t, json.Unmarshal([]byte(`{"title": "Salad", "dietary_preference": "Plant-Based"}`), &r))
+	assert.Equal(t, "vegan", r.DietaryPreference)
+}
@@ -0,0 +1,64 @@
+package recipe
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Difficulty levels a recipe is rated at.
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// Difficulties lists every difficulty level, easiest first.
+var Difficulties = []string{DifficultyEasy, DifficultyMedium, DifficultyHard}
+
+// NormalizeDifficulty returns difficulty lowercased, or "" when the engine
+// didn't rate the recipe or came up with a level of its own.
+func NormalizeDifficulty(difficulty string) string {
+	difficulty = strings.ToLower(strings.TrimSpace(difficulty))
+	if !slices.Contains(Difficulties, difficulty) {
+		return ""
+	}
+	return difficulty
+}
+
+const (
+	// minHardMinutes is the shortest cooking time believable for a hard recipe.
+	minHardMinutes = 20
+	// maxEasySteps is the most steps believable for an easy recipe.
+	maxEasySteps = 15
+)
+
+// PlausibilityWarnings cross-checks a recipe's cooking time against its
+// difficulty and instructions, and describes each combination that is
+// unlikely to be right, such as a hard recipe with 12 steps that claims to
+// take 5 minutes. It returns nil when nothing looks wrong. Checks that need a
+// cooking time are skipped when it can't be parsed.
+func PlausibilityWarnings(r *Recipe) []string {
+	var warnings []string
+	steps := len(r.Instructions)
+
+	if minutes := ParseCookingMinutes(r.CookingTime); minutes > 0 {
+		if steps > minutes {
+			warnings = append(warnings, fmt.Sprintf("%d steps are unlikely to fit in a cooking time of %d minutes", steps, minutes))
+		}
+		stepMinutes := 0
+		for _, step := range r.Instructions {
+			stepMinutes += step.DurationMinutes
+		}
+		if stepMinutes > minutes {
+			warnings = append(warnings, fmt.Sprintf("the steps take %d minutes, longer than the cooking time of %d minutes", stepMinutes, minutes))
+		}
+		if r.Difficulty == DifficultyHard && minutes < minHardMinutes {
+			warnings = append(warnings, fmt.Sprintf("a hard recipe is unlikely to take only %d minutes", minutes))
+		}
+	}
+	if r.Difficulty == DifficultyEasy && steps > maxEasySteps {
+		warnings = append(warnings, fmt.Sprintf("an easy recipe is unlikely to need %d steps", steps))
+	}
+	return warnings
+}
@@ -0,0 +1,39 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDifficulty(t *testing.T) {
+	assert.Equal(t, DifficultyHard, NormalizeDifficulty(" Hard "))
+	assert.Equal(t, "", NormalizeDifficulty("fiendish"))
+	assert.Equal(t, "", NormalizeDifficulty(""))
+}
+
+func TestPlausibilityWarnings(t *testing.T) {
+	steps := func(n, minutes int) []Instruction {
+		instructions := make([]Instruction, n)
+		for i := range instructions {
+			instructions[i] = Instruction{Text: "Stir", DurationMinutes: minutes}
+		}
+		return instructions
+	}
+
+	assert.Empty(t, PlausibilityWarnings(&Recipe{CookingTime: "45 minutes", Difficulty: DifficultyHard, Instructions: steps(12, 3)}))
+	assert.Empty(t, PlausibilityWarnings(&Recipe{CookingTime: "", Difficulty: DifficultyHard, Instructions: steps(12, 0)}), "an unknown cooking time can't be checked")
+
+	assert.Equal(t, []string{
+		"12 steps are unlikely to fit in a cooking time of 5 minutes",
+		"a hard recipe is unlikely to take only 5 minutes",
+	}, PlausibilityWarnings(&Recipe{CookingTime: "5 minutes", Difficulty: DifficultyHard, Instructions: steps(12, 0)}))
+
+	assert.Equal(t, []string{
+		"the steps take 60 minutes, longer than the cooking time of 30 minutes",
+	}, PlausibilityWarnings(&Recipe{CookingTime: "30 minutes", Difficulty: DifficultyMedium, Instructions: steps(3, 20)}))
+
+	assert.Equal(t, []string{
+		"an easy recipe is unlikely to need 20 steps",
+	}, PlausibilityWarnings(&Recipe{CookingTime: "2 hours", Difficulty: DifficultyEasy, Instructions: steps(20, 0)}))
+}
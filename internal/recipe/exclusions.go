@@ -0,0 +1,95 @@
+package recipe
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxExclusions is the most ingredients a request may exclude.
+const MaxExclusions = 20
+
+// MaxExclusionLength is the longest excluded ingredient accepted, in
+// characters.
+const MaxExclusionLength = 40
+
+// ParseExclusions reads a comma-separated list of ingredients to leave out
+// of a recipe, e.g. "cilantro, Mushrooms". Names are lowercased with their
+// whitespace collapsed, and duplicates and empty entries dropped. Since they
+// end up in the prompt, names may only contain letters, spaces, hyphens and
+// apostrophes. It returns nil if value lists nothing.
+func ParseExclusions(value string) ([]string, error) {
+	var exclusions []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || slices.Contains(exclusions, name) {
+			continue
+		}
+		if utf8.RuneCountInString(name) > MaxExclusionLength {
+			return nil, fmt.Errorf("excluded ingredients must be at most %d characters, got %q", MaxExclusionLength, name)
+		}
+		if strings.IndexFunc(name, func(r rune) bool {
+			return !unicode.IsLetter(r) && r != ' ' && r != '-' && r != '\''
+		}) >= 0 {
+			return nil, fmt.Errorf("invalid excluded ingredient %q, only letters, spaces, hyphens and apostrophes are allowed", name)
+		}
+		exclusions = append(exclusions, name)
+	}
+	if len(exclusions) > MaxExclusions {
+		return nil, fmt.Errorf("at most %d ingredients can be excluded", MaxExclusions)
+	}
+	return exclusions, nil
+}
+
+type exclusionsKey struct{}
+
+// WithExclusions returns a context that asks the engines to generate recipes
+// with it without the given ingredients, as parsed by ParseExclusions.
+func WithExclusions(ctx context.Context, exclusions []string) context.Context {
+	return context.WithValue(ctx, exclusionsKey{}, exclusions)
+}
+
+// ExclusionInstruction returns the sentence added to recipe prompts for the
+// ingredients set with WithExclusions, or "" if there are none.
+func ExclusionInstruction(ctx context.Context) string {
+	exclusions, _ := ctx.Value(exclusionsKey{}).([]string)
+	if len(exclusions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" Do not use the following ingredients, not even as a garnish or substitute: %s.", strings.Join(exclusions, ", "))
+}
+
+// ExcludedIngredients returns the exclusions the recipe uses anyway, in the
+// order given. An ingredient uses an exclusion if the exclusion's words
+// appear in its name, compared as by CanonicalIngredient, so excluding
+// "mushrooms" catches "Shiitake mushrooms" but excluding "nut" doesn't catch
+// "coconut".
+func ExcludedIngredients(r *Recipe, exclusions []string) []string {
+	var used []string
+	for _, exclusion := range exclusions {
+		words := strings.Fields(CanonicalIngredient(exclusion))
+		if len(words) == 0 {
+			continue
+		}
+		for name := range r.Ingredients {
+			if containsWords(strings.Fields(CanonicalIngredient(name)), words) {
+				used = append(used, exclusion)
+				break
+			}
+		}
+	}
+	return used
+}
+
+// containsWords reports whether words appear in text as a contiguous run.
+func containsWords(text, words []string) bool {
+	for i := 0; i+len(words) <= len(text); i++ {
+		if slices.Equal(text[i:i+len(words)], words) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package recipe
+
+import "time"
+
+// SortCookingTime sorts recipes by cooking time, quickest first.
+const SortCookingTime = "cooking_time"
+
+// Filter selects and orders recipes in list queries. Zero values match
+// everything.
+type Filter struct {
+	Cuisine           string
+	DietaryPreference string
+	// MealType is one of MealTypes.
+	MealType string
+	// Style is a recipe style name, see NormalizeStyle.
+	Style string
+	// MaxCookingTime only matches recipes with a known cooking time of at most this many minutes.
+	MaxCookingTime int
+	// Sort is empty for the default order or SortCookingTime.
+	Sort string
+	// IncludeArchived also matches archived recipes, which are left out by default.
+	IncludeArchived bool
+	// CreatedFrom and CreatedTo only match recipes created in that range, both ends included.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// LastAccessedBefore only matches recipes last served before this time.
+	LastAccessedBefore time.Time
+}
+
+// IsEmpty reports whether the filter selects every recipe that isn't
+// archived, whatever its sort order.
+func (f Filter) IsEmpty() bool {
+	return f.Cuisine == "" && f.DietaryPreference == "" && f.MealType == "" && f.Style == "" &&
+		f.MaxCookingTime == 0 && !f.IncludeArchived && f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() &&
+		f.LastAccessedBefore.IsZero()
+}
@@ -0,0 +1,54 @@
+package recipe
+
+import (
+	"strings"
+	"unicode"
+)
+
+// illustrationMarker starts the food check description of food images that
+// aren't real photographs.
+const illustrationMarker = "ILLUSTRATION:"
+
+// FoodCheckPrompt asks an engine whether an image contains food. Descriptions
+// of non-food images start with "NO", and descriptions of food drawings,
+// illustrations or AI-generated pictures start with "ILLUSTRATION:".
+//
+// This is the default prompt; the engine clients can be given their own, as
+// long as it keeps asking for those two markers.
+const FoodCheckPrompt = "Analyze the provided image. If it contains food, return a brief recipe description. If not, respond with 'NO' followed by a 5-word description of the image content. If it contains food but is a drawing, illustration or AI-generated picture rather than a real photograph, start the description with '" + illustrationMarker + "'."
+
+// NotFoodInstruction is added to recipe generation prompts so an engine can
+// refuse non-food images itself. Callers normally run the food check first,
+// so this is only a fallback and costs no extra request.
+const NotFoodInstruction = " If the image does not contain food, respond with only the word 'NO' instead."
+
+// ImageMetadata is the stored result of an image's food check.
+type ImageMetadata struct {
+	Description string `json:"description"`
+	IsFood      bool   `json:"is_food"`
+}
+
+// IsNotFoodDescription reports whether a food check description marks the
+// image as not food: it starts with the word "NO", as FoodCheckPrompt asks.
+// Food descriptions that merely start with those letters, such as "Noodles
+// with..." or "No-bake cheesecake", don't count.
+func IsNotFoodDescription(description string) bool {
+	rest, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(description)), "NO")
+	if !ok {
+		return false
+	}
+	return rest == "" || !unicode.IsLetter(rune(rest[0])) && rest[0] != '-'
+}
+
+// IsNotFoodReply reports whether a recipe generation response is the refusal
+// NotFoodInstruction asks for: a "NO", possibly followed by an explanation,
+// and no JSON.
+func IsNotFoodReply(text string) bool {
+	return IsNotFoodDescription(text) && !strings.Contains(text, "{")
+}
+
+// IsPhoto reports whether a food check description is of a real photograph,
+// based on the marker FoodCheckPrompt asks for.
+func IsPhoto(description string) bool {
+	return !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(description)), illustrationMarker)
+}
@@ -0,0 +1,31 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPhoto(t *testing.T) {
+	assert.True(t, IsPhoto("A bowl of tomato soup with basil."))
+	assert.True(t, IsPhoto("NO a picture of a car"))
+	assert.False(t, IsPhoto("ILLUSTRATION: a cartoon slice of pizza"))
+	assert.False(t, IsPhoto("  illustration: watercolor of a cake"))
+}
+
+func TestIsNotFoodDescription(t *testing.T) {
+	assert.True(t, IsNotFoodDescription("NO a red car parked outside"))
+	assert.True(t, IsNotFoodDescription("No. A dog on a sofa."))
+	assert.False(t, IsNotFoodDescription("Noodles with peanut sauce and spring onions"))
+	assert.False(t, IsNotFoodDescription("No-bake cheesecake with berries"))
+	assert.False(t, IsNotFoodDescription("A bowl of tomato soup"))
+}
+
+func TestIsNotFoodReply(t *testing.T) {
+	assert.True(t, IsNotFoodReply("NO"))
+	assert.True(t, IsNotFoodReply(" no.\n"))
+	assert.False(t, IsNotFoodReply(`{"title": "No-bake cheesecake"}`))
+	assert.True(t, IsNotFoodReply("No, this is a picture of a car."))
+	assert.False(t, IsNotFoodReply("Nothing but a plate"))
+	assert.False(t, IsNotFoodReply("No-bake cheesecake: {\"title\": \"No-bake cheesecake\"}"))
+}
@@ -0,0 +1,114 @@
+package recipe
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ingredientDescriptors are words that describe how an ingredient is
+// prepared, sized or sold rather than what it is, e.g. "fresh" or "diced".
+var ingredientDescriptors = map[string]bool{
+	"boneless": true, "chopped": true, "cooked": true, "crushed": true,
+	"diced": true, "dried": true, "extra": true, "finely": true, "fresh": true,
+	"freshly": true, "grated": true, "large": true, "medium": true,
+	"minced": true, "organic": true, "peeled": true, "raw": true, "ripe": true,
+	"roma": true, "roughly": true, "shredded": true, "skinless": true,
+	"sliced": true, "small": true, "thinly": true, "virgin": true, "whole": true,
+}
+
+// irregularPlurals are plurals that the suffix rules in singular get wrong.
+var irregularPlurals = map[string]string{
+	"halves": "half", "leaves": "leaf", "loaves": "loaf", "molasses": "molasses",
+}
+
+// parenthetical matches an aside such as "(optional)" or "(about 200 g)".
+var parenthetical = regexp.MustCompile(`\([^)]*\)`)
+
+// CanonicalIngredient returns the name an ingredient is stored and matched
+// under: lowercased, with asides, descriptors and anything after a comma
+// removed, and the last word singular. "Roma tomatoes", "Tomato" and
+// "tomatoes, diced" are all "tomato". A name that is nothing but descriptors
+// is only lowercased.
+func CanonicalIngredient(name string) string {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	text := parenthetical.ReplaceAllString(lower, " ")
+	text, _, _ = strings.Cut(text, ",")
+
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if !ingredientDescriptors[word] {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return strings.Join(strings.Fields(lower), " ")
+	}
+	words[len(words)-1] = singular(words[len(words)-1])
+	return strings.Join(words, " ")
+}
+
+// singular returns the singular of an English plural noun, and other words
+// unchanged. It covers the plurals common in ingredient lists.
+func singular(word string) string {
+	if s, ok := irregularPlurals[word]; ok {
+		return s
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is") && len(word) > 3:
+		return strings.TrimSuffix(word, "s")
+	default:
+		return word
+	}
+}
+
+// NormalizeIngredients rekeys the recipe's ingredients by CanonicalIngredient
+// and records each canonical name's original in IngredientNames. Ingredients
+// that turn out to be the same have their quantities joined with " + ".
+// Normalizing a recipe twice changes nothing.
+func (r *Recipe) NormalizeIngredients() {
+	if len(r.Ingredients) == 0 {
+		return
+	}
+
+	// Sort so the same duplicates always merge in the same order
+	names := make([]string, 0, len(r.Ingredients))
+	for name := range r.Ingredients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ingredients := make(map[string]string, len(r.Ingredients))
+	originals := make(map[string]string, len(r.Ingredients))
+	for _, name := range names {
+		canonical := CanonicalIngredient(name)
+		quantity := r.Ingredients[name]
+		if existing, ok := ingredients[canonical]; ok {
+			if quantity != "" {
+				quantity = existing + " + " + quantity
+			} else {
+				quantity = existing
+			}
+		}
+		ingredients[canonical] = quantity
+
+		original := name
+		if known, ok := r.IngredientNames[name]; ok {
+			original = known
+		}
+		if _, ok := originals[canonical]; !ok {
+			originals[canonical] = original
+		}
+	}
+	r.Ingredients = ingredients
+	r.IngredientNames = originals
+}
@@ -0,0 +1,49 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalIngredient(t *testing.T) {
+	tests := map[string]string{
+		"Tomato":                           "tomato",
+		"tomatoes":                         "tomato",
+		"Roma tomatoes":                    "tomato",
+		"Onion, finely diced":              "onion",
+		"Garlic cloves (minced)":           "garlic clove",
+		"Fresh Blueberries":                "blueberry",
+		"Extra virgin olive oil":           "olive oil",
+		"Bay leaves":                       "bay leaf",
+		"Peaches":                          "peach",
+		"Molasses":                         "molasses",
+		"Couscous":                         "couscous",
+		"Hummus":                           "hummus",
+		"Egg":                              "egg",
+		"  Sea   Salt ":                    "sea salt",
+		"Chopped":                          "chopped",
+		"Boneless skinless chicken thighs": "chicken thigh",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, CanonicalIngredient(name), name)
+		assert.Equal(t, want, CanonicalIngredient(want), "canonical names must stay as they are: %s", want)
+	}
+}
+
+func TestNormalizeIngredients(t *testing.T) {
+	r := &Recipe{Ingredients: map[string]string{
+		"Tomatoes":      "2",
+		"Roma tomato":   "1",
+		"Garlic cloves": "3",
+		"Salt":          "",
+	}}
+	r.NormalizeIngredients()
+	assert.Equal(t, map[string]string{"tomato": "1 + 2", "garlic clove": "3", "salt": ""}, r.Ingredients)
+	assert.Equal(t, map[string]string{"tomato": "Roma tomato", "garlic clove": "Garlic cloves", "salt": "Salt"}, r.IngredientNames)
+
+	// The originals survive normalizing again
+	r.NormalizeIngredients()
+	assert.Equal(t, map[string]string{"tomato": "1 + 2", "garlic clove": "3", "salt": ""}, r.Ingredients)
+	assert.Equal(t, map[string]string{"tomato": "Roma tomato", "garlic clove": "Garlic cloves", "salt": "Salt"}, r.IngredientNames)
+}
@@ -0,0 +1,12 @@
+package recipe
+
+// IngredientsPrompt asks an engine for the ingredients visible in an image,
+// with estimated quantities, without a full recipe. Like ShoppingCartPrompt it
+// doubles as the food check.
+const IngredientsPrompt = "List the ingredients you can see in this image of food, with an estimate of the quantity of each. Only list what is visible, not what a recipe for the dish would need. Return a single, clean JSON object mapping ingredient names to estimated quantities, without markdown formatting. If the image does not contain food, respond with 'NO' followed by a 5-word description of the image content."
+
+// ParseIngredients parses an engine's response to IngredientsPrompt. It
+// returns ErrNotFoodImage if the engine said the image isn't food.
+func ParseIngredients(text string) (map[string]string, error) {
+	return parseQuantities(text, "ingredients")
+}
@@ -0,0 +1,100 @@
+package recipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Instruction is one step of a recipe. Duration and temperature are optional
+// and 0 when the step doesn't have one.
+type Instruction struct {
+	Text            string `json:"text" yaml:"text"`
+	DurationMinutes int    `json:"duration_minutes,omitempty" yaml:"duration_minutes,omitempty"`
+	TempCelsius     int    `json:"temp_celsius,omitempty" yaml:"temp_celsius,omitempty"`
+}
+
+// temperaturePattern matches a temperature such as "180", "180°C" or "350 F".
+var temperaturePattern = regexp.MustCompile(`(-?\d+(?:\.\d+)?)\s*°?\s*([cCfF])?`)
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Instruction. A
+// plain string is wrapped as the step's text, so recipes saved before steps
+// were structured, and engines that still answer with an array of strings,
+// keep working. Durations and temperatures may be numbers or strings such as
+// "10 minutes" or "350°F".
+func (i *Instruction) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*i = Instruction{Text: text}
+		return nil
+	}
+
+	var aux struct {
+		Text            string          `json:"text"`
+		DurationMinutes json.RawMessage `json:"duration_minutes"`
+		TempCelsius     json.RawMessage `json:"temp_celsius"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	duration, err := rawString(aux.DurationMinutes)
+	if err != nil {
+		return fmt.Errorf("invalid duration_minutes: %w", err)
+	}
+	temperature, err := rawString(aux.TempCelsius)
+	if err != nil {
+		return fmt.Errorf("invalid temp_celsius: %w", err)
+	}
+
+	*i = Instruction{
+		Text:            aux.Text,
+		DurationMinutes: ParseCookingMinutes(duration),
+		TempCelsius:     parseCelsius(temperature),
+	}
+	return nil
+}
+
+// rawString returns a JSON number or string as text, "" for null or a missing field.
+func rawString(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("expected a number or string, got %s", raw)
+	}
+}
+
+// parseCelsius extracts a temperature in Celsius from text such as "180°C"
+// or "350°F". A bare number counts as Celsius. It returns 0 when no
+// temperature can be found.
+func parseCelsius(text string) int {
+	match := temperaturePattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0
+	}
+	if strings.EqualFold(match[2], "f") {
+		value = (value - 32) * 5 / 9
+	}
+	return int(math.Round(value))
+}
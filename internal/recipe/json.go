@@ -0,0 +1,144 @@
+package recipe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformedJSON is returned when an engine's reply has no recipe JSON
+// that parses, e.g. because of prose mixed into the object.
+var ErrMalformedJSON = errors.New("engine response is not valid JSON")
+
+// ExtractJSON returns the JSON object embedded in a raw LLM response. Models
+// tend to wrap the object in markdown fences (```json ... ```) or surround it
+// with prose, so the fences are stripped first and the first balanced
+// {...} span that is valid JSON is returned. Prose may contain braces of its
+// own, e.g. "Here's the recipe {as requested}: {...}", so spans that don't
+// parse are skipped. If none parses, the span from the first '{' to the last
+// '}' is returned and the caller's unmarshal reports the problem.
+func ExtractJSON(raw string) (string, error) {
+	return extractJSON(raw, nil)
+}
+
+// ExtractRecipeJSON is ExtractJSON for recipe responses: it prefers the first
+// span that unmarshals to a valid Recipe, so a JSON aside such as a note
+// object before the recipe is skipped too. When no span is a valid recipe, the
+// first valid JSON object is returned, so Validate can say what's missing.
+func ExtractRecipeJSON(raw string) (string, error) {
+	return extractJSON(raw, func(candidate string) bool {
+		var r Recipe
+		return json.Unmarshal([]byte(candidate), &r) == nil && r.Validate() == nil
+	})
+}
+
+// UnmarshalRecipe extracts the recipe JSON from an engine's reply with
+// ExtractRecipeJSON and unmarshals it. Errors match ErrMalformedJSON, so
+// engines can ask again for a reply they can parse. The recipe isn't
+// validated.
+func UnmarshalRecipe(reply string) (*Recipe, error) {
+	cleanJSON, err := ExtractRecipeJSON(reply)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedJSON, err)
+	}
+	var r Recipe
+	if err := json.Unmarshal([]byte(cleanJSON), &r); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal recipe JSON: %w. Raw response: %s", ErrMalformedJSON, err, cleanJSON)
+	}
+	return &r, nil
+}
+
+// extractJSON returns the first candidate span accepted by prefer, else the
+// first valid JSON object, else the widest brace span.
+func extractJSON(raw string, prefer func(string) bool) (string, error) {
+	text := stripCodeFence(strings.TrimSpace(raw))
+
+	firstValid := ""
+	for _, candidate := range braceSpans(text) {
+		if !json.Valid([]byte(candidate)) {
+			continue
+		}
+		if prefer == nil || prefer(candidate) {
+			return candidate, nil
+		}
+		if firstValid == "" {
+			firstValid = candidate
+		}
+	}
+	if firstValid != "" {
+		return firstValid, nil
+	}
+
+	startIndex := strings.Index(text, "{")
+	endIndex := strings.LastIndex(text, "}")
+	if startIndex == -1 || endIndex == -1 || startIndex > endIndex {
+		return "", fmt.Errorf("could not find JSON object in response: %s", raw)
+	}
+	return text[startIndex : endIndex+1], nil
+}
+
+// stripCodeFence returns the body of the first markdown code fence in text if
+// it contains an object, and text unchanged otherwise.
+func stripCodeFence(text string) string {
+	start := strings.Index(text, "```")
+	if start == -1 {
+		return text
+	}
+	body := strings.TrimPrefix(text[start+3:], "json")
+	if end := strings.Index(body, "```"); end != -1 {
+		body = body[:end]
+	}
+	if !strings.Contains(body, "{") {
+		return text
+	}
+	return body
+}
+
+// braceSpans returns every balanced {...} span in text, in order of where they
+// start. Braces inside JSON strings don't count, so "{\"a\": \"}\"}" is one span.
+func braceSpans(text string) []string {
+	var spans []string
+	for start := strings.Index(text, "{"); start != -1; {
+		if end := matchingBrace(text, start); end != -1 {
+			spans = append(spans, text[start:end+1])
+		}
+		next := strings.Index(text[start+1:], "{")
+		if next == -1 {
+			break
+		}
+		start += next + 1
+	}
+	return spans
+}
+
+// matchingBrace returns the index of the '}' closing the '{' at start, or -1
+// if it is never closed.
+func matchingBrace(text string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch ch {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case ch == '"':
+			inString = true
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
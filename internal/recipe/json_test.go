@@ -0,0 +1,128 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"plain", `{"title": "Soup"}`, `{"title": "Soup"}`},
+		{"json fence", "```json\n{\"title\": \"Soup\"}\n```", `{"title": "Soup"}`},
+		{"bare fence", "```\n{\"title\": \"Soup\"}\n```", `{"title": "Soup"}`},
+		{"prose", `Here is your recipe: {"title": "Soup"} Enjoy!`, `{"title": "Soup"}`},
+		{"prose and fence", "Sure!\n```json\n{\"title\": \"Soup\"}\n```\nEnjoy!", `{"title": "Soup"}`},
+		{"nested", `{"title": "Soup", "ingredients": {"Salt": "1 tsp"}}`, `{"title": "Soup", "ingredients": {"Salt": "1 tsp"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractJSON(tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractJSON_NoObject(t *testing.T) {
+	_, err := ExtractJSON("I could not find a recipe for this image.")
+	assert.Error(t, err)
+
+	_, err = ExtractJSON("} backwards {")
+	assert.Error(t, err)
+}
+
+func TestExtractJSON_ProseWithBraces(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "braces in prose before the object",
+			raw:  `Here's the recipe {as requested}: {"title": "Soup"} Enjoy {and share}!`,
+			want: `{"title": "Soup"}`,
+		},
+		{
+			name: "unclosed brace in prose",
+			raw:  `Note: portions { are approximate. {"title": "Soup"}`,
+			want: `{"title": "Soup"}`,
+		},
+		{
+			name: "braces inside strings",
+			raw:  `Result: {"title": "Soup {spicy}", "note": "use \"}\" carefully"} -- done}`,
+			want: `{"title": "Soup {spicy}", "note": "use \"}\" carefully"}`,
+		},
+		{
+			name: "fence with prose braces outside",
+			raw:  "I used {template v2}.\n```json\n{\"title\": \"Soup\"}\n```\nCheers {chef}",
+			want: `{"title": "Soup"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractJSON(tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractRecipeJSON(t *testing.T) {
+	recipeJSON := `{"title": "Soup", "ingredients": {"Water": "1 l"}, "instructions": ["Boil water"]}`
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "note object before the recipe",
+			raw:  `Here's a note: {"note": "contains nuts"} and the recipe: ` + recipeJSON,
+			want: recipeJSON,
+		},
+		{
+			name: "example object before the recipe",
+			raw:  `The format is {"title": "..."}. ` + recipeJSON,
+			want: recipeJSON,
+		},
+		{
+			name: "nested objects are not mistaken for the recipe",
+			raw:  `{"ingredients": {"Salt": "1 tsp"}} then ` + recipeJSON,
+			want: recipeJSON,
+		},
+		{
+			name: "no valid recipe falls back to the first object",
+			raw:  `{"note": "no recipe"} {"title": "Soup"}`,
+			want: `{"note": "no recipe"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractRecipeJSON(tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUnmarshalRecipe(t *testing.T) {
+	r, err := UnmarshalRecipe("Here you go:\n```json\n{\"title\": \"Soup\", \"ingredients\": {\"leek\": \"1\"}}\n```")
+	assert.NoError(t, err)
+	assert.Equal(t, "Soup", r.Title)
+
+	for _, reply := range []string{
+		"Sorry, I can't help with that.",
+		`{"title": "Soup", "ingredients": {"leek": 1,}}`,
+	} {
+		_, err := UnmarshalRecipe(reply)
+		assert.ErrorIs(t, err, ErrMalformedJSON, reply)
+	}
+}
@@ -0,0 +1,87 @@
+package recipe
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Languages maps the language codes recipes can be generated in to their
+// English names, used in prompts.
+var Languages = map[string]string{
+	"ar": "Arabic",
+	"bn": "Bengali",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fa": "Persian",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"ms": "Malay",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"ta": "Tamil",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// ParseLanguage returns the code of a language given by its code, a locale
+// tag such as "fr-CA", or its English name, ignoring case. It returns "" if
+// value is empty.
+func ParseLanguage(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if locale, err := ParseLocale(value); err == nil {
+		if _, ok := Languages[locale.Language]; ok {
+			return locale.Language, nil
+		}
+	}
+	for code, name := range Languages {
+		if strings.EqualFold(value, name) {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported language %q, expected one of %s", value, strings.Join(slices.Sorted(maps.Keys(Languages)), ", "))
+}
+
+type languageKey struct{}
+
+// WithLanguage returns a context that asks the engines to generate recipes
+// with it in a language, one of the codes of Languages.
+func WithLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// LanguageInstruction returns the sentence added to recipe prompts for the
+// language set with WithLanguage, or "" if there is none. The JSON keys and
+// the values parsed as enums stay in English.
+func LanguageInstruction(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	name, ok := Languages[language]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" Respond entirely in %s, including field values, but keep the JSON keys, and the values of 'meal_type' and 'difficulty', in English.", name)
+}
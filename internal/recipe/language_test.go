@@ -0,0 +1,37 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := map[string]string{
+		"fr":       "fr",
+		"FR":       "fr",
+		"fr-CA":    "fr",
+		"pt_BR":    "pt",
+		"French":   "fr",
+		" german ": "de",
+		"":         "",
+	}
+	for input, want := range tests {
+		language, err := ParseLanguage(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, language, input)
+	}
+
+	for _, input := range []string{"xx", "Klingon", "fr-CA-x"} {
+		_, err := ParseLanguage(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestLanguageInstruction(t *testing.T) {
+	assert.Empty(t, LanguageInstruction(context.Background()))
+	ctx := WithLanguage(context.Background(), "fr")
+	assert.Contains(t, LanguageInstruction(ctx), "Respond entirely in French")
+	assert.Contains(t, LanguageInstruction(ctx), "keep the JSON keys")
+}
@@ -0,0 +1,213 @@
+package recipe
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Locale is a language and optional region, e.g. "de-DE" or "fr".
+type Locale struct {
+	Language string
+	Region   string
+}
+
+var localePattern = regexp.MustCompile(`^([a-zA-Z]{2,3})(?:[-_]([a-zA-Z]{2}|\d{3}))?$`)
+
+// ParseLocale parses a locale tag such as "de-DE", "en_GB" or "fr".
+func ParseLocale(tag string) (Locale, error) {
+	match := localePattern.FindStringSubmatch(strings.TrimSpace(tag))
+	if match == nil {
+		return Locale{}, fmt.Errorf("invalid locale %q", tag)
+	}
+	return Locale{Language: strings.ToLower(match[1]), Region: strings.ToUpper(match[2])}, nil
+}
+
+// imperialRegions still use US customary units.
+var imperialRegions = map[string]bool{"US": true, "LR": true, "MM": true}
+
+// decimalCommaLanguages write decimals with a comma, e.g. "1,5".
+var decimalCommaLanguages = map[string]bool{
+	"bg": true, "ca": true, "cs": true, "da": true, "de": true, "el": true,
+	"es": true, "et": true, "fi": true, "fr": true, "hr": true, "hu": true,
+	"id": true, "it": true, "lt": true, "lv": true, "nb": true, "nl": true,
+	"nn": true, "no": true, "pl": true, "pt": true, "ro": true, "ru": true,
+	"sk": true, "sl": true, "sr": true, "sv": true, "tr": true, "uk": true,
+	"vi": true,
+}
+
+// metric reports whether the locale uses metric units. English without a
+// region is assumed to be US English, the models' default.
+func (l Locale) metric() bool {
+	if l.Region == "" {
+		return l.Language != "en"
+	}
+	return !imperialRegions[l.Region]
+}
+
+// measureUnit is a unit of measure and its metric equivalent.
+type measureUnit struct {
+	names  []string
+	factor float64
+	metric string
+}
+
+// usUnits are the units converted for metric locales. Spoons use the rounded
+// metric spoon sizes cooks expect rather than the exact conversion.
+var usUnits = []measureUnit{
+	{[]string{"fluid ounces", "fluid ounce", "fl. oz.", "fl. oz", "fl oz"}, 29.5735, "ml"},
+	{[]string{"cups", "cup"}, 236.588, "ml"},
+	{[]string{"tablespoons", "tablespoon", "tbsp.", "tbsp", "tbs"}, 15, "ml"},
+	{[]string{"teaspoons", "teaspoon", "tsp.", "tsp"}, 5, "ml"},
+	{[]string{"pints", "pint", "pt"}, 473.176, "ml"},
+	{[]string{"quarts", "quart", "qt"}, 946.353, "ml"},
+	{[]string{"gallons", "gallon", "gal"}, 3785.41, "ml"},
+	{[]string{"ounces", "ounce", "oz.", "oz"}, 28.3495, "g"},
+	{[]string{"pounds", "pound", "lbs.", "lbs", "lb.", "lb"}, 453.592, "g"},
+	{[]string{"inches", "inch", "in."}, 2.54, "cm"},
+}
+
+// unicodeFractions maps vulgar fraction characters to their values.
+var unicodeFractions = map[string]float64{
+	"½": 0.5, "⅓": 1.0 / 3, "⅔": 2.0 / 3, "¼": 0.25, "¾": 0.75, "⅛": 0.125,
+}
+
+// quantityPattern matches the amount at the start of a quantity: a mixed
+// number ("1 1/2", "1½"), a fraction ("1/2", "½") or a number ("2", "1.5").
+var quantityPattern = regexp.MustCompile(`^(?:(\d+)\s+(\d+)/(\d+)|(\d+)\s*([½⅓⅔¼¾⅛])|(\d+)/(\d+)|([½⅓⅔¼¾⅛])|(\d+(?:\.\d+)?))`)
+
+// FormatQuantity reformats an ingredient quantity such as "1/2 cup" for the
+// locale: US units become metric ones in metric locales, and decimals use the
+// locale's separator. Quantities it can't parse are returned unchanged, as
+// are all quantities for US locales.
+func (l Locale) FormatQuantity(quantity string) string {
+	if !l.metric() && !decimalCommaLanguages[l.Language] {
+		return quantity
+	}
+
+	text := strings.TrimSpace(quantity)
+	match := quantityPattern.FindStringSubmatch(text)
+	if match == nil {
+		return quantity
+	}
+	amount, fraction := parseAmount(match)
+	rest := text[len(match[0]):]
+
+	if l.metric() {
+		if value, unit, rest, ok := convertUnit(amount, rest); ok {
+			return l.formatNumber(value) + " " + unit + rest
+		}
+	}
+
+	// Without a unit conversion fractions read fine in any locale, so only
+	// decimals need the locale's separator
+	if fraction {
+		return quantity
+	}
+	return l.formatNumber(amount) + rest
+}
+
+// parseAmount returns the value of a quantityPattern match, and whether it
+// was written as a fraction.
+func parseAmount(match []string) (float64, bool) {
+	switch {
+	case match[1] != "":
+		whole, _ := strconv.ParseFloat(match[1], 64)
+		return whole + ratio(match[2], match[3]), true
+	case match[4] != "":
+		whole, _ := strconv.ParseFloat(match[4], 64)
+		return whole + unicodeFractions[match[5]], true
+	case match[6] != "":
+		return ratio(match[6], match[7]), true
+	case match[8] != "":
+		return unicodeFractions[match[8]], true
+	default:
+		value, _ := strconv.ParseFloat(match[9], 64)
+		return value, false
+	}
+}
+
+func ratio(numerator, denominator string) float64 {
+	n, _ := strconv.ParseFloat(numerator, 64)
+	d, _ := strconv.ParseFloat(denominator, 64)
+	if d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// convertUnit converts amount to metric if rest starts with a US unit, and
+// returns the converted value, the metric unit and what follows the unit.
+func convertUnit(amount float64, rest string) (float64, string, string, bool) {
+	trimmed := strings.TrimLeft(rest, " ")
+	lower := strings.ToLower(trimmed)
+	for _, unit := range usUnits {
+		for _, name := range unit.names {
+			if !hasUnitPrefix(lower, name) {
+				continue
+			}
+			value, metricUnit := amount*unit.factor, unit.metric
+			switch {
+			case metricUnit == "ml" && value >= 1000:
+				value, metricUnit = value/1000, "l"
+			case metricUnit == "g" && value >= 1000:
+				value, metricUnit = value/1000, "kg"
+			}
+			return roundMetric(value, metricUnit), metricUnit, trimmed[len(name):], true
+		}
+	}
+	return 0, "", "", false
+}
+
+// hasUnitPrefix reports whether text starts with the unit name as a whole
+// word, so "cup" matches "cup, sifted" but not "cupcakes".
+func hasUnitPrefix(text, name string) bool {
+	after, ok := strings.CutPrefix(text, name)
+	return ok && (after == "" || strings.ContainsAny(after[:1], " ,;)"))
+}
+
+// roundMetric rounds a converted amount to what a metric recipe would say,
+// e.g. 236.588 ml to 235 ml.
+func roundMetric(value float64, unit string) float64 {
+	switch {
+	case unit == "l" || unit == "kg":
+		return math.Round(value*100) / 100
+	case value >= 50:
+		return math.Round(value/5) * 5
+	case value >= 10:
+		return math.Round(value)
+	default:
+		return math.Round(value*10) / 10
+	}
+}
+
+// formatNumber formats a number with the locale's decimal separator.
+func (l Locale) formatNumber(value float64) string {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	if decimalCommaLanguages[l.Language] {
+		s = strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+// Localized returns a copy of the recipe with the quantities of its
+// ingredients and shopping cart formatted for the locale.
+func (r *Recipe) Localized(l Locale) *Recipe {
+	localized := *r
+	localized.Ingredients = l.formatQuantities(r.Ingredients)
+	localized.ShoppingCart = l.formatQuantities(r.ShoppingCart)
+	return &localized
+}
+
+func (l Locale) formatQuantities(quantities map[string]string) map[string]string {
+	if quantities == nil {
+		return nil
+	}
+	formatted := make(map[string]string, len(quantities))
+	for name, quantity := range quantities {
+		formatted[name] = l.FormatQuantity(quantity)
+	}
+	return formatted
+}
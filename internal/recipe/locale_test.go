@@ -0,0 +1,70 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatQuantity(t *testing.T) {
+	tests := []struct {
+		locale   string
+		quantity string
+		want     string
+	}{
+		{"en-US", "1/2 cup", "1/2 cup"},
+		{"en-US", "1.5 lbs", "1.5 lbs"},
+		{"en", "2 tbsp", "2 tbsp"},
+		{"en-GB", "1 cup", "235 ml"},
+		{"en-GB", "8 oz", "225 g"},
+		{"en-GB", "3 lbs", "1.36 kg"},
+		{"de-DE", "1/2 cup", "120 ml"},
+		{"de-DE", "1 1/2 cups, sifted", "355 ml, sifted"},
+		{"de-DE", "½ tsp", "2,5 ml"},
+		{"de-DE", "2 Tablespoons", "30 ml"},
+		{"de-DE", "1.5 kg", "1,5 kg"},
+		{"de-DE", "2 eggs", "2 eggs"},
+		{"de-DE", "1/2 onion", "1/2 onion"},
+		{"fr", "1 inch ginger", "2,5 cm ginger"},
+		{"fr-FR", "4 quarts", "3,79 l"},
+		{"es-US", "1.5 cups", "1,5 cups"},
+		{"ja-JP", "1 cup", "235 ml"},
+		{"de-DE", "to taste", "to taste"},
+		{"de-DE", "a pinch", "a pinch"},
+		{"de-DE", "2 cupcakes", "2 cupcakes"},
+		{"de-DE", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.quantity, func(t *testing.T) {
+			locale, err := ParseLocale(tt.locale)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, locale.FormatQuantity(tt.quantity))
+		})
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	locale, err := ParseLocale("de_de")
+	assert.NoError(t, err)
+	assert.Equal(t, Locale{Language: "de", Region: "DE"}, locale)
+
+	for _, tag := range []string{"", "german", "de-", "de-DE-x"} {
+		_, err := ParseLocale(tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestRecipeLocalized(t *testing.T) {
+	r := &Recipe{
+		Title:        "Pancakes",
+		Ingredients:  map[string]string{"Flour": "2 cups", "Eggs": "2"},
+		ShoppingCart: map[string]string{"Milk": "1.5 cups"},
+	}
+
+	localized := r.Localized(Locale{Language: "de", Region: "DE"})
+	assert.Equal(t, map[string]string{"Flour": "475 ml", "Eggs": "2"}, localized.Ingredients)
+	assert.Equal(t, map[string]string{"Milk": "355 ml"}, localized.ShoppingCart)
+	// The original recipe is left alone
+	assert.Equal(t, "2 cups", r.Ingredients["Flour"])
+}
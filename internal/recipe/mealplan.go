@@ -0,0 +1,182 @@
+package recipe
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PlanMeals picks up to days recipes from candidates, one a day, for a
+// varied plan: no recipe is picked twice, and no cuisine is served two days
+// in a row unless only that cuisine is left. Among the rest, cuisines used
+// least so far come first, then those with the most candidates left, so
+// later days have something different to pick, then the order of
+// candidates. Cuisines are compared ignoring case. It returns fewer recipes
+// than days if there aren't enough candidates.
+func PlanMeals(candidates []*Recipe, days int) []*Recipe {
+	remaining := make(map[string]int)
+	for _, r := range candidates {
+		remaining[cuisineKey(r)]++
+	}
+
+	plan := make([]*Recipe, 0, min(max(days, 0), len(candidates)))
+	picked := make([]bool, len(candidates))
+	used := make(map[string]int)
+	previous := ""
+	for len(plan) < days {
+		best := -1
+		better := func(i int) bool {
+			cuisine, bestCuisine := cuisineKey(candidates[i]), cuisineKey(candidates[best])
+			if repeat, bestRepeat := len(plan) > 0 && cuisine == previous, len(plan) > 0 && bestCuisine == previous; repeat != bestRepeat {
+				return !repeat
+			}
+			if used[cuisine] != used[bestCuisine] {
+				return used[cuisine] < used[bestCuisine]
+			}
+			return remaining[cuisine] > remaining[bestCuisine]
+		}
+		for i := range candidates {
+			if !picked[i] && (best < 0 || better(i)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		r := candidates[best]
+		picked[best] = true
+		previous = cuisineKey(r)
+		used[previous]++
+		remaining[previous]--
+		plan = append(plan, r)
+	}
+	return plan
+}
+
+// cuisineKey returns the recipe's cuisine as PlanMeals compares it.
+func cuisineKey(r *Recipe) string {
+	return strings.ToLower(strings.TrimSpace(r.Cuisine))
+}
+
+// ShoppingList consolidates the shopping carts of recipes into a single
+// list, keyed by CanonicalIngredient so "Tomatoes" and "tomato" are bought
+// once. A recipe without a shopping cart contributes its ingredients. If
+// servings is positive, each recipe's quantities are first scaled from the
+// servings it makes to servings; recipes whose servings are unknown are
+// left as they are. Quantities in the same unit, such as "2 cups" and
+// "1 cup", are added up; the others are joined with " + ", as in
+// NormalizeIngredients.
+func ShoppingList(recipes []*Recipe, servings int) map[string]string {
+	quantities := make(map[string][]string)
+	for _, r := range recipes {
+		cart := r.ShoppingCart
+		if len(cart) == 0 {
+			cart = r.Ingredients
+		}
+
+		factor := 1.0
+		if recipeServings, err := strconv.Atoi(servingsPattern.FindString(r.Servings)); servings > 0 && err == nil && recipeServings > 0 {
+			factor = float64(servings) / float64(recipeServings)
+		}
+
+		// Sort so ingredients with the same canonical name are always listed in the same order
+		for _, name := range slices.Sorted(maps.Keys(cart)) {
+			canonical := CanonicalIngredient(name)
+			quantities[canonical] = append(quantities[canonical], scaleQuantity(cart[name], factor))
+		}
+	}
+
+	list := make(map[string]string, len(quantities))
+	for name, qs := range quantities {
+		list[name] = sumQuantities(qs)
+	}
+	return list
+}
+
+// splitQuantity splits a quantity such as "1 1/2 cups" into its amount and
+// what follows it, the unit. Ranges such as "2-3 cups" and quantities that
+// don't start with an amount aren't split.
+func splitQuantity(quantity string) (float64, string, bool) {
+	text := strings.TrimSpace(quantity)
+	match := quantityPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, "", false
+	}
+	amount, _ := parseAmount(match)
+	rest := text[len(match[0]):]
+	if rangePattern.MatchString(rest) {
+		return 0, "", false
+	}
+	return amount, rest, true
+}
+
+// scaleQuantity multiplies the amount of a quantity by factor. Quantities
+// splitQuantity can't split are returned unchanged.
+func scaleQuantity(quantity string, factor float64) string {
+	if factor == 1 {
+		return quantity
+	}
+	amount, unit, ok := splitQuantity(quantity)
+	if !ok {
+		return quantity
+	}
+	return formatAmount(amount*factor) + unit
+}
+
+// sumQuantities adds up the quantities in the same unit, compared ignoring
+// case and plurals, so "1 cup" and "2 Cups" are "3 Cups", and joins the sums and the quantities without an amount with " + ",
+// in the order they first appear. Repeated quantities without an amount,
+// such as "to taste", are listed once.
+func sumQuantities(quantities []string) string {
+	type part struct {
+		unit      string
+		amount    float64
+		largest   float64
+		hasAmount bool
+	}
+	var parts []*part
+	byKey := make(map[string]*part)
+	for _, quantity := range quantities {
+		amount, unit, ok := splitQuantity(quantity)
+		words := strings.Fields(strings.ToLower(unit))
+		for i, word := range words {
+			words[i] = singular(word)
+		}
+		key := "unit:" + strings.Join(words, " ")
+		if !ok {
+			unit = strings.TrimSpace(quantity)
+			key = "text:" + unit
+		}
+		p, seen := byKey[key]
+		if !seen {
+			p = &part{unit: unit, hasAmount: ok}
+			byKey[key] = p
+			parts = append(parts, p)
+		}
+		p.amount += amount
+		// The unit is written as it was for the largest amount, which is
+		// the likeliest to be plural when the sum is, or the longer, plural
+		// spelling in a tie
+		if amount > p.largest || (amount == p.largest && len(unit) > len(p.unit)) {
+			p.unit, p.largest = unit, amount
+		}
+	}
+
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		if p.hasAmount {
+			texts[i] = formatAmount(p.amount) + p.unit
+		} else {
+			texts[i] = p.unit
+		}
+	}
+	return strings.Join(texts, " + ")
+}
+
+// formatAmount formats an amount with at most two decimals.
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,87 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cuisines(recipes []*Recipe) []string {
+	var names []string
+	for _, r := range recipes {
+		names = append(names, r.Cuisine)
+	}
+	return names
+}
+
+func TestPlanMeals(t *testing.T) {
+	var candidates []*Recipe
+	for _, cuisine := range []string{"Italian", "italian", "Italian", "Italian", "Thai", "Thai", "Mexican"} {
+		candidates = append(candidates, &Recipe{Cuisine: cuisine})
+	}
+
+	plan := PlanMeals(candidates, 7)
+	assert.Equal(t, []string{"Italian", "Thai", "Mexican", "italian", "Thai", "Italian", "Italian"}, cuisines(plan))
+	seen := make(map[*Recipe]bool)
+	for _, r := range plan {
+		assert.False(t, seen[r], "recipe picked twice")
+		seen[r] = true
+	}
+
+	// With fewer days, no cuisine repeats back to back
+	plan = PlanMeals(candidates, 5)
+	assert.Equal(t, []string{"Italian", "Thai", "Mexican", "italian", "Thai"}, cuisines(plan))
+
+	// Italian has the most candidates left, so it goes between the others
+	plan = PlanMeals(candidates[1:6], 5)
+	assert.Equal(t, []string{"italian", "Thai", "Italian", "Thai", "Italian"}, cuisines(plan))
+
+	assert.Len(t, PlanMeals(candidates, 10), len(candidates))
+	assert.Empty(t, PlanMeals(nil, 7))
+	assert.Empty(t, PlanMeals(candidates, 0))
+}
+
+func TestShoppingList(t *testing.T) {
+	recipes := []*Recipe{
+		{
+			Servings:     "Serves 2",
+			ShoppingCart: map[string]string{"Tomatoes": "4", "Milk": "1 cup", "Salt": "to taste", "Basil": "1 bunch"},
+		},
+		{
+			Servings:     "4",
+			ShoppingCart: map[string]string{"tomato": "2", "milk": "2 Cups", "salt": "to taste", "Rice": "2-3 cups"},
+		},
+		{
+			// No shopping cart, so the ingredients are bought
+			Servings:    "unknown",
+			Ingredients: map[string]string{"Milk": "200 ml", "Onions, diced": "1/2"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"tomato": "6",
+		"milk":   "3 Cups + 200 ml",
+		"salt":   "to taste",
+		"basil":  "1 bunch",
+		"rice":   "2-3 cups",
+		"onion":  "0.5",
+	}, ShoppingList(recipes, 0))
+
+	// Scaled to 4 servings: the first recipe doubles, the last is unknown
+	assert.Equal(t, map[string]string{
+		"tomato": "10",
+		"milk":   "4 Cups + 200 ml",
+		"salt":   "to taste",
+		"basil":  "2 bunch",
+		"rice":   "2-3 cups",
+		"onion":  "0.5",
+	}, ShoppingList(recipes, 4))
+
+	assert.Empty(t, ShoppingList(nil, 4))
+}
+
+func TestSumQuantities(t *testing.T) {
+	assert.Equal(t, "1 cup", sumQuantities([]string{"1/3 cup", "1/3 cup", "1/3 cup"}))
+	assert.Equal(t, "1.5 kg + a pinch", sumQuantities([]string{"1 kg", "a pinch", "½ kg", "a pinch"}))
+	assert.Equal(t, "350g", sumQuantities([]string{"200g", "150g"}))
+}
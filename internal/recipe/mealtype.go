@@ -0,0 +1,33 @@
+package recipe
+
+import (
+	"slices"
+	"strings"
+)
+
+// Meal types a recipe is classified as.
+const (
+	MealTypeBreakfast = "breakfast"
+	MealTypeLunch     = "lunch"
+	MealTypeDinner    = "dinner"
+	MealTypeSnack     = "snack"
+	MealTypeDessert   = "dessert"
+)
+
+// MealTypes lists every meal type, in the order of a day.
+var MealTypes = []string{MealTypeBreakfast, MealTypeLunch, MealTypeDinner, MealTypeSnack, MealTypeDessert}
+
+// IsMealType reports whether mealType is one of MealTypes, ignoring case.
+func IsMealType(mealType string) bool {
+	return slices.Contains(MealTypes, strings.ToLower(strings.TrimSpace(mealType)))
+}
+
+// NormalizeMealType returns mealType lowercased, or MealTypeDinner when the
+// engine didn't classify the recipe or came up with a type of its own.
+func NormalizeMealType(mealType string) string {
+	mealType = strings.ToLower(strings.TrimSpace(mealType))
+	if !slices.Contains(MealTypes, mealType) {
+		return MealTypeDinner
+	}
+	return mealType
+}
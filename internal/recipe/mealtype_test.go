@@ -0,0 +1,36 @@
+package recipe
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMealType(t *testing.T) {
+	tests := map[string]string{
+		"breakfast":   MealTypeBreakfast,
+		" Dessert ":   MealTypeDessert,
+		"SNACK":       MealTypeSnack,
+		"":            MealTypeDinner,
+		"brunch":      MealTypeDinner,
+		"main course": MealTypeDinner,
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, NormalizeMealType(input), input)
+	}
+
+	assert.True(t, IsMealType("Lunch"))
+	assert.False(t, IsMealType("brunch"))
+	assert.False(t, IsMealType(""))
+}
+
+func TestRecipe_UnmarshalMealType(t *testing.T) {
+	var r Recipe
+	assert.NoError(t, json.Unmarshal([]byte(`{"title": "Pancakes", "meal_type": "Breakfast"}`), &r))
+	assert.Equal(t, MealTypeBreakfast, r.MealType)
+
+	r = Recipe{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"title": "Pancakes"}`), &r))
+	assert.Equal(t, MealTypeDinner, r.MealType)
+}
@@ -2,29 +2,113 @@ package recipe
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// Recipe represents the structure of the generated recipe
+// ErrNotFoodImage is returned by the recipe engines when the image does not contain food.
+var ErrNotFoodImage = errors.New("image does not contain food")
+
+// ErrInvalidRecipe is returned when a recipe is missing required fields,
+// usually because the engine returned an incomplete response.
+var ErrInvalidRecipe = errors.New("invalid recipe")
+
+// ErrContentBlocked is returned by the recipe engines when the provider's
+// safety or recitation filters blocked the request or the response.
+var ErrContentBlocked = errors.New("content blocked by the engine")
+
+// ErrResponseTruncated is returned by the recipe engines when the response was
+// cut off, e.g. at the maximum number of output tokens.
+var ErrResponseTruncated = errors.New("engine response truncated")
+
+// ErrQuotaExceeded is returned by the recipe engines when the provider rejects
+// a request because a quota or rate limit was hit.
+var ErrQuotaExceeded = errors.New("engine quota exceeded")
+
+// QuotaError is a quota or rate limit error, with the provider's hint on when
+// to retry. It matches ErrQuotaExceeded with errors.Is.
+type QuotaError struct {
+	// RetryAfter is how long the provider asked to wait, 0 if it didn't say.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrQuotaExceeded, e.Err)
+}
+
+func (e *QuotaError) Unwrap() []error {
+	return []error{ErrQuotaExceeded, e.Err}
+}
+
+// Recipe represents the structure of the generated recipe. The yaml tags
+// mirror the json ones for clients that ask for YAML.
 type Recipe struct {
-	ImageHash         string            `json:"image_hash" db:"image_hash"`
-	Title             string            `json:"title" db:"title"`
-	Ingredients       map[string]string `json:"ingredients"`
-	Instructions      []string          `json:"instructions"`
-	ShoppingCart      map[string]string `json:"shopping_cart"`
-	Cuisine           string            `json:"cuisine" db:"cuisine"`
-	DietaryPreference string            `json:"dietary_preference" db:"dietary_preference"`
-	CookingTime       string            `json:"cooking_time" db:"cooking_time"`
-	Servings          string            `json:"servings" db:"servings"`
-	ImagePath         string            `json:"image_path" db:"image_path"`
+	ImageHash   string            `json:"image_hash" db:"image_hash" yaml:"image_hash"`
+	Title       string            `json:"title" db:"title" yaml:"title"`
+	Ingredients map[string]string `json:"ingredients" yaml:"ingredients"`
+	// IngredientNames maps each ingredient's canonical name, its key in
+	// Ingredients, to the name the engine gave it. See NormalizeIngredients.
+	IngredientNames map[string]string `json:"ingredient_names,omitempty" yaml:"ingredient_names,omitempty"`
+	Instructions    []Instruction     `json:"instructions" yaml:"instructions"`
+	// StepImages holds an optional image path per instruction, by index. Steps without an image are "".
+	StepImages        []string          `json:"step_images,omitempty" yaml:"step_images,omitempty"`
+	ShoppingCart      map[string]string `json:"shopping_cart" yaml:"shopping_cart"`
+	Cuisine           string            `json:"cuisine" db:"cuisine" yaml:"cuisine"`
+	DietaryPreference string            `json:"dietary_preference" db:"dietary_preference" yaml:"dietary_preference"`
+	// MealType is one of MealTypes, MealTypeDinner if the engine didn't classify the recipe.
+	MealType string `json:"meal_type" db:"meal_type" yaml:"meal_type"`
+	// Difficulty is one of Difficulties, "" if the engine didn't rate the recipe.
+	Difficulty string `json:"difficulty,omitempty" db:"difficulty" yaml:"difficulty,omitempty"`
+	// Style is the recipe style the upload asked for with ?style=, "" if none.
+	Style string `json:"style,omitempty" db:"style" yaml:"style,omitempty"`
+	// Language is the code of the language the upload asked for with
+	// ?response_lang=, "" if none. See Languages.
+	Language string `json:"language,omitempty" db:"language" yaml:"language,omitempty"`
+	// Exclusions are the ingredients the upload asked to leave out with
+	// ?exclude=, nil if none. See ParseExclusions.
+	Exclusions  []string `json:"exclusions,omitempty" yaml:"exclusions,omitempty"`
+	CookingTime string   `json:"cooking_time" db:"cooking_time" yaml:"cooking_time"`
+	// CookingTimeMinutes is parsed from CookingTime when the recipe is saved, 0 if unknown.
+	CookingTimeMinutes int       `json:"cooking_time_minutes" db:"cooking_time_minutes" yaml:"cooking_time_minutes"`
+	Servings           string    `json:"servings" db:"servings" yaml:"servings"`
+	ImagePath          string    `json:"image_path" db:"image_path" yaml:"image_path"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at" yaml:"created_at"`
+	// LastAccessed is when the recipe was last served. It is updated in
+	// batches, so it may lag behind by up to a minute.
+	LastAccessed time.Time `json:"last_accessed" db:"last_accessed" yaml:"last_accessed"`
+
+	// Engine, Model and Temperature record which AI generated the recipe and with what settings.
+	Engine      string  `json:"engine" db:"engine" yaml:"engine"`
+	Model       string  `json:"model" db:"model" yaml:"model"`
+	Temperature float64 `json:"temperature" db:"temperature" yaml:"temperature"`
+
+	// Confidence is the engine's own assessment of the recipe, from 0 to 1, and
+	// Notes explains the assumptions it made. Confidence is nil if the engine
+	// didn't give one.
+	Confidence *float64 `json:"confidence,omitempty" db:"confidence" yaml:"confidence,omitempty"`
+	Notes      string   `json:"notes,omitempty" db:"notes" yaml:"notes,omitempty"`
+
+	// RequestedServings is the number of servings the recipe was generated
+	// for when the upload asked for one with ?servings=, 0 otherwise.
+	RequestedServings int `json:"requested_servings,omitempty" db:"requested_servings" yaml:"requested_servings,omitempty"`
+
+	// Archived recipes are hidden from recipe lists but can still be fetched by image hash.
+	Archived bool `json:"archived" db:"archived" yaml:"archived"`
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Recipe.
 func (r *Recipe) UnmarshalJSON(data []byte) error {
 	type Alias Recipe // Create an alias to avoid infinite recursion
 	aux := &struct {
-		Cuisine           string `json:"cuisine"`
-		DietaryPreference string `json:"dietary_preference"`
+		Cuisine           string          `json:"cuisine"`
+		DietaryPreference string          `json:"dietary_preference"`
+		MealType          string          `json:"meal_type"`
+		Difficulty        string          `json:"difficulty"`
+		Confidence        json.RawMessage `json:"confidence"`
 		*Alias
 	}{
 		Alias: (*Alias)(r),
@@ -35,7 +119,48 @@ func (r *Recipe) UnmarshalJSON(data []byte) error {
 	}
 
 	r.Cuisine = strings.ToLower(aux.Cuisine)
-	r.DietaryPreference = strings.ToLower(aux.DietaryPreference)
+	r.DietaryPreference = NormalizeDietaryPreference(strings.ToLower(aux.DietaryPreference))
+	r.MealType = NormalizeMealType(aux.MealType)
+	r.Difficulty = NormalizeDifficulty(aux.Difficulty)
+	r.Confidence = parseConfidence(aux.Confidence)
+
+	return nil
+}
 
+// parseConfidence reads a confidence score, which models give as a number or
+// a string, and sometimes as a percentage. Anything that isn't a score
+// between 0 and 1 is dropped rather than failing the whole recipe.
+func parseConfidence(raw json.RawMessage) *float64 {
+	text, err := rawString(raw)
+	if err != nil {
+		return nil
+	}
+	text = strings.TrimSpace(text)
+	percent := strings.HasSuffix(text, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+	if err != nil {
+		return nil
+	}
+	if percent || (value > 1 && value <= 100) {
+		value /= 100
+	}
+	if value < 0 || value > 1 {
+		return nil
+	}
+	return &value
+}
+
+// Validate checks that the recipe has a title, ingredients and instructions.
+// The returned error wraps ErrInvalidRecipe.
+func (r *Recipe) Validate() error {
+	if strings.TrimSpace(r.Title) == "" {
+		return fmt.Errorf("%w: missing title", ErrInvalidRecipe)
+	}
+	if len(r.Ingredients) == 0 {
+		return fmt.Errorf("%w: no ingredients", ErrInvalidRecipe)
+	}
+	if len(r.Instructions) == 0 {
+		return fmt.Errorf("%w: no instructions", ErrInvalidRecipe)
+	}
 	return nil
 }
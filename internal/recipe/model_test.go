@@ -0,0 +1,116 @@
+package recipe
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecipeValidate(t *testing.T) {
+	valid := func() *Recipe {
+		return &Recipe{
+			Title:        "Soup",
+			Ingredients:  map[string]string{"Water": "1 l"},
+			Instructions: []Instruction{{Text: "Boil water"}},
+		}
+	}
+	assert.NoError(t, valid().Validate())
+
+	tests := []struct {
+		name   string
+		modify func(r *Recipe)
+	}{
+		{"missing title", func(r *Recipe) { r.Title = " " }},
+		{"no ingredients", func(r *Recipe) { r.Ingredients = map[string]string{} }},
+		{"no instructions", func(r *Recipe) { r.Instructions = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(r)
+			assert.ErrorIs(t, r.Validate(), ErrInvalidRecipe)
+		})
+	}
+}
+
+func TestInstructionUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Instruction
+	}{
+		{
+			name: "plain strings",
+			data: `["Chop onions", "Fry"]`,
+			want: []Instruction{{Text: "Chop onions"}, {Text: "Fry"}},
+		},
+		{
+			name: "structured steps",
+			data: `[{"text": "Bake", "duration_minutes": 25, "temp_celsius": 180}, {"text": "Serve"}]`,
+			want: []Instruction{{Text: "Bake", DurationMinutes: 25, TempCelsius: 180}, {Text: "Serve"}},
+		},
+		{
+			name: "strings for duration and temperature",
+			data: `[{"text": "Roast", "duration_minutes": "1 hour 10 minutes", "temp_celsius": "350°F"}]`,
+			want: []Instruction{{Text: "Roast", DurationMinutes: 70, TempCelsius: 177}},
+		},
+		{
+			name: "mixed",
+			data: `["Preheat", {"text": "Bake", "duration_minutes": null}]`,
+			want: []Instruction{{Text: "Preheat"}, {Text: "Bake"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Instruction
+			assert.NoError(t, json.Unmarshal([]byte(tt.data), &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	var got []Instruction
+	assert.Error(t, json.Unmarshal([]byte(`[{"text": "Bake", "duration_minutes": true}]`), &got))
+}
+
+func TestRecipeUnmarshalJSON_Confidence(t *testing.T) {
+	tests := []struct {
+		confidence string
+		want       *float64
+	}{
+		{`0.8`, ptr(0.8)},
+		{`"0.65"`, ptr(0.65)},
+		{`85`, ptr(0.85)},
+		{`"90%"`, ptr(0.9)},
+		{`0`, ptr(0.0)},
+		{`null`, nil},
+		{`"very sure"`, nil},
+		{`-1`, nil},
+		{`250`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.confidence, func(t *testing.T) {
+			var r Recipe
+			assert.NoError(t, json.Unmarshal([]byte(`{"title": "Soup", "confidence": `+tt.confidence+`, "notes": "Assumed chicken stock"}`), &r))
+			if tt.want == nil {
+				assert.Nil(t, r.Confidence)
+			} else if assert.NotNil(t, r.Confidence) {
+				assert.InDelta(t, *tt.want, *r.Confidence, 1e-9)
+			}
+			assert.Equal(t, "Assumed chicken stock", r.Notes)
+		})
+	}
+
+	// Older engines and stored recipes leave both out
+	var r Recipe
+	assert.NoError(t, json.Unmarshal([]byte(`{"title": "Soup"}`), &r))
+	assert.Nil(t, r.Confidence)
+	assert.Empty(t, r.Notes)
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,49 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrImageFlagged is returned by the recipe engines when moderation flags an
+// image as inappropriate.
+var ErrImageFlagged = errors.New("image flagged by moderation")
+
+// ModerationError is a flagged image, with the reason the engine gave. It
+// matches ErrImageFlagged with errors.Is.
+type ModerationError struct {
+	Reason string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrImageFlagged, e.Reason)
+}
+
+func (e *ModerationError) Is(target error) bool {
+	return target == ErrImageFlagged
+}
+
+// moderationFlagged starts the response to ModerationPrompt for inappropriate images.
+const moderationFlagged = "FLAGGED"
+
+// ModerationPrompt asks an engine whether an image is inappropriate to keep.
+const ModerationPrompt = "You are moderating uploads to a recipe app. If the provided image contains nudity or sexual content, graphic violence or gore, hateful symbols, or other content inappropriate for a general audience, respond with '" + moderationFlagged + ":' followed by a 5-word reason. Otherwise respond with just 'SAFE'."
+
+// ParseModeration parses an engine's response to ModerationPrompt. It returns
+// nil for safe images and a *ModerationError for flagged ones. Any other
+// response is an error, so a confused engine doesn't let images through.
+func ParseModeration(text string) error {
+	response := strings.TrimSpace(text)
+	if len(response) >= len(moderationFlagged) && strings.EqualFold(response[:len(moderationFlagged)], moderationFlagged) {
+		reason := strings.TrimSpace(strings.TrimPrefix(response[len(moderationFlagged):], ":"))
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return &ModerationError{Reason: reason}
+	}
+	if strings.HasPrefix(strings.ToUpper(response), "SAFE") {
+		return nil
+	}
+	return fmt.Errorf("unexpected moderation response: %q", text)
+}
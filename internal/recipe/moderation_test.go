@@ -0,0 +1,26 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseModeration(t *testing.T) {
+	assert.NoError(t, ParseModeration("SAFE"))
+	assert.NoError(t, ParseModeration(" Safe.\n"))
+
+	err := ParseModeration("FLAGGED: shows graphic violence and gore")
+	assert.ErrorIs(t, err, ErrImageFlagged)
+	var modErr *ModerationError
+	assert.ErrorAs(t, err, &modErr)
+	assert.Equal(t, "shows graphic violence and gore", modErr.Reason)
+
+	err = ParseModeration("flagged")
+	assert.ErrorIs(t, err, ErrImageFlagged)
+
+	// Anything else is an error rather than a pass
+	err = ParseModeration("I'm not sure what this image shows.")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrImageFlagged)
+}
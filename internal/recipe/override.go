@@ -0,0 +1,75 @@
+package recipe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type modelKey struct{}
+
+// WithModel returns a context that asks the engines to use the named model
+// instead of their default, for requests made with it.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set with WithModel, or fallback if none is.
+func ModelFromContext(ctx context.Context, fallback string) string {
+	if model, ok := ctx.Value(modelKey{}).(string); ok && model != "" {
+		return model
+	}
+	return fallback
+}
+
+type servingsKey struct{}
+
+// WithServings returns a context that asks the engines to scale recipes
+// generated with it for the given number of servings.
+func WithServings(ctx context.Context, servings int) context.Context {
+	return context.WithValue(ctx, servingsKey{}, servings)
+}
+
+// ServingsFromContext returns the servings set with WithServings, or 0 if none are.
+func ServingsFromContext(ctx context.Context) int {
+	servings, _ := ctx.Value(servingsKey{}).(int)
+	return servings
+}
+
+// MaxNotesLength is the longest user notes accepted, in characters.
+const MaxNotesLength = 500
+
+type notesKey struct{}
+
+// WithNotes returns a context that passes the user's notes about the dish,
+// e.g. "this is leftover from yesterday's roast", to the engines generating
+// recipes with it. The notes should have been cleaned with CleanNotes.
+func WithNotes(ctx context.Context, notes string) context.Context {
+	return context.WithValue(ctx, notesKey{}, notes)
+}
+
+// NotesInstruction returns the sentence added to recipe prompts for the notes
+// set with WithNotes, or "" if there are none.
+func NotesInstruction(ctx context.Context) string {
+	notes, _ := ctx.Value(notesKey{}).(string)
+	if notes == "" {
+		return ""
+	}
+	return fmt.Sprintf(" Additional context from the user: %q.", notes)
+}
+
+// CleanNotes prepares user notes for a prompt: control characters such as
+// newlines become spaces, runs of whitespace are collapsed and the ends
+// trimmed. It returns an error if the cleaned notes are longer than
+// MaxNotesLength.
+func CleanNotes(notes string) (string, error) {
+	notes = strings.Join(strings.FieldsFunc(notes, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	if utf8.RuneCountInString(notes) > MaxNotesLength {
+		return "", fmt.Errorf("notes must be at most %d characters", MaxNotesLength)
+	}
+	return notes, nil
+}
@@ -0,0 +1,29 @@
+package recipe
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanNotes(t *testing.T) {
+	notes, err := CleanNotes("  leftover from\nyesterday's\t\troast  ")
+	assert.NoError(t, err)
+	assert.Equal(t, "leftover from yesterday's roast", notes)
+
+	notes, err = CleanNotes(strings.Repeat("é", MaxNotesLength))
+	assert.NoError(t, err)
+	assert.Len(t, []rune(notes), MaxNotesLength)
+
+	_, err = CleanNotes(strings.Repeat("a", MaxNotesLength+1))
+	assert.Error(t, err)
+}
+
+func TestNotesInstruction(t *testing.T) {
+	assert.Empty(t, NotesInstruction(context.Background()))
+
+	ctx := WithNotes(context.Background(), `it's the "roast" from Sunday`)
+	assert.Equal(t, ` Additional context from the user: "it's the \"roast\" from Sunday".`, NotesInstruction(ctx))
+}
@@ -0,0 +1,109 @@
+package recipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Pairing types.
+const (
+	PairingWine         = "wine"
+	PairingBeer         = "beer"
+	PairingNonAlcoholic = "non-alcoholic"
+)
+
+// Pairing is a drink suggested to go with a recipe.
+type Pairing struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// alcoholFreeDiets are the dietary preferences that only get non-alcoholic pairings.
+var alcoholFreeDiets = map[string]bool{
+	"halal":        true,
+	"alcohol-free": true,
+	"kid-friendly": true,
+}
+
+// AlcoholFree reports whether a dietary preference rules out alcoholic drinks.
+func AlcoholFree(dietaryPreference string) bool {
+	return alcoholFreeDiets[strings.ToLower(strings.TrimSpace(NormalizeDietaryPreference(dietaryPreference)))]
+}
+
+// PairingsPrompt asks an engine, without an image, for drinks to go with a
+// recipe. Alcohol is left out for diets that rule it out.
+func PairingsPrompt(r *Recipe) string {
+	names := make([]string, 0, len(r.Ingredients))
+	for name := range r.Ingredients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Here is a recipe for %s", r.Title)
+	if r.Cuisine != "" {
+		fmt.Fprintf(&b, ", %s cuisine", r.Cuisine)
+	}
+	b.WriteString(", made with:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "- %s: %s\n", name, r.Ingredients[name])
+	}
+	if AlcoholFree(r.DietaryPreference) {
+		fmt.Fprintf(&b, "Suggest 3 non-alcoholic drinks to serve with it; the recipe is %s, so don't suggest any alcohol.", r.DietaryPreference)
+	} else {
+		b.WriteString("Suggest drinks to serve with it: one or two wines, a beer and a non-alcoholic drink.")
+	}
+	fmt.Fprintf(&b, " Return a single, clean JSON object with a 'pairings' key holding an array of objects with 'type' (one of '%s', '%s' or '%s'), 'name' (string, a specific style or variety) and 'reason' (string, one sentence on why it suits the dish), without markdown formatting.", PairingWine, PairingBeer, PairingNonAlcoholic)
+	return b.String()
+}
+
+// ParsePairings parses an engine's response to PairingsPrompt. Pairings of
+// an unknown type or without a name are dropped, as are alcoholic ones when
+// the dietary preference rules alcohol out. It returns an error wrapping
+// ErrInvalidRecipe if no pairing is left.
+func ParsePairings(text, dietaryPreference string) ([]Pairing, error) {
+	cleanJSON, err := ExtractJSON(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Pairings []Pairing `json:"pairings"`
+	}
+	if err := json.Unmarshal([]byte(cleanJSON), &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pairings JSON: %w. Raw response: %s", err, cleanJSON)
+	}
+
+	alcoholFree := AlcoholFree(dietaryPreference)
+	pairings := make([]Pairing, 0, len(response.Pairings))
+	for _, p := range response.Pairings {
+		p.Type = normalizePairingType(p.Type)
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Type == "" || p.Name == "" || (alcoholFree && p.Type != PairingNonAlcoholic) {
+			continue
+		}
+		pairings = append(pairings, p)
+	}
+	if len(pairings) == 0 {
+		return nil, fmt.Errorf("%w: no pairings", ErrInvalidRecipe)
+	}
+	return pairings, nil
+}
+
+// normalizePairingType returns the pairing type for the ways models spell
+// it, or "" if it isn't one.
+func normalizePairingType(pairingType string) string {
+	switch strings.ToLower(strings.TrimSpace(pairingType)) {
+	case "wine", "red wine", "white wine", "rosé", "rose", "sparkling wine":
+		return PairingWine
+	case "beer", "ale", "lager":
+		return PairingBeer
+	case "non-alcoholic", "non alcoholic", "nonalcoholic", "alcohol-free", "mocktail", "soft drink":
+		return PairingNonAlcoholic
+	default:
+		return ""
+	}
+}
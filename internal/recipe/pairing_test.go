@@ -0,0 +1,46 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePairings(t *testing.T) {
+	text := "```json\n" + `{"pairings": [
+		{"type": "Red Wine", "name": "Chianti", "reason": "Its acidity matches the tomato sauce."},
+		{"type": "beer", "name": "Pilsner", "reason": "Crisp against the cheese."},
+		{"type": "Non Alcoholic", "name": "Sparkling lemonade", "reason": "Cuts through the richness."},
+		{"type": "cocktail", "name": "Negroni", "reason": "Unknown type."},
+		{"type": "wine", "name": "", "reason": "No name."}
+	]}` + "\n```"
+
+	pairings, err := ParsePairings(text, "vegetarian")
+	assert.NoError(t, err)
+	assert.Equal(t, []Pairing{
+		{Type: PairingWine, Name: "Chianti", Reason: "Its acidity matches the tomato sauce."},
+		{Type: PairingBeer, Name: "Pilsner", Reason: "Crisp against the cheese."},
+		{Type: PairingNonAlcoholic, Name: "Sparkling lemonade", Reason: "Cuts through the richness."},
+	}, pairings)
+
+	// Alcohol is dropped for diets that rule it out, even if the engine suggests it
+	pairings, err = ParsePairings(text, "Halal")
+	assert.NoError(t, err)
+	assert.Equal(t, []Pairing{{Type: PairingNonAlcoholic, Name: "Sparkling lemonade", Reason: "Cuts through the richness."}}, pairings)
+
+	_, err = ParsePairings(`{"pairings": [{"type": "wine", "name": "Rioja"}]}`, "halal")
+	assert.ErrorIs(t, err, ErrInvalidRecipe)
+}
+
+func TestPairingsPrompt(t *testing.T) {
+	r := &Recipe{Title: "Lamb tagine", Cuisine: "moroccan", Ingredients: map[string]string{"Lamb": "500 g", "Apricots": "100 g"}}
+	prompt := PairingsPrompt(r)
+	assert.Contains(t, prompt, "Lamb tagine, moroccan cuisine")
+	assert.Contains(t, prompt, "- Apricots: 100 g\n- Lamb: 500 g\n")
+	assert.Contains(t, prompt, "a beer")
+
+	r.DietaryPreference = "halal"
+	prompt = PairingsPrompt(r)
+	assert.Contains(t, prompt, "non-alcoholic drinks")
+	assert.NotContains(t, prompt, "a beer")
+}
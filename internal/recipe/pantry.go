@@ -0,0 +1,151 @@
+package recipe
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownServings is returned by MaxServings when the recipe's servings
+// can't be parsed, so the per-serving amounts are unknown.
+var ErrUnknownServings = errors.New("recipe servings are unknown")
+
+// ErrNothingMeasurable is returned by MaxServings when none of the recipe's
+// ingredients could be compared with the pantry.
+var ErrNothingMeasurable = errors.New("no ingredient quantities could be compared with the pantry")
+
+// metricUnits are the metric units quantities are measured in, with their
+// factor to the base unit of their dimension.
+var metricUnits = []measureUnit{
+	{[]string{"milliliters", "milliliter", "millilitres", "millilitre", "ml"}, 1, "ml"},
+	{[]string{"liters", "liter", "litres", "litre", "l"}, 1000, "ml"},
+	{[]string{"milligrams", "milligram", "mg"}, 0.001, "g"},
+	{[]string{"kilograms", "kilogram", "kg"}, 1000, "g"},
+	{[]string{"grams", "gram", "g"}, 1, "g"},
+	{[]string{"centimeters", "centimeter", "centimetres", "centimetre", "cm"}, 1, "cm"},
+}
+
+// rangePattern matches the separator of a quantity range such as "2-3 cups".
+var rangePattern = regexp.MustCompile(`^\s*(?:-|–|to)\s*`)
+
+// servingsPattern matches the first number of a servings string such as "Serves 4".
+var servingsPattern = regexp.MustCompile(`\d+`)
+
+// measure is a parsed quantity in the base unit of its dimension: ml, g or
+// cm, or "" for counts such as "2 eggs".
+type measure struct {
+	value     float64
+	dimension string
+}
+
+// parseMeasure parses a quantity such as "1 1/2 cups", "200 g" or "3 eggs".
+// Ranges count as their upper bound. Anything that isn't a known unit is a
+// count, whatever the noun.
+func parseMeasure(quantity string) (measure, bool) {
+	text := strings.TrimSpace(quantity)
+	match := quantityPattern.FindStringSubmatch(text)
+	if match == nil {
+		return measure{}, false
+	}
+	amount, _ := parseAmount(match)
+	rest := text[len(match[0]):]
+
+	if sep := rangePattern.FindString(rest); sep != "" {
+		if upper := quantityPattern.FindStringSubmatch(rest[len(sep):]); upper != nil {
+			amount, _ = parseAmount(upper)
+			rest = rest[len(sep)+len(upper[0]):]
+		}
+	}
+
+	lower := strings.ToLower(strings.TrimLeft(rest, " "))
+	for _, units := range [][]measureUnit{metricUnits, usUnits} {
+		for _, unit := range units {
+			for _, name := range unit.names {
+				if hasUnitPrefix(lower, name) {
+					return measure{value: amount * unit.factor, dimension: unit.metric}, true
+				}
+			}
+		}
+	}
+	return measure{value: amount}, true
+}
+
+// ServingsEstimate is how many servings of a recipe a pantry can make.
+type ServingsEstimate struct {
+	MaxServings int `json:"max_servings"`
+	// LimitingIngredient is the recipe ingredient that runs out first.
+	LimitingIngredient string `json:"limiting_ingredient"`
+	// Missing lists measurable ingredients that aren't in the pantry at all.
+	Missing []string `json:"missing"`
+	// UnitMismatch lists ingredients whose recipe and pantry quantities can't
+	// be converted into each other, e.g. grams and cups.
+	UnitMismatch []string `json:"unit_mismatch"`
+	// Unmeasured lists ingredients without a usable quantity, e.g. "to taste".
+	Unmeasured []string `json:"unmeasured"`
+}
+
+// MaxServings computes the most whole servings of the recipe the pantry can
+// make: each ingredient's pantry quantity is divided by what one serving
+// needs, and the smallest result wins. Pantry ingredients are matched by
+// their canonical name, so "Tomatoes" in the pantry covers "tomato". Ingredients that can't be compared are skipped and listed in
+// the estimate.
+func MaxServings(r *Recipe, pantry map[string]string) (*ServingsEstimate, error) {
+	servings, err := strconv.Atoi(servingsPattern.FindString(r.Servings))
+	if err != nil || servings <= 0 {
+		return nil, ErrUnknownServings
+	}
+
+	stock := make(map[string]string, len(pantry))
+	for name, quantity := range pantry {
+		stock[CanonicalIngredient(name)] = quantity
+	}
+
+	// Walk ingredients in a stable order so ties always name the same ingredient
+	names := make([]string, 0, len(r.Ingredients))
+	for name := range r.Ingredients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	estimate := &ServingsEstimate{Missing: []string{}, UnitMismatch: []string{}, Unmeasured: []string{}}
+	best := math.Inf(1)
+	for _, name := range names {
+		need, ok := parseMeasure(r.Ingredients[name])
+		if !ok || need.value <= 0 {
+			estimate.Unmeasured = append(estimate.Unmeasured, name)
+			continue
+		}
+
+		quantity, ok := stock[CanonicalIngredient(name)]
+		if !ok {
+			estimate.Missing = append(estimate.Missing, name)
+			if best > 0 {
+				best, estimate.LimitingIngredient = 0, name
+			}
+			continue
+		}
+		have, ok := parseMeasure(quantity)
+		if !ok {
+			estimate.Unmeasured = append(estimate.Unmeasured, name)
+			continue
+		}
+		if have.dimension != need.dimension {
+			estimate.UnitMismatch = append(estimate.UnitMismatch, name)
+			continue
+		}
+
+		if possible := have.value * float64(servings) / need.value; possible < best {
+			best, estimate.LimitingIngredient = possible, name
+		}
+	}
+
+	if math.IsInf(best, 1) {
+		return nil, ErrNothingMeasurable
+	}
+	// Allow for floating point error, e.g. 3 cups of a 1/3 cup serving
+	estimate.MaxServings = int(math.Floor(best + 1e-9))
+	return estimate, nil
+}
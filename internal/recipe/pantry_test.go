@@ -0,0 +1,110 @@
+package recipe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxServings(t *testing.T) {
+	pancakes := &Recipe{
+		Title:    "Pancakes",
+		Servings: "4 servings",
+		Ingredients: map[string]string{
+			"Flour": "2 cups",
+			"Milk":  "1 1/2 cups",
+			"Eggs":  "2",
+			"Salt":  "to taste",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		pantry   map[string]string
+		servings int
+		limiting string
+	}{
+		{
+			name:     "eggs run out first",
+			pantry:   map[string]string{"flour": "10 cups", "milk": "2 l", "eggs": "3"},
+			servings: 6,
+			limiting: "Eggs",
+		},
+		{
+			name:     "metric pantry against US recipe",
+			pantry:   map[string]string{"Flour": "1 kg", "Milk": "500 ml", "Eggs": "12 eggs"},
+			servings: 5,
+			limiting: "Milk",
+		},
+		{
+			name:     "missing ingredient",
+			pantry:   map[string]string{"Flour": "10 cups", "Milk": "1 gallon"},
+			servings: 0,
+			limiting: "Eggs",
+		},
+		{
+			name:     "less than one serving",
+			pantry:   map[string]string{"Flour": "1/4 cup", "Milk": "1 l", "Eggs": "6"},
+			servings: 0,
+			limiting: "Flour",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate, err := MaxServings(pancakes, tt.pantry)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.servings, estimate.MaxServings)
+			assert.Equal(t, tt.limiting, estimate.LimitingIngredient)
+			assert.Equal(t, []string{"Salt"}, estimate.Unmeasured)
+		})
+	}
+}
+
+func TestMaxServings_UnitMismatch(t *testing.T) {
+	r := &Recipe{
+		Servings:    "2",
+		Ingredients: map[string]string{"Flour": "1 cup", "Butter": "100 g"},
+	}
+
+	// Flour is in grams but the recipe measures it in cups, so only butter counts
+	estimate, err := MaxServings(r, map[string]string{"Flour": "500 g", "Butter": "1 lb"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Flour"}, estimate.UnitMismatch)
+	assert.Equal(t, "Butter", estimate.LimitingIngredient)
+	assert.Equal(t, 9, estimate.MaxServings)
+
+	_, err = MaxServings(r, map[string]string{"Flour": "500 g", "Butter": "2 sticks"})
+	assert.ErrorIs(t, err, ErrNothingMeasurable)
+}
+
+func TestMaxServings_UnknownServings(t *testing.T) {
+	r := &Recipe{Servings: "a crowd", Ingredients: map[string]string{"Rice": "1 cup"}}
+	_, err := MaxServings(r, map[string]string{"Rice": "2 cups"})
+	assert.ErrorIs(t, err, ErrUnknownServings)
+}
+
+func TestParseMeasure(t *testing.T) {
+	tests := []struct {
+		quantity string
+		want     measure
+	}{
+		{"2 tbsp", measure{30, "ml"}},
+		{"1.5 kg", measure{1500, "g"}},
+		{"2-3 cloves", measure{3, ""}},
+		{"1 to 2 lbs", measure{907.184, "g"}},
+		{"½ l", measure{500, "ml"}},
+		{"250g", measure{250, "g"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.quantity, func(t *testing.T) {
+			got, ok := parseMeasure(tt.quantity)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want.dimension, got.dimension)
+			assert.InDelta(t, tt.want.value, got.value, 0.001)
+		})
+	}
+
+	_, ok := parseMeasure("a pinch")
+	assert.False(t, ok)
+}
@@ -0,0 +1,12 @@
+package recipe
+
+import "time"
+
+// Report is a user's report of a problematic recipe.
+type Report struct {
+	ID         int       `json:"id" db:"id"`
+	ImageHash  string    `json:"image_hash" db:"image_hash"`
+	Reason     string    `json:"reason" db:"reason"`
+	ReporterIP string    `json:"reporter_ip" db:"reporter_ip"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,72 @@
+package recipe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// PromptSample is a prompt sent to an engine and its response, kept so
+// prompt quality can be reviewed on real traffic. Images are recorded by
+// hash rather than content.
+type PromptSample struct {
+	ID     int    `json:"id" db:"id"`
+	Engine string `json:"engine" db:"engine"`
+	Model  string `json:"model" db:"model"`
+	Prompt string `json:"prompt" db:"prompt"`
+	// ImageHashes are the SHA-256 hashes of the images sent with the prompt,
+	// see HashImage.
+	ImageHashes []string `json:"image_hashes"`
+	Response    string   `json:"response" db:"response"`
+	// Error is the error the engine returned instead of a response, if any.
+	Error     string    `json:"error,omitempty" db:"error"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// HashImage returns the hex SHA-256 hash of an image, the same as its hash
+// in the "bytes" hash mode.
+func HashImage(imageData []byte) string {
+	hash := sha256.Sum256(imageData)
+	return hex.EncodeToString(hash[:])
+}
+
+// promptSampleTimeout bounds saving a sample, which happens after the
+// request it came from may have finished.
+const promptSampleTimeout = 5 * time.Second
+
+// PromptSampler records a random share of the prompts sent to an engine,
+// with their responses, so a representative sample can be reviewed without
+// logging everything.
+type PromptSampler struct {
+	rate float64
+	save func(ctx context.Context, sample *PromptSample) error
+}
+
+// NewPromptSampler creates a sampler recording a share rate, between 0 and
+// 1, of prompts with save.
+func NewPromptSampler(rate float64, save func(ctx context.Context, sample *PromptSample) error) *PromptSampler {
+	return &PromptSampler{rate: rate, save: save}
+}
+
+// Sample decides whether to record an exchange with an engine and if so
+// saves the sample built by build, in the background so the request isn't
+// held up. Building is skipped for exchanges that aren't sampled. A nil
+// sampler records nothing.
+func (s *PromptSampler) Sample(ctx context.Context, build func() *PromptSample) {
+	if s == nil || rand.Float64() >= s.rate {
+		return
+	}
+
+	sample := build()
+	sample.CreatedAt = time.Now()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), promptSampleTimeout)
+		defer cancel()
+		if err := s.save(ctx, sample); err != nil {
+			log.Printf("failed to save %s prompt sample: %s", sample.Engine, err.Error())
+		}
+	}()
+}
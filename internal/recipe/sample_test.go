@@ -0,0 +1,48 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptSampler(t *testing.T) {
+	saved := make(chan *PromptSample, 10)
+	save := func(ctx context.Context, sample *PromptSample) error {
+		saved <- sample
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	NewPromptSampler(1, save).Sample(ctx, func() *PromptSample {
+		return &PromptSample{Engine: "local", Prompt: "user: hi", Response: "hello"}
+	})
+	// The sample is saved even after the request is over
+	cancel()
+	select {
+	case sample := <-saved:
+		assert.Equal(t, "hello", sample.Response)
+		assert.False(t, sample.CreatedAt.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("sample wasn't saved")
+	}
+
+	built := false
+	NewPromptSampler(0, save).Sample(context.Background(), func() *PromptSample {
+		built = true
+		return &PromptSample{}
+	})
+	var sampler *PromptSampler
+	sampler.Sample(context.Background(), func() *PromptSample {
+		built = true
+		return &PromptSample{}
+	})
+	assert.False(t, built)
+	assert.Empty(t, saved)
+}
+
+func TestHashImage(t *testing.T) {
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", HashImage([]byte("hello")))
+}
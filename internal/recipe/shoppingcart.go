@@ -0,0 +1,60 @@
+package recipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShoppingCartPrompt asks an engine for just the shopping list of the dish in
+// an image. It is much lighter than a full recipe and doubles as the food check.
+const ShoppingCartPrompt = "List the ingredients to buy to make the food item in this image. Return a single, clean JSON object mapping ingredient names to the quantities to buy, without markdown formatting. If the image does not contain food, respond with 'NO' followed by a 5-word description of the image content."
+
+// IngredientsShoppingCartPrompt asks an engine, without an image, for the
+// shopping list for a recipe's ingredients, leaving out pantry staples most
+// kitchens already have.
+func IngredientsShoppingCartPrompt(ingredients map[string]string) string {
+	names := make([]string, 0, len(ingredients))
+	for name := range ingredients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Here are the ingredients of a recipe:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "- %s: %s\n", name, ingredients[name])
+	}
+	b.WriteString("List what to buy to make it. Leave out pantry staples most kitchens already have, such as salt, pepper, water and cooking oil, and round quantities up to what shops sell. Return a single, clean JSON object mapping ingredient names to the quantities to buy, without markdown formatting.")
+	return b.String()
+}
+
+// ParseShoppingCart parses an engine's response to ShoppingCartPrompt or
+// IngredientsShoppingCartPrompt. It returns ErrNotFoodImage if the engine said
+// the image isn't food.
+func ParseShoppingCart(text string) (map[string]string, error) {
+	return parseQuantities(text, "shopping cart")
+}
+
+// parseQuantities parses a JSON object mapping ingredient names to
+// quantities, named what in errors.
+func parseQuantities(text, what string) (map[string]string, error) {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(text)), "no") {
+		return nil, ErrNotFoodImage
+	}
+
+	cleanJSON, err := ExtractJSON(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var quantities map[string]string
+	if err := json.Unmarshal([]byte(cleanJSON), &quantities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s JSON: %w. Raw response: %s", what, err, cleanJSON)
+	}
+	if len(quantities) == 0 {
+		return nil, fmt.Errorf("%w: empty %s", ErrInvalidRecipe, what)
+	}
+	return quantities, nil
+}
@@ -5,25 +5,82 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // Store defines the interface for recipe data operations.
 type Store interface {
 	GetRecipeByImageHash(ctx context.Context, imageHash string) (*Recipe, error)
 	SaveRecipe(ctx context.Context, recipe *Recipe) error
-	GetImageMetadata(ctx context.Context, imageHash string) (string, error)
-	SaveImageMetadata(ctx context.Context, imageHash, description string) error
-	GetRecipesByCuisineOrDietaryPreference(ctx context.Context, cuisine, dietaryPreference string) ([]*Recipe, error)
+	GetImageMetadata(ctx context.Context, imageHash string) (*ImageMetadata, error)
+	SaveImageMetadata(ctx context.Context, imageHash, description string, isFood bool) error
+	GetRecipes(ctx context.Context, filter Filter) ([]*Recipe, error)
+	GetRecipesPage(ctx context.Context, filter Filter, limit, offset int) ([]*Recipe, int, error)
 	SaveImageData(ctx context.Context, imageHash, imageData string) error
 	GetImageData(ctx context.Context, imageHash string) (string, error)
+	GetImageDataHashes(ctx context.Context) ([]string, error)
+	GetRecipesByHashes(ctx context.Context, imageHashes []string) (map[string]*Recipe, error)
+	GetRecentRecipes(ctx context.Context, cuisine string, limit int) ([]*Recipe, error)
+	DeleteRecipe(ctx context.Context, imageHash string) error
+	DeleteRecipes(ctx context.Context, cuisine, dietaryPreference string) ([]string, error)
+	DeleteStaleRecipes(ctx context.Context, before time.Time) ([]string, error)
+	MergeRecipes(ctx context.Context, keep, merge string) (string, error)
+	TouchRecipes(ctx context.Context, imageHashes []string) error
+	GetRecipesUsingIngredient(ctx context.Context, ingredient, excludeImageHash string) ([]*Recipe, error)
+	SaveReport(ctx context.Context, report *Report) (int, error)
+	GetReports(ctx context.Context) ([]*Report, error)
+	SavePromptSample(ctx context.Context, sample *PromptSample) error
+	ArchiveRecipe(ctx context.Context, imageHash string) error
+	SetStepImages(ctx context.Context, imageHash string, stepImages []string) error
+	SetShoppingCart(ctx context.Context, imageHash string, shoppingCart map[string]string) error
+	GetPairings(ctx context.Context, imageHash string) ([]Pairing, error)
+	SetPairings(ctx context.Context, imageHash string, pairings []Pairing) error
+	GetStorageStats(ctx context.Context) (*StorageStats, error)
 }
 
 // PostgresStore implements the RecipeStore interface for PostgreSQL.
 type PostgresStore struct {
 	db *sqlx.DB
+
+	// SlowQueryThreshold logs a warning for queries that take longer than this. Zero disables it.
+	SlowQueryThreshold time.Duration
+}
+
+// recipeMigrations add the recipes columns introduced after the table was
+// first created, and bring older rows up to date. Each one must be safe to run
+// on every startup.
+var recipeMigrations = []string{
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS engine TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS temperature DOUBLE PRECISION NOT NULL DEFAULT 0",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS cooking_time_minutes INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS step_images JSONB NOT NULL DEFAULT '[]'",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS confidence DOUBLE PRECISION",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS requested_servings INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS meal_type TEXT NOT NULL DEFAULT 'dinner'",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS pairings JSONB",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS difficulty TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS ingredient_names JSONB NOT NULL DEFAULT '{}'",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS perceptual_hash TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS style TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS last_accessed TIMESTAMPTZ NOT NULL DEFAULT NOW()",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE recipes ADD COLUMN IF NOT EXISTS exclusions JSONB NOT NULL DEFAULT '[]'",
+	// Instructions used to be an array of strings; wrap them as {"text": ...} steps
+	`UPDATE recipes SET instructions = (
+		SELECT jsonb_agg(CASE WHEN jsonb_typeof(step) = 'string' THEN jsonb_build_object('text', step #>> '{}') ELSE step END ORDER BY n)
+		FROM jsonb_array_elements(instructions) WITH ORDINALITY AS steps(step, n)
+	) WHERE jsonb_typeof(instructions) = 'array'
+	AND EXISTS (SELECT 1 FROM jsonb_array_elements(instructions) AS steps(step) WHERE jsonb_typeof(step) = 'string')`,
 }
 
 // NewPostgresStore creates a new PostgresStore.
@@ -53,6 +110,17 @@ func NewPostgresStore(dataSourceName string) (*PostgresStore, error) {
 		return nil, fmt.Errorf("failed to create recipes table: %w", err)
 	}
 
+	// Add columns introduced after the recipes table was first created
+	for _, migration := range recipeMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return nil, fmt.Errorf("failed to migrate recipes table: %w", err)
+		}
+	}
+
+	if err := backfillCookingTimeMinutes(db); err != nil {
+		return nil, err
+	}
+
 	// Create image_metadata table if not exists
 	schema = `
 	CREATE TABLE IF NOT EXISTS image_metadata (
@@ -64,6 +132,11 @@ func NewPostgresStore(dataSourceName string) (*PostgresStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create image_metadata table: %w", err)
 	}
+	// is_food is NULL for rows saved before it existed
+	_, err = db.Exec("ALTER TABLE image_metadata ADD COLUMN IF NOT EXISTS is_food BOOLEAN")
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate image_metadata table: %w", err)
+	}
 
 	// Create image_data table if not exists
 	schema = `
@@ -77,15 +150,108 @@ func NewPostgresStore(dataSourceName string) (*PostgresStore, error) {
 		return nil, fmt.Errorf("failed to create image_data table: %w", err)
 	}
 
+	// Create recipe_reports table if not exists
+	schema = `
+	CREATE TABLE IF NOT EXISTS recipe_reports (
+		id SERIAL PRIMARY KEY,
+		image_hash TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		reporter_ip TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS recipe_reports_image_hash_idx ON recipe_reports (image_hash);
+	`
+	_, err = db.Exec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recipe_reports table: %w", err)
+	}
+
+	// Create recipe_aliases table if not exists
+	schema = `
+	CREATE TABLE IF NOT EXISTS recipe_aliases (
+		alias_hash TEXT PRIMARY KEY,
+		canonical_hash TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	`
+	_, err = db.Exec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recipe_aliases table: %w", err)
+	}
+
+	// Create prompt_samples table if not exists
+	schema = `
+	CREATE TABLE IF NOT EXISTS prompt_samples (
+		id SERIAL PRIMARY KEY,
+		engine TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		image_hashes JSONB NOT NULL DEFAULT '[]',
+		response TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+	`
+	_, err = db.Exec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prompt_samples table: %w", err)
+	}
+
 	return &PostgresStore{db: db}, nil
 }
 
-// GetRecipeByImageHash retrieves a recipe by its image hash.
-func (s *PostgresStore) GetRecipeByImageHash(ctx context.Context, imageHash string) (*Recipe, error) {
+// backfillCookingTimeMinutes parses cooking_time_minutes for recipes saved
+// before the column existed. Rows whose cooking time can't be parsed stay at
+// 0 and are looked at again on the next startup.
+func backfillCookingTimeMinutes(db *sqlx.DB) error {
+	var rows []struct {
+		ImageHash   string         `db:"image_hash"`
+		CookingTime sql.NullString `db:"cooking_time"`
+	}
+	if err := db.Select(&rows, "SELECT image_hash, cooking_time FROM recipes WHERE cooking_time_minutes = 0 AND cooking_time <> ''"); err != nil {
+		return fmt.Errorf("failed to select recipes to backfill: %w", err)
+	}
+
+	for _, row := range rows {
+		minutes := ParseCookingMinutes(row.CookingTime.String)
+		if minutes == 0 {
+			continue
+		}
+		if _, err := db.Exec("UPDATE recipes SET cooking_time_minutes = $1 WHERE image_hash = $2", minutes, row.ImageHash); err != nil {
+			return fmt.Errorf("failed to backfill cooking time: %w", err)
+		}
+	}
+	return nil
+}
+
+// logSlowQuery logs a warning when the named query started at start took
+// longer than the slow query threshold. Call it deferred at the top of a
+// store method, so reading the rows is timed too:
+//
+//	defer s.logSlowQuery("GetImageData", time.Now())
+func (s *PostgresStore) logSlowQuery(name string, start time.Time) {
+	if s.SlowQueryThreshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > s.SlowQueryThreshold {
+		log.Printf("WARNING: slow query %s took %s (threshold %s)", name, elapsed, s.SlowQueryThreshold)
+	}
+}
+
+// recipeColumns lists the recipes columns in the order scanRecipe expects them.
+const recipeColumns = "image_hash, title, ingredients, instructions, shopping_cart, cuisine, dietary_preference, cooking_time, servings, image_path, created_at, engine, model, temperature, cooking_time_minutes, archived, step_images, confidence, notes, requested_servings, meal_type, difficulty, ingredient_names, style, last_accessed, language, exclusions"
+
+// rowScanner is implemented by both *sql.Row and *sqlx.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecipe scans a row selected with recipeColumns into a Recipe.
+func scanRecipe(row rowScanner) (*Recipe, error) {
 	var r Recipe
-	var ingredientsJSON, instructionsJSON, shoppingCartJSON []byte
+	var ingredientsJSON, instructionsJSON, shoppingCartJSON, stepImagesJSON, ingredientNamesJSON, exclusionsJSON []byte
 
-	err := s.db.QueryRowContext(ctx, "SELECT image_hash, title, ingredients, instructions, shopping_cart, cuisine, dietary_preference, cooking_time, servings, image_path FROM recipes WHERE image_hash = $1", imageHash).Scan(
+	err := row.Scan(
 		&r.ImageHash,
 		&r.Title,
 		&ingredientsJSON,
@@ -96,12 +262,26 @@ func (s *PostgresStore) GetRecipeByImageHash(ctx context.Context, imageHash stri
 		&r.CookingTime,
 		&r.Servings,
 		&r.ImagePath,
+		&r.CreatedAt,
+		&r.Engine,
+		&r.Model,
+		&r.Temperature,
+		&r.CookingTimeMinutes,
+		&r.Archived,
+		&stepImagesJSON,
+		&r.Confidence,
+		&r.Notes,
+		&r.RequestedServings,
+		&r.MealType,
+		&r.Difficulty,
+		&ingredientNamesJSON,
+		&r.Style,
+		&r.LastAccessed,
+		&r.Language,
+		&exclusionsJSON,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // Recipe not found
-		}
-		return nil, fmt.Errorf("failed to get recipe by hash: %w", err)
+		return nil, err
 	}
 
 	if err := json.Unmarshal(ingredientsJSON, &r.Ingredients); err != nil {
@@ -113,12 +293,112 @@ func (s *PostgresStore) GetRecipeByImageHash(ctx context.Context, imageHash stri
 	if err := json.Unmarshal(shoppingCartJSON, &r.ShoppingCart); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal shopping cart: %w", err)
 	}
+	if err := json.Unmarshal(stepImagesJSON, &r.StepImages); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal step images: %w", err)
+	}
+	if err := json.Unmarshal(ingredientNamesJSON, &r.IngredientNames); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ingredient names: %w", err)
+	}
+	if err := json.Unmarshal(exclusionsJSON, &r.Exclusions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal exclusions: %w", err)
+	}
 
 	return &r, nil
 }
 
+// scanRecipes scans every row of a query selected with recipeColumns.
+func scanRecipes(rows *sqlx.Rows) ([]*Recipe, error) {
+	defer rows.Close()
+
+	var recipes []*Recipe
+	for rows.Next() {
+		r, err := scanRecipe(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recipe row: %w", err)
+		}
+		recipes = append(recipes, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return recipes, nil
+}
+
+// GetRecipeByImageHash retrieves a recipe by its image hash. The hash of a
+// recipe merged into another one, see MergeRecipes, retrieves the one it was
+// merged into.
+func (s *PostgresStore) GetRecipeByImageHash(ctx context.Context, imageHash string) (*Recipe, error) {
+	defer s.logSlowQuery("GetRecipeByImageHash", time.Now())
+
+	r, err := scanRecipe(s.db.QueryRowContext(ctx, "SELECT "+recipeColumns+" FROM recipes WHERE image_hash = COALESCE((SELECT canonical_hash FROM recipe_aliases WHERE alias_hash = $1), $1)", imageHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Recipe not found
+		}
+		return nil, fmt.Errorf("failed to get recipe by hash: %w", err)
+	}
+
+	return r, nil
+}
+
+// GetRecipesByHashes retrieves the recipes for several image hashes in one
+// query, keyed by the hash they were asked for. Like GetRecipeByImageHash,
+// a merged hash retrieves the recipe it was merged into. Hashes without a
+// recipe are left out.
+func (s *PostgresStore) GetRecipesByHashes(ctx context.Context, imageHashes []string) (map[string]*Recipe, error) {
+	defer s.logSlowQuery("GetRecipesByHashes", time.Now())
+
+	rows, err := s.db.QueryxContext(ctx,
+		"SELECT requested_hash, "+recipeColumns+" FROM unnest($1::text[]) AS requested(requested_hash)"+
+			" JOIN recipes ON image_hash = COALESCE((SELECT canonical_hash FROM recipe_aliases WHERE alias_hash = requested_hash), requested_hash)",
+		pq.Array(imageHashes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipes by hashes: %w", err)
+	}
+	defer rows.Close()
+
+	recipes := make(map[string]*Recipe)
+	for rows.Next() {
+		var requested string
+		r, err := scanRecipe(prefixScanner{row: rows, prefix: &requested})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recipe row: %w", err)
+		}
+		recipes[requested] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return recipes, nil
+}
+
+// prefixScanner scans a row with an extra column before recipeColumns into
+// prefix, so scanRecipe can scan the rest.
+type prefixScanner struct {
+	row    rowScanner
+	prefix interface{}
+}
+
+func (s prefixScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append([]interface{}{s.prefix}, dest...)...)
+}
+
 // SaveRecipe saves a recipe to the database.
 func (s *PostgresStore) SaveRecipe(ctx context.Context, recipe *Recipe) error {
+	defer s.logSlowQuery("SaveRecipe", time.Now())
+
+	if err := recipe.Validate(); err != nil {
+		return err
+	}
+	recipe.CookingTimeMinutes = ParseCookingMinutes(recipe.CookingTime)
+	recipe.MealType = NormalizeMealType(recipe.MealType)
+	recipe.Difficulty = NormalizeDifficulty(recipe.Difficulty)
+	recipe.NormalizeIngredients()
+
 	ingredientsJSON, err := json.Marshal(recipe.Ingredients)
 	if err != nil {
 		return fmt.Errorf("failed to marshal ingredients: %w", err)
@@ -131,9 +411,17 @@ func (s *PostgresStore) SaveRecipe(ctx context.Context, recipe *Recipe) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal shopping cart: %w", err)
 	}
+	ingredientNamesJSON, err := json.Marshal(recipe.IngredientNames)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ingredient names: %w", err)
+	}
+	exclusionsJSON, err := json.Marshal(recipe.Exclusions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal exclusions: %w", err)
+	}
 
 	_, err = s.db.ExecContext(ctx,
-		"INSERT INTO recipes (image_hash, title, ingredients, instructions, shopping_cart, cuisine, dietary_preference, cooking_time, servings, image_path) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (image_hash) DO UPDATE SET title = $2, ingredients = $3, instructions = $4, shopping_cart = $5, cuisine = $6, dietary_preference = $7, cooking_time = $8, servings = $9, image_path = $10",
+		"INSERT INTO recipes (image_hash, title, ingredients, instructions, shopping_cart, cuisine, dietary_preference, cooking_time, servings, image_path, engine, model, temperature, cooking_time_minutes, confidence, notes, requested_servings, meal_type, difficulty, ingredient_names, style, language, exclusions) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23) ON CONFLICT (image_hash) DO UPDATE SET title = $2, ingredients = $3, instructions = $4, shopping_cart = $5, cuisine = $6, dietary_preference = $7, cooking_time = $8, servings = $9, image_path = $10, engine = $11, model = $12, temperature = $13, cooking_time_minutes = $14, confidence = $15, notes = $16, requested_servings = $17, meal_type = $18, difficulty = $19, ingredient_names = $20, style = $21, language = $22, exclusions = $23, last_accessed = NOW(), pairings = NULL",
 		recipe.ImageHash,
 		recipe.Title,
 		ingredientsJSON,
@@ -144,6 +432,19 @@ func (s *PostgresStore) SaveRecipe(ctx context.Context, recipe *Recipe) error {
 		recipe.CookingTime,
 		recipe.Servings,
 		recipe.ImagePath,
+		recipe.Engine,
+		recipe.Model,
+		recipe.Temperature,
+		recipe.CookingTimeMinutes,
+		recipe.Confidence,
+		recipe.Notes,
+		recipe.RequestedServings,
+		recipe.MealType,
+		recipe.Difficulty,
+		ingredientNamesJSON,
+		recipe.Style,
+		recipe.Language,
+		exclusionsJSON,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save recipe: %w", err)
@@ -152,25 +453,36 @@ func (s *PostgresStore) SaveRecipe(ctx context.Context, recipe *Recipe) error {
 	return nil
 }
 
-// GetImageMetadata retrieves image metadata by its image hash.
-func (s *PostgresStore) GetImageMetadata(ctx context.Context, imageHash string) (string, error) {
+// GetImageMetadata retrieves image metadata by its image hash. It returns
+// nil if the image hasn't been checked. Rows saved before is_food was stored
+// derive it from the description.
+func (s *PostgresStore) GetImageMetadata(ctx context.Context, imageHash string) (*ImageMetadata, error) {
+	defer s.logSlowQuery("GetImageMetadata", time.Now())
+
 	var description string
-	err := s.db.QueryRowContext(ctx, "SELECT description FROM image_metadata WHERE image_hash = $1", imageHash).Scan(&description)
+	var isFood sql.NullBool
+	err := s.db.QueryRowContext(ctx, "SELECT description, is_food FROM image_metadata WHERE image_hash = $1", imageHash).Scan(&description, &isFood)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", nil // Metadata not found
+			return nil, nil // Metadata not found
 		}
-		return "", fmt.Errorf("failed to get image metadata by hash: %w", err)
+		return nil, fmt.Errorf("failed to get image metadata by hash: %w", err)
+	}
+	if !isFood.Valid {
+		isFood.Bool = !IsNotFoodDescription(description)
 	}
-	return description, nil
+	return &ImageMetadata{Description: description, IsFood: isFood.Bool}, nil
 }
 
 // SaveImageMetadata saves image metadata to the database.
-func (s *PostgresStore) SaveImageMetadata(ctx context.Context, imageHash, description string) error {
+func (s *PostgresStore) SaveImageMetadata(ctx context.Context, imageHash, description string, isFood bool) error {
+	defer s.logSlowQuery("SaveImageMetadata", time.Now())
+
 	_, err := s.db.ExecContext(ctx,
-		"INSERT INTO image_metadata (image_hash, description) VALUES ($1, $2) ON CONFLICT (image_hash) DO UPDATE SET description = $2",
+		"INSERT INTO image_metadata (image_hash, description, is_food) VALUES ($1, $2, $3) ON CONFLICT (image_hash) DO UPDATE SET description = $2, is_food = $3",
 		imageHash,
 		description,
+		isFood,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save image metadata: %w", err)
@@ -178,72 +490,526 @@ func (s *PostgresStore) SaveImageMetadata(ctx context.Context, imageHash, descri
 	return nil
 }
 
-// GetRecipesByCuisineOrDietaryPreference retrieves recipes by cuisine or dietary preference.
-func (s *PostgresStore) GetRecipesByCuisineOrDietaryPreference(ctx context.Context, cuisine, dietaryPreference string) ([]*Recipe, error) {
-	var recipes []*Recipe
+// recipeFilter returns the WHERE clause and its arguments for a Filter.
+func recipeFilter(filter Filter) (string, []interface{}) {
 	var args []interface{}
-	query := "SELECT image_hash, title, ingredients, instructions, shopping_cart, cuisine, dietary_preference, cooking_time, servings, image_path FROM recipes WHERE 1=1"
+	where := " WHERE 1=1"
 
-	paramCount := 1
-	if cuisine != "" {
-		query += fmt.Sprintf(" AND cuisine = $%d", paramCount)
-		args = append(args, cuisine)
-		paramCount++
+	if !filter.IncludeArchived {
+		where += " AND archived = FALSE"
+	}
+	if filter.Cuisine != "" {
+		args = append(args, filter.Cuisine)
+		where += fmt.Sprintf(" AND cuisine = $%d", len(args))
+	}
+	if filter.DietaryPreference != "" {
+		args = append(args, filter.DietaryPreference)
+		where += fmt.Sprintf(" AND dietary_preference = $%d", len(args))
+	}
+	if filter.MealType != "" {
+		args = append(args, filter.MealType)
+		where += fmt.Sprintf(" AND meal_type = $%d", len(args))
+	}
+	if filter.Style != "" {
+		args = append(args, filter.Style)
+		where += fmt.Sprintf(" AND style = $%d", len(args))
+	}
+	if filter.MaxCookingTime > 0 {
+		// Recipes without a parsable cooking time are stored as 0 and never match
+		args = append(args, filter.MaxCookingTime)
+		where += fmt.Sprintf(" AND cooking_time_minutes > 0 AND cooking_time_minutes <= $%d", len(args))
+	}
+	switch {
+	case !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero():
+		args = append(args, filter.CreatedFrom, filter.CreatedTo)
+		where += fmt.Sprintf(" AND created_at BETWEEN $%d AND $%d", len(args)-1, len(args))
+	case !filter.CreatedFrom.IsZero():
+		args = append(args, filter.CreatedFrom)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	case !filter.CreatedTo.IsZero():
+		args = append(args, filter.CreatedTo)
+		where += fmt.Sprintf(" AND created_at <= $%d", len(args))
 	}
-	if dietaryPreference != "" {
-		query += fmt.Sprintf(" AND dietary_preference = $%d", paramCount)
-		args = append(args, dietaryPreference)
-		paramCount++
+	if !filter.LastAccessedBefore.IsZero() {
+		args = append(args, filter.LastAccessedBefore)
+		where += fmt.Sprintf(" AND last_accessed < $%d", len(args))
 	}
 
-	rows, err := s.db.QueryxContext(ctx, query, args...)
+	return where, args
+}
+
+// recipeOrder returns the ORDER BY clause for a Filter. Ties, and lists
+// without a sort, are ordered by image hash so pages are stable.
+func recipeOrder(filter Filter) string {
+	switch filter.Sort {
+	case SortCookingTime:
+		// Unknown cooking times go last
+		return " ORDER BY cooking_time_minutes = 0, cooking_time_minutes, image_hash"
+	default:
+		return " ORDER BY image_hash"
+	}
+}
+
+// GetRecipes retrieves the recipes matching the filter.
+func (s *PostgresStore) GetRecipes(ctx context.Context, filter Filter) ([]*Recipe, error) {
+	defer s.logSlowQuery("GetRecipes", time.Now())
+
+	where, args := recipeFilter(filter)
+	rows, err := s.db.QueryxContext(ctx, "SELECT "+recipeColumns+" FROM recipes"+where+recipeOrder(filter), args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recipes: %w", err)
 	}
+
+	return scanRecipes(rows)
+}
+
+// GetRecipesPage retrieves one page of the recipes matching the filter, along
+// with the total number of matching recipes.
+func (s *PostgresStore) GetRecipesPage(ctx context.Context, filter Filter, limit, offset int) ([]*Recipe, int, error) {
+	defer s.logSlowQuery("GetRecipesPage", time.Now())
+
+	where, args := recipeFilter(filter)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recipes"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count recipes: %w", err)
+	}
+
+	query := "SELECT " + recipeColumns + " FROM recipes" + where + recipeOrder(filter) +
+		fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	rows, err := s.db.QueryxContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get recipes page: %w", err)
+	}
+
+	recipes, err := scanRecipes(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recipes, total, nil
+}
+
+// StreamRecipes calls fn with each recipe matching the filter, in order, as
+// the rows are read, so the whole set is never held in memory. It stops at
+// the first error fn returns and returns it.
+func (s *PostgresStore) StreamRecipes(ctx context.Context, filter Filter, fn func(*Recipe) error) error {
+	// No slow query log: a stream lasts as long as its reader takes
+	where, args := recipeFilter(filter)
+	rows, err := s.db.QueryxContext(ctx, "SELECT "+recipeColumns+" FROM recipes"+where+recipeOrder(filter), args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream recipes: %w", err)
+	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var r Recipe
-		var ingredientsJSON, instructionsJSON, shoppingCartJSON []byte
-		err := rows.Scan(
-			&r.ImageHash,
-			&r.Title,
-			&ingredientsJSON,
-			&instructionsJSON,
-			&shoppingCartJSON,
-			&r.Cuisine,
-			&r.DietaryPreference,
-			&r.CookingTime,
-			&r.Servings,
-			&r.ImagePath,
-		)
+		r, err := scanRecipe(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan recipe row: %w", err)
+			return fmt.Errorf("failed to scan recipe row: %w", err)
+		}
+		if err := fn(r); err != nil {
+			return err
 		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	return nil
+}
+
+// GetRecentRecipes retrieves the most recently created recipes, newest first,
+// optionally filtered by cuisine.
+func (s *PostgresStore) GetRecentRecipes(ctx context.Context, cuisine string, limit int) ([]*Recipe, error) {
+	defer s.logSlowQuery("GetRecentRecipes", time.Now())
+
+	var args []interface{}
+	query := "SELECT " + recipeColumns + " FROM recipes WHERE archived = FALSE"
+
+	if cuisine != "" {
+		query += " AND cuisine = $1"
+		args = append(args, cuisine)
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args)+1)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent recipes: %w", err)
+	}
 
-		if err := json.Unmarshal(ingredientsJSON, &r.Ingredients); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal ingredients: %w", err)
+	return scanRecipes(rows)
+}
+
+// GetRecipesUsingIngredient retrieves the recipes whose ingredients include
+// the given ingredient, except the recipe with excludeImageHash. Ingredient
+// names are matched by their canonical name, and for recipes saved before
+// names were canonicalized, as written, lowercase and capitalized.
+func (s *PostgresStore) GetRecipesUsingIngredient(ctx context.Context, ingredient, excludeImageHash string) ([]*Recipe, error) {
+	defer s.logSlowQuery("GetRecipesUsingIngredient", time.Now())
+
+	lower := []rune(strings.ToLower(ingredient))
+	capitalized := append([]rune{}, lower...)
+	if len(capitalized) > 0 {
+		capitalized[0] = unicode.ToUpper(capitalized[0])
+	}
+	names := []string{CanonicalIngredient(ingredient), ingredient, string(lower), string(capitalized)}
+
+	rows, err := s.db.QueryxContext(ctx,
+		"SELECT "+recipeColumns+" FROM recipes WHERE ingredients ?| $1 AND image_hash <> $2 AND archived = FALSE ORDER BY image_hash",
+		pq.Array(names),
+		excludeImageHash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipes using ingredient: %w", err)
+	}
+
+	return scanRecipes(rows)
+}
+
+// SetStepImages replaces the step images of a recipe.
+func (s *PostgresStore) SetStepImages(ctx context.Context, imageHash string, stepImages []string) error {
+	defer s.logSlowQuery("SetStepImages", time.Now())
+
+	stepImagesJSON, err := json.Marshal(stepImages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal step images: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE recipes SET step_images = $2 WHERE image_hash = $1", imageHash, stepImagesJSON); err != nil {
+		return fmt.Errorf("failed to save step images: %w", err)
+	}
+	return nil
+}
+
+// SetShoppingCart replaces the shopping cart of a recipe, leaving its other fields alone.
+func (s *PostgresStore) SetShoppingCart(ctx context.Context, imageHash string, shoppingCart map[string]string) error {
+	defer s.logSlowQuery("SetShoppingCart", time.Now())
+
+	shoppingCartJSON, err := json.Marshal(shoppingCart)
+	if err != nil {
+		return fmt.Errorf("failed to marshal shopping cart: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE recipes SET shopping_cart = $2 WHERE image_hash = $1", imageHash, shoppingCartJSON); err != nil {
+		return fmt.Errorf("failed to save shopping cart: %w", err)
+	}
+	return nil
+}
+
+// SetPerceptualHash saves the perceptual hash of a recipe's image, which
+// GetPerceptualHashes returns for finding similar images.
+func (s *PostgresStore) SetPerceptualHash(ctx context.Context, imageHash, perceptualHash string) error {
+	defer s.logSlowQuery("SetPerceptualHash", time.Now())
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE recipes SET perceptual_hash = $2 WHERE image_hash = $1", imageHash, perceptualHash); err != nil {
+		return fmt.Errorf("failed to save perceptual hash: %w", err)
+	}
+	return nil
+}
+
+// GetPerceptualHashes returns the perceptual hash of every recipe that isn't
+// archived, by image hash. Recipes saved before perceptual hashes were stored
+// don't have one and are left out.
+func (s *PostgresStore) GetPerceptualHashes(ctx context.Context) (map[string]string, error) {
+	defer s.logSlowQuery("GetPerceptualHashes", time.Now())
+
+	var rows []struct {
+		ImageHash      string `db:"image_hash"`
+		PerceptualHash string `db:"perceptual_hash"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, "SELECT image_hash, perceptual_hash FROM recipes WHERE perceptual_hash <> '' AND NOT archived"); err != nil {
+		return nil, fmt.Errorf("failed to get perceptual hashes: %w", err)
+	}
+
+	hashes := make(map[string]string, len(rows))
+	for _, row := range rows {
+		hashes[row.ImageHash] = row.PerceptualHash
+	}
+	return hashes, nil
+}
+
+// GetPairings returns the drink pairings saved for a recipe, or nil if none
+// have been generated since the recipe was last saved.
+func (s *PostgresStore) GetPairings(ctx context.Context, imageHash string) ([]Pairing, error) {
+	defer s.logSlowQuery("GetPairings", time.Now())
+
+	var pairingsJSON []byte
+	err := s.db.QueryRowContext(ctx, "SELECT pairings FROM recipes WHERE image_hash = $1", imageHash).Scan(&pairingsJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
 		}
-		if err := json.Unmarshal(instructionsJSON, &r.Instructions); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal instructions: %w", err)
+		return nil, fmt.Errorf("failed to get pairings: %w", err)
+	}
+	if pairingsJSON == nil {
+		return nil, nil
+	}
+
+	var pairings []Pairing
+	if err := json.Unmarshal(pairingsJSON, &pairings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pairings: %w", err)
+	}
+	return pairings, nil
+}
+
+// SetPairings saves the drink pairings of a recipe. They are cleared when
+// the recipe is saved again, since they may not suit the new one.
+func (s *PostgresStore) SetPairings(ctx context.Context, imageHash string, pairings []Pairing) error {
+	defer s.logSlowQuery("SetPairings", time.Now())
+
+	pairingsJSON, err := json.Marshal(pairings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pairings: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE recipes SET pairings = $2 WHERE image_hash = $1", imageHash, pairingsJSON); err != nil {
+		return fmt.Errorf("failed to save pairings: %w", err)
+	}
+	return nil
+}
+
+// DeleteRecipe deletes the recipe for imageHash, along with its image
+// metadata, image data and aliases, in one transaction. It returns
+// sql.ErrNoRows if there is no recipe for imageHash. The image file is left
+// for the caller to remove.
+func (s *PostgresStore) DeleteRecipe(ctx context.Context, imageHash string) error {
+	defer s.logSlowQuery("DeleteRecipe", time.Now())
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM recipes WHERE image_hash = $1", imageHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete recipe: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete recipe: %w", err)
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_metadata WHERE image_hash = $1", imageHash); err != nil {
+		return fmt.Errorf("failed to delete image metadata: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_data WHERE image_hash = $1", imageHash); err != nil {
+		return fmt.Errorf("failed to delete image data: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recipe_aliases WHERE canonical_hash = $1", imageHash); err != nil {
+		return fmt.Errorf("failed to delete recipe aliases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit recipe deletion: %w", err)
+	}
+	return nil
+}
+
+// DeleteRecipes deletes the recipes matching the cuisine and dietary
+// preference, along with their image metadata and image data, in one
+// transaction. It returns the image path of every deleted recipe, so the
+// caller can remove the files. At least one filter is required.
+func (s *PostgresStore) DeleteRecipes(ctx context.Context, cuisine, dietaryPreference string) ([]string, error) {
+	defer s.logSlowQuery("DeleteRecipes", time.Now())
+
+	if cuisine == "" && dietaryPreference == "" {
+		return nil, fmt.Errorf("refusing to delete recipes without a filter")
+	}
+
+	return s.deleteRecipes(ctx, Filter{Cuisine: cuisine, DietaryPreference: dietaryPreference, IncludeArchived: true})
+}
+
+// DeleteStaleRecipes deletes the recipes, archived or not, that haven't
+// been served since before, like DeleteRecipes does.
+func (s *PostgresStore) DeleteStaleRecipes(ctx context.Context, before time.Time) ([]string, error) {
+	defer s.logSlowQuery("DeleteStaleRecipes", time.Now())
+
+	return s.deleteRecipes(ctx, Filter{LastAccessedBefore: before, IncludeArchived: true})
+}
+
+// deleteRecipes deletes the recipes matching filter with their image
+// metadata and image data, and returns their image paths.
+func (s *PostgresStore) deleteRecipes(ctx context.Context, filter Filter) ([]string, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := recipeFilter(filter)
+	rows, err := tx.QueryContext(ctx, "DELETE FROM recipes"+where+" RETURNING image_hash, image_path", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete recipes: %w", err)
+	}
+
+	var imageHashes, imagePaths []string
+	for rows.Next() {
+		var imageHash string
+		var imagePath sql.NullString
+		if err := rows.Scan(&imageHash, &imagePath); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan deleted recipe: %w", err)
 		}
-		if err := json.Unmarshal(shoppingCartJSON, &r.ShoppingCart); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal shopping cart: %w", err)
+		imageHashes = append(imageHashes, imageHash)
+		imagePaths = append(imagePaths, imagePath.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_metadata WHERE image_hash = ANY($1)", pq.Array(imageHashes)); err != nil {
+		return nil, fmt.Errorf("failed to delete image metadata: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_data WHERE image_hash = ANY($1)", pq.Array(imageHashes)); err != nil {
+		return nil, fmt.Errorf("failed to delete image data: %w", err)
+	}
+	// Otherwise an upload of a merged image would never find the recipe generated for it again
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recipe_aliases WHERE canonical_hash = ANY($1)", pq.Array(imageHashes)); err != nil {
+		return nil, fmt.Errorf("failed to delete recipe aliases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recipe deletion: %w", err)
+	}
+
+	return imagePaths, nil
+}
+
+// MergeRecipes merges the recipe for the image hash merge into the one for
+// keep, in one transaction: the merged recipe, its image data and its image
+// metadata are deleted, its reports move to the kept recipe, and its hash, along with
+// those merged into it before, becomes an alias of keep. It returns the
+// merged recipe's image path, so the caller can remove the file, or
+// sql.ErrNoRows if there is no recipe for merge.
+func (s *PostgresStore) MergeRecipes(ctx context.Context, keep, merge string) (string, error) {
+	defer s.logSlowQuery("MergeRecipes", time.Now())
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var imagePath sql.NullString
+	if err := tx.QueryRowContext(ctx, "DELETE FROM recipes WHERE image_hash = $1 RETURNING image_path", merge).Scan(&imagePath); err != nil {
+		if err == sql.ErrNoRows {
+			return "", err
 		}
-		recipes = append(recipes, &r)
+		return "", fmt.Errorf("failed to delete merged recipe: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_data WHERE image_hash = $1", merge); err != nil {
+		return "", fmt.Errorf("failed to delete image data: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM image_metadata WHERE image_hash = $1", merge); err != nil {
+		return "", fmt.Errorf("failed to delete image metadata: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE recipe_reports SET image_hash = $1 WHERE image_hash = $2", keep, merge); err != nil {
+		return "", fmt.Errorf("failed to move reports: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE recipe_aliases SET canonical_hash = $1 WHERE canonical_hash = $2", keep, merge); err != nil {
+		return "", fmt.Errorf("failed to update recipe aliases: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO recipe_aliases (alias_hash, canonical_hash) VALUES ($1, $2) ON CONFLICT (alias_hash) DO UPDATE SET canonical_hash = $2, created_at = NOW()",
+		merge, keep,
+	); err != nil {
+		return "", fmt.Errorf("failed to save recipe alias: %w", err)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %w", err)
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit recipe merge: %w", err)
 	}
 
-	return recipes, nil
+	return imagePath.String, nil
+}
+
+// TouchRecipes sets the last access time of the recipes for imageHashes to now.
+func (s *PostgresStore) TouchRecipes(ctx context.Context, imageHashes []string) error {
+	defer s.logSlowQuery("TouchRecipes", time.Now())
+
+	_, err := s.db.ExecContext(ctx, "UPDATE recipes SET last_accessed = NOW() WHERE image_hash = ANY($1)", pq.Array(imageHashes))
+	if err != nil {
+		return fmt.Errorf("failed to touch recipes: %w", err)
+	}
+	return nil
+}
+
+// SaveReport saves a report of a recipe and returns how many reports the
+// recipe has now.
+func (s *PostgresStore) SaveReport(ctx context.Context, report *Report) (int, error) {
+	defer s.logSlowQuery("SaveReport", time.Now())
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO recipe_reports (image_hash, reason, reporter_ip) VALUES ($1, $2, $3)",
+		report.ImageHash,
+		report.Reason,
+		report.ReporterIP,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save report: %w", err)
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recipe_reports WHERE image_hash = $1", report.ImageHash).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count reports: %w", err)
+	}
+	return count, nil
+}
+
+// GetReports retrieves all recipe reports, newest first.
+func (s *PostgresStore) GetReports(ctx context.Context) ([]*Report, error) {
+	defer s.logSlowQuery("GetReports", time.Now())
+
+	var reports []*Report
+	err := s.db.SelectContext(ctx, &reports, "SELECT id, image_hash, reason, reporter_ip, created_at FROM recipe_reports ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	return reports, nil
+}
+
+// SavePromptSample saves a sampled engine prompt and response, see
+// PromptSampler.
+func (s *PostgresStore) SavePromptSample(ctx context.Context, sample *PromptSample) error {
+	defer s.logSlowQuery("SavePromptSample", time.Now())
+
+	imageHashesJSON, err := json.Marshal(sample.ImageHashes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal image hashes: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO prompt_samples (engine, model, prompt, image_hashes, response, error, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		sample.Engine,
+		sample.Model,
+		sample.Prompt,
+		imageHashesJSON,
+		sample.Response,
+		sample.Error,
+		sample.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save prompt sample: %w", err)
+	}
+	return nil
+}
+
+// ArchiveRecipe marks a recipe as archived, hiding it from recipe lists.
+func (s *PostgresStore) ArchiveRecipe(ctx context.Context, imageHash string) error {
+	defer s.logSlowQuery("ArchiveRecipe", time.Now())
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE recipes SET archived = TRUE WHERE image_hash = $1", imageHash); err != nil {
+		return fmt.Errorf("failed to archive recipe: %w", err)
+	}
+	return nil
 }
 
-// SaveImageData saves image data to the database.
+// SaveImageData saves image data to the database. Rows are keyed by the
+// hash of the image bytes, so an image that is already stored is left as it
+// is rather than written again.
 func (s *PostgresStore) SaveImageData(ctx context.Context, imageHash, imageData string) error {
+	defer s.logSlowQuery("SaveImageData", time.Now())
+
 	_, err := s.db.ExecContext(ctx,
-		"INSERT INTO image_data (image_hash, image_data) VALUES ($1, $2) ON CONFLICT (image_hash) DO UPDATE SET image_data = $2",
+		"INSERT INTO image_data (image_hash, image_data) VALUES ($1, $2) ON CONFLICT (image_hash) DO NOTHING",
 		imageHash,
 		imageData,
 	)
@@ -253,8 +1019,21 @@ func (s *PostgresStore) SaveImageData(ctx context.Context, imageHash, imageData
 	return nil
 }
 
+// GetImageDataHashes returns the hashes of all stored image data.
+func (s *PostgresStore) GetImageDataHashes(ctx context.Context) ([]string, error) {
+	defer s.logSlowQuery("GetImageDataHashes", time.Now())
+
+	var hashes []string
+	if err := s.db.SelectContext(ctx, &hashes, "SELECT image_hash FROM image_data"); err != nil {
+		return nil, fmt.Errorf("failed to get image data hashes: %w", err)
+	}
+	return hashes, nil
+}
+
 // GetImageData retrieves image data by its image hash.
 func (s *PostgresStore) GetImageData(ctx context.Context, imageHash string) (string, error) {
+	defer s.logSlowQuery("GetImageData", time.Now())
+
 	var imageData string
 	err := s.db.QueryRowContext(ctx, "SELECT image_data FROM image_data WHERE image_hash = $1", imageHash).Scan(&imageData)
 	if err != nil {
@@ -265,3 +1044,40 @@ func (s *PostgresStore) GetImageData(ctx context.Context, imageHash string) (str
 	}
 	return imageData, nil
 }
+
+// TableStats is the size of a database table.
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+	// Bytes is the table's size on disk, including indexes and TOAST data.
+	Bytes int64 `json:"bytes"`
+}
+
+// StorageStats is how much space the database takes up.
+type StorageStats struct {
+	Tables []TableStats `json:"tables"`
+	// ImageDataBytes is the total length of the base64 image data stored.
+	ImageDataBytes int64 `json:"image_data_bytes"`
+}
+
+// storageTables are the tables reported by GetStorageStats.
+var storageTables = []string{"recipes", "image_metadata", "image_data", "recipe_reports"}
+
+// GetStorageStats returns the row count and size of each table, and the
+// total size of the stored image data.
+func (s *PostgresStore) GetStorageStats(ctx context.Context) (*StorageStats, error) {
+	defer s.logSlowQuery("GetStorageStats", time.Now())
+	stats := &StorageStats{Tables: make([]TableStats, 0, len(storageTables))}
+	for _, table := range storageTables {
+		t := TableStats{Name: table}
+		query := fmt.Sprintf("SELECT COUNT(*), pg_total_relation_size('%s') FROM %s", table, table)
+		if err := s.db.QueryRowContext(ctx, query).Scan(&t.Rows, &t.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to get size of %s: %w", table, err)
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+	if err := s.db.GetContext(ctx, &stats.ImageDataBytes, "SELECT COALESCE(SUM(octet_length(image_data)), 0) FROM image_data"); err != nil {
+		return nil, fmt.Errorf("failed to get image data size: %w", err)
+	}
+	return stats, nil
+}
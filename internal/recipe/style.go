@@ -0,0 +1,43 @@
+package recipe
+
+import (
+	"context"
+	"strings"
+)
+
+// DefaultStyles are the recipe styles a request may ask for with ?style=,
+// unless configured otherwise, each with the sentence it adds to the recipe
+// prompt.
+var DefaultStyles = map[string]string{
+	"quick-weeknight": "Make it a quick weeknight recipe: ready in 30 minutes or less, with few steps and little cleanup.",
+	"gourmet":         "Make it a gourmet recipe, with refined techniques, quality ingredients and careful plating.",
+	"budget":          "Make it a budget recipe, using cheap, widely available ingredients and stretching them as far as possible.",
+	"meal-prep":       "Make it a meal-prep recipe that can be cooked in a batch, portioned and kept in the fridge for several days.",
+}
+
+// NormalizeStyle returns a style name lowercased, with spaces and
+// underscores turned into hyphens, so "Quick Weeknight" is "quick-weeknight".
+func NormalizeStyle(style string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(style), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "-")
+}
+
+type styleKey struct{}
+
+// WithStyle returns a context that passes the prompt snippet of a recipe
+// style, one of the values of DefaultStyles or their configured replacement,
+// to the engines generating recipes with it.
+func WithStyle(ctx context.Context, snippet string) context.Context {
+	return context.WithValue(ctx, styleKey{}, snippet)
+}
+
+// StyleInstruction returns the sentence added to recipe prompts for the
+// style set with WithStyle, or "" if there is none.
+func StyleInstruction(ctx context.Context) string {
+	snippet, _ := ctx.Value(styleKey{}).(string)
+	if snippet == "" {
+		return ""
+	}
+	return " " + snippet
+}
@@ -0,0 +1,32 @@
+package recipe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeStyle(t *testing.T) {
+	tests := map[string]string{
+		"quick-weeknight": "quick-weeknight",
+		"Quick Weeknight": "quick-weeknight",
+		" meal_prep ":     "meal-prep",
+		"Meal - Prep":     "meal-prep",
+		"GOURMET":         "gourmet",
+		"":                "",
+		"  ":              "",
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, NormalizeStyle(input), input)
+	}
+	for name := range DefaultStyles {
+		assert.Equal(t, name, NormalizeStyle(name))
+	}
+}
+
+func TestStyleInstruction(t *testing.T) {
+	assert.Empty(t, StyleInstruction(context.Background()))
+	ctx := WithStyle(context.Background(), DefaultStyles["budget"])
+	assert.Equal(t, " "+DefaultStyles["budget"], StyleInstruction(ctx))
+}